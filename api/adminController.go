@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/webhooks"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// AddAdminRoutes registers the endpoints used to operate the running service, the dispatcher is
+// nil when no webhook is configured. The middlewares run after the request id and access logging
+// ones.
+func AddAdminRoutes(router *mux.Router, dispatcher *webhooks.Dispatcher, middlewares ...mux.MiddlewareFunc) {
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(logging.RequestIdMiddleware, logging.AccessLoggingMiddleware)
+	adminRouter.Use(middlewares...)
+
+	// swagger:route GET /admin/log-level admin getLogLevel
+	adminRouter.HandleFunc("/log-level", getLogLevel()).Methods("GET")
+	// swagger:route PUT /admin/log-level admin putLogLevel
+	adminRouter.HandleFunc("/log-level", putLogLevel()).Methods("PUT")
+	// swagger:route GET /admin/webhooks admin getWebhooks
+	adminRouter.HandleFunc("/webhooks", getWebhooks(dispatcher)).Methods("GET")
+}
+
+// getLogLevel returns the current log level
+func getLogLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responses.Response(w, logging.GetLoggerWithFields(r), http.StatusOK, LogLevel{Level: logging.GetLevel()})
+	}
+}
+
+// putLogLevel changes the log level without restarting the service
+func putLogLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		var request LogLevel
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			responses.ResponseError(w, logger, http.StatusBadRequest, "Invalid log level request")
+			return
+		}
+
+		if err := logging.SetLevel(request.Level); err != nil {
+			responses.ResponseError(w, logger, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+
+		logger.WithField("level", request.Level).Warn("Log level changed")
+		responses.Response(w, logger, http.StatusOK, LogLevel{Level: logging.GetLevel()})
+	}
+}
+
+// getWebhooks returns the delivery status of every webhook and the last events not delivered
+func getWebhooks(dispatcher *webhooks.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := webhooks.Status{Subscriptions: []webhooks.SubscriptionStatus{}, DeadLetters: []webhooks.DeadLetter{}}
+		if dispatcher != nil {
+			status = dispatcher.Status()
+		}
+
+		responses.Response(w, logging.GetLoggerWithFields(r), http.StatusOK, status)
+	}
+}
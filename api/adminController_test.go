@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/webhooks"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type AdminControllerTestSuite struct {
+	suite.Suite
+
+	router *mux.Router
+	level  string
+}
+
+func TestAdminControllerSuite(t *testing.T) {
+	suite.Run(t, new(AdminControllerTestSuite))
+}
+
+func (suite *AdminControllerTestSuite) SetupSuite() {
+	suite.router = mux.NewRouter()
+	AddAdminRoutes(suite.router, nil)
+}
+
+func (suite *AdminControllerTestSuite) SetupTest() {
+	suite.level = logging.GetLevel()
+}
+
+func (suite *AdminControllerTestSuite) TearDownTest() {
+	_ = logging.SetLevel(suite.level)
+}
+
+func (suite *AdminControllerTestSuite) TestGetLogLevel() {
+	// Given
+	_ = logging.SetLevel("warning")
+
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/log-level", nil))
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var level LogLevel
+	suite.Nil(json.Unmarshal(rr.Body.Bytes(), &level))
+	suite.Equal("warning", level.Level)
+}
+
+func (suite *AdminControllerTestSuite) TestPutLogLevel() {
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, httptest.NewRequest("PUT", "/admin/log-level", bytes.NewBufferString(`{"level":"debug"}`)))
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+	suite.Equal("debug", logging.GetLevel())
+}
+
+func (suite *AdminControllerTestSuite) TestPutInvalidLogLevel() {
+	// Given
+	_ = logging.SetLevel("info")
+
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, httptest.NewRequest("PUT", "/admin/log-level", bytes.NewBufferString(`{"level":"verbose"}`)))
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.Equal("info", logging.GetLevel())
+}
+
+func (suite *AdminControllerTestSuite) TestGetWebhooksDisabled() {
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/webhooks", nil))
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var status webhooks.Status
+	suite.Nil(json.Unmarshal(rr.Body.Bytes(), &status))
+	suite.Empty(status.Subscriptions)
+	suite.Empty(status.DeadLetters)
+}
+
+func (suite *AdminControllerTestSuite) TestGetWebhooks() {
+	// Given
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer receiver.Close()
+
+	dispatcher := webhooks.NewDispatcher([]webhooks.Subscription{{URL: receiver.URL, Secret: "secret"}})
+	dispatcher.Publish(webhooks.BasketCreated, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	suite.Nil(dispatcher.Close(ctx))
+
+	router := mux.NewRouter()
+	AddAdminRoutes(router, dispatcher)
+
+	// When
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/webhooks", nil))
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var status webhooks.Status
+	suite.Nil(json.Unmarshal(rr.Body.Bytes(), &status))
+	suite.Len(status.Subscriptions, 1)
+	suite.Equal(receiver.URL, status.Subscriptions[0].URL)
+	suite.Equal(1, status.Subscriptions[0].DeadLettered)
+	suite.Len(status.DeadLetters, 1)
+	suite.Equal(webhooks.BasketCreated, status.DeadLetters[0].Event.Type)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// AuthMiddleware rejects with 401 the requests the authenticator does not accept, and puts the
+// principal of the accepted ones on the request context
+func AuthMiddleware(authenticator auth.Authenticator) mux.MiddlewareFunc {
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticator.Authenticate(r)
+			if err != nil {
+				logger := logging.GetLoggerWithFields(r)
+				logger.WithField("reason", err.Error()).Info("Request not authenticated")
+
+				w.Header().Set("WWW-Authenticate", `Bearer realm="checkout"`)
+				responses.ResponseError(w, logger, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+
+			nextHandler.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// RequireScope rejects with 403 the requests whose principal lacks the scope. It goes after
+// AuthMiddleware.
+func RequireScope(scope string) mux.MiddlewareFunc {
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.PrincipalFromContext(r.Context())
+			if principal == nil || !principal.HasScope(scope) {
+				responses.ResponseError(w, logging.GetLoggerWithFields(r), http.StatusForbidden, "Missing scope "+scope)
+				return
+			}
+
+			nextHandler.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type AuthMiddlewareTestSuite struct {
+	suite.Suite
+
+	router *mux.Router
+}
+
+func TestAuthMiddlewareSuite(t *testing.T) {
+	suite.Run(t, new(AuthMiddlewareTestSuite))
+}
+
+func (suite *AuthMiddlewareTestSuite) SetupSuite() {
+	authenticator, err := auth.New(config.AuthConfig{
+		APIKeys: []config.APIKeyConfig{
+			{Key: "till-key", Subject: "till-1", Store: "store-1"},
+			{Key: "admin-key", Subject: "ops", Scopes: []string{auth.AdminScope}},
+		},
+	})
+	suite.Require().Nil(err)
+
+	suite.router = mux.NewRouter()
+	AddAdminRoutes(suite.router, nil, AuthMiddleware(authenticator), RequireScope(auth.AdminScope))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestMissingCredentials() {
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/log-level", nil))
+
+	// Then
+	suite.Equal(http.StatusUnauthorized, rr.Code)
+	suite.NotEmpty(rr.Header().Get("WWW-Authenticate"))
+
+	var body responses.ErrorResponse
+	suite.Nil(json.Unmarshal(rr.Body.Bytes(), &body))
+	suite.Equal("Authentication required", body.Error)
+}
+
+func (suite *AuthMiddlewareTestSuite) TestInvalidCredentials() {
+	// Given
+	req := httptest.NewRequest("GET", "/admin/log-level", nil)
+	req.Header.Set(auth.APIKeyHeader, "unknown-key")
+
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnauthorized, rr.Code)
+}
+
+func (suite *AuthMiddlewareTestSuite) TestMissingScope() {
+	// Given
+	req := httptest.NewRequest("GET", "/admin/log-level", nil)
+	req.Header.Set(auth.APIKeyHeader, "till-key")
+
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusForbidden, rr.Code)
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAdminScope() {
+	// Given
+	req := httptest.NewRequest("GET", "/admin/log-level", nil)
+	req.Header.Set(auth.APIKeyHeader, "admin-key")
+
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+}
@@ -3,38 +3,68 @@ package api
 import (
 	"github.com/alfcope/checkouttest/api/requests"
 	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/model"
 	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/tracing"
 	"github.com/gorilla/mux"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type CheckoutController struct {
 	checkoutService CheckoutService
+	heartbeat       time.Duration
 }
 
-func NewCheckoutController(router *mux.Router, service CheckoutService) *CheckoutController {
+// NewCheckoutController registers the basket and order routes. The middlewares, like the authentication,
+// run after the request id, tracing and access logging ones.
+func NewCheckoutController(router *mux.Router, service CheckoutService, middlewares ...mux.MiddlewareFunc) *CheckoutController {
 	controller := &CheckoutController{
 		checkoutService: service,
+		heartbeat:       eventsHeartbeat,
 	}
 
-	controller.initializeRoutes(router)
+	controller.initializeRoutes(router, middlewares)
 
 	return controller
 }
 
-func (c *CheckoutController) initializeRoutes(router *mux.Router) {
+func (c *CheckoutController) initializeRoutes(router *mux.Router, middlewares []mux.MiddlewareFunc) {
 
 	checkoutRouter := router.PathPrefix("/baskets").Subrouter()
-	checkoutRouter.Use(logging.AccessLoggingMiddleware)
+	checkoutRouter.Use(logging.RequestIdMiddleware, tracing.Middleware, logging.AccessLoggingMiddleware)
+	checkoutRouter.Use(middlewares...)
 
 	// swagger:route POST / payments postPayment
 	checkoutRouter.HandleFunc("/", c.CreateBasket()).Methods("POST").Headers("Accept", "application/json")
 	// swagger:route GET /{id} payments getPayment
 	checkoutRouter.HandleFunc("/{id}/items/", c.AddItem()).Methods("POST").Headers("Content-Type", "application/json")
+	// swagger:route DELETE /{id}/items/{code} baskets removeItem
+	checkoutRouter.HandleFunc("/{id}/items/{code}", c.RemoveItem()).Methods("DELETE")
 	// swagger:route GET / payments getPaymentsPage
 	checkoutRouter.HandleFunc("/{id}", c.GetPrice()).Methods("GET").Queries("price", "").Headers("Accept", "application/json")
+	// swagger:route GET /{id} baskets getBasket
+	checkoutRouter.HandleFunc("/{id}", c.GetBasket()).Methods("GET").Headers("Accept", "application/json")
+	// swagger:route GET /{id}/receipt baskets getReceipt
+	checkoutRouter.HandleFunc("/{id}/receipt", c.GetReceipt()).Methods("GET").Headers("Accept", "application/json")
+	// swagger:route GET /{id}/events baskets basketEvents
+	checkoutRouter.HandleFunc("/{id}/events", c.BasketEvents()).Methods("GET")
 	// swagger:route DELETE /{id} payments deletePayment
 	checkoutRouter.HandleFunc("/{id}", c.DeleteBasket()).Methods("DELETE")
+	// swagger:route POST /{id}/checkout baskets checkoutBasket
+	checkoutRouter.HandleFunc("/{id}/checkout", c.Checkout()).Methods("POST")
+
+	ordersRouter := router.PathPrefix("/orders").Subrouter()
+	ordersRouter.Use(logging.RequestIdMiddleware, tracing.Middleware, logging.AccessLoggingMiddleware)
+	ordersRouter.Use(middlewares...)
+
+	// swagger:route GET /{id} orders getOrder
+	ordersRouter.HandleFunc("/{id}", c.GetOrder()).Methods("GET").Headers("Accept", "application/json")
+	// swagger:route POST /{id}/payment orders payOrder
+	ordersRouter.HandleFunc("/{id}/payment", c.PayOrder()).Methods("POST")
+	// swagger:route POST /{id}/refund orders refundOrder
+	ordersRouter.HandleFunc("/{id}/refund", c.RefundOrder()).Methods("POST")
 }
 
 // PostPayment handles requests to add a payment into the system. The new payment
@@ -46,7 +76,10 @@ func (c *CheckoutController) CreateBasket() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := logging.GetLoggerWithFields(r)
 
-		basketId, err := c.checkoutService.CreateBasket()
+		// The basket is priced in the currency query parameter, the base one when not given
+		currency := model.Currency(strings.ToUpper(r.URL.Query().Get("currency")))
+
+		basketId, err := c.checkoutService.CreateBasket(r.Context(), currency)
 		if err != nil {
 			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
 			return
@@ -76,9 +109,10 @@ func (c *CheckoutController) AddItem() http.HandlerFunc {
 
 		if request.Code == "" {
 			responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Empty product code")
+			return
 		}
 
-		err = c.checkoutService.AddProduct(basketId, request.Code)
+		err = c.checkoutService.AddProduct(r.Context(), basketId, request.Code)
 		if err != nil {
 			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
 			return
@@ -88,6 +122,28 @@ func (c *CheckoutController) AddItem() http.HandlerFunc {
 	}
 }
 
+// RemoveItem handles requests to remove a unit of a product from a basket, its stock is released.
+// Http method: DELETE
+// Path parameters: basket id and product code
+// Return: no content if successful or a http error code otherwise.
+func (c *CheckoutController) RemoveItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+		productCode := pathParameters["code"]
+
+		err := c.checkoutService.RemoveProduct(r.Context(), basketId, model.ProductCode(productCode))
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusNoContent, nil)
+	}
+}
+
 // PostPayment handles requests to add a payment into the system. The new payment
 // will be linked to the organisation making the request.
 // Http method: POST
@@ -100,7 +156,7 @@ func (c *CheckoutController) GetPrice() http.HandlerFunc {
 		pathParameters := mux.Vars(r)
 		basketId := pathParameters["id"]
 
-		total, err := c.checkoutService.GetBasketPrice(basketId)
+		total, err := c.checkoutService.GetBasketPrice(r.Context(), basketId)
 		if err != nil {
 			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
 			return
@@ -109,6 +165,47 @@ func (c *CheckoutController) GetPrice() http.HandlerFunc {
 	}
 }
 
+// GetReceipt handles requests to get the receipt of a basket, with the taxes of the region query
+// parameter or the default region.
+// Http method: GET
+// Path parameter: basket id
+// Return: the net, the tax per rate and the gross of the basket if successful or a http error code otherwise.
+func (c *CheckoutController) GetReceipt() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		receipt, err := c.checkoutService.GetReceipt(r.Context(), basketId, r.URL.Query().Get("region"))
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		responses.Response(w, logger, http.StatusOK, responses.ToReceiptResponse(receipt))
+	}
+}
+
+// GetBasket handles requests to read the content of a basket.
+// Http method: GET
+// Path parameter: basket id
+// Return: the basket lines if successful or a http error code otherwise.
+func (c *CheckoutController) GetBasket() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		basket, err := c.checkoutService.GetBasket(r.Context(), basketId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		responses.Response(w, logger, http.StatusOK, responses.ToBasketResponse(basket))
+	}
+}
+
 // PostPayment handles requests to add a payment into the system. The new payment
 // will be linked to the organisation making the request.
 // Http method: POST
@@ -121,8 +218,89 @@ func (c *CheckoutController) DeleteBasket() http.HandlerFunc {
 		pathParameters := mux.Vars(r)
 		basketId := pathParameters["id"]
 
-		c.checkoutService.DeleteBasket(basketId)
+		c.checkoutService.DeleteBasket(r.Context(), basketId)
 
 		responses.Response(w, logger, http.StatusNoContent, nil)
 	}
 }
+
+// Checkout handles requests to check out a basket. The basket is closed, no more products can be
+// added to it, and an order with its content and price is placed.
+// Http method: POST
+// Path parameter: basket id
+// Return: the new order if successful or a http error code otherwise.
+func (c *CheckoutController) Checkout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		order, err := c.checkoutService.Checkout(r.Context(), basketId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		responses.Response(w, logger, http.StatusCreated, responses.ToOrderResponse(order))
+	}
+}
+
+// GetOrder handles requests to read an order.
+// Http method: GET
+// Path parameter: order id
+// Return: the order if successful or a http error code otherwise.
+func (c *CheckoutController) GetOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		orderId := pathParameters["id"]
+
+		order, err := c.checkoutService.GetOrder(r.Context(), orderId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		responses.Response(w, logger, http.StatusOK, responses.ToOrderResponse(order))
+	}
+}
+
+// PayOrder handles requests to take again the payment of an order whose payment failed.
+// Http method: POST
+// Path parameter: order id
+// Return: the order with its payment status if successful or a http error code otherwise.
+func (c *CheckoutController) PayOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		orderId := pathParameters["id"]
+
+		order, err := c.checkoutService.PayOrder(r.Context(), orderId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		responses.Response(w, logger, http.StatusOK, responses.ToOrderResponse(order))
+	}
+}
+
+// RefundOrder handles requests to refund the payment captured of an order.
+// Http method: POST
+// Path parameter: order id
+// Return: the order refunded if successful or a http error code otherwise.
+func (c *CheckoutController) RefundOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		orderId := pathParameters["id"]
+
+		order, err := c.checkoutService.RefundOrder(r.Context(), orderId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		responses.Response(w, logger, http.StatusOK, responses.ToOrderResponse(order))
+	}
+}
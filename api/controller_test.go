@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/alfcope/checkouttest/api/requests"
@@ -200,6 +201,8 @@ func (suite *CheckoutControllerTestSuite) TestAddProduct() {
 		mock.AnythingOfType("model.ProductCode")).Return(product, nil)
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
 		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock",
+		mock.AnythingOfType("string"), productCode).Return(nil)
 
 	// When
 	reqBodyBytes := new(bytes.Buffer)
@@ -324,3 +327,400 @@ func (suite *CheckoutControllerTestSuite) TestDeleteBasket() {
 	// Then
 	suite.Equal(http.StatusNoContent, rr.Code)
 }
+
+func (suite *CheckoutControllerTestSuite) TestGetBasket() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1000})
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1000})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var br = new(responses.BasketResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &br)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling basket response: %v", err)
+	}
+
+	suite.Equal(basketId, br.Id)
+	suite.Equal(1, len(br.Lines))
+	suite.Equal(2, br.Lines[0].Amount)
+}
+
+func (suite *CheckoutControllerTestSuite) TestErrorResponseCarriesRequestId() {
+	// Given
+	basketId := uuid.New().String()
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%v", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set(logging.RequestIdHeader, "req-1")
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.RequestIdMiddleware(logging.AccessLoggingMiddleware(suite.checkoutController.GetBasket()))
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+	suite.Equal("req-1", rr.Header().Get(logging.RequestIdHeader))
+
+	var errorResponse responses.ErrorResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+	suite.Nil(err)
+	suite.Equal("req-1", errorResponse.RequestId)
+	suite.NotEqual("", errorResponse.Error)
+}
+
+func (suite *CheckoutControllerTestSuite) TestCheckout() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1000})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.AnythingOfType("*model.Order")).Return(nil)
+
+	// When
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%s/checkout", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.Checkout())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusCreated, rr.Code)
+
+	var or = new(responses.OrderResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &or)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling order response: %v", err)
+	}
+
+	suite.NotEqual("", or.Id)
+	suite.Equal(basketId, or.BasketId)
+	suite.Equal(float64(10), or.Total)
+	suite.Equal(1, len(or.Lines))
+}
+
+func (suite *CheckoutControllerTestSuite) TestAddProductToClosedBasket() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	if _, err := basket.Checkout(context.Background(), nil); err != nil {
+		suite.T().Fatal(err)
+	}
+
+	var productCode model.ProductCode = "P1"
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(model.Product{Code: productCode, Name: "Prod 1", Price: 1000}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock",
+		mock.AnythingOfType("string"), productCode).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReleaseStock",
+		mock.AnythingOfType("string"), productCode).Return()
+
+	// When
+	reqBodyBytes := new(bytes.Buffer)
+	err := json.NewEncoder(reqBodyBytes).Encode(requests.AddItemRequest{Code: productCode})
+	if err != nil {
+		suite.T().Errorf("Error encoding request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/items/", basketId), bytes.NewBuffer(reqBodyBytes.Bytes()))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.AddItem())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusConflict, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestAddProductOutOfStock() {
+	// Given
+	basketId := uuid.New().String()
+	var productCode model.ProductCode = "P1"
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(model.Product{Code: productCode, Name: "Prod 1", Price: 1000}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock",
+		mock.AnythingOfType("string"), productCode).Return(errors.NewOutOfStock(string(productCode)))
+
+	// When
+	reqBodyBytes := new(bytes.Buffer)
+	err := json.NewEncoder(reqBodyBytes).Encode(requests.AddItemRequest{Code: productCode})
+	if err != nil {
+		suite.T().Errorf("Error encoding request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/items/", basketId), bytes.NewBuffer(reqBodyBytes.Bytes()))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.AddItem())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusConflict, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestCreateBasketCurrencyNotAccepted() {
+	// When
+	req, err := http.NewRequest("POST", "/baskets/?currency=jpy", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.CreateBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.Contains(rr.Body.String(), "JPY")
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddBasket", mock.AnythingOfType("*model.Basket"))
+}
+
+func (suite *CheckoutControllerTestSuite) TestAddProductWithoutPriceInCurrency() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	basket.Currency = "GBP"
+	var productCode model.ProductCode = "P1"
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(model.Product{Code: productCode, Name: "Prod 1", Price: 1000}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	reqBodyBytes := new(bytes.Buffer)
+	err := json.NewEncoder(reqBodyBytes).Encode(requests.AddItemRequest{Code: productCode})
+	if err != nil {
+		suite.T().Errorf("Error encoding request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/items/", basketId), bytes.NewBuffer(reqBodyBytes.Bytes()))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.AddItem())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.Contains(rr.Body.String(), "no price in GBP")
+}
+
+func (suite *CheckoutControllerTestSuite) TestRemoveItem() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	suite.Require().Nil(basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1000}))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReleaseStock", basketId, model.ProductCode("P1")).Return()
+
+	// When
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%s/items/P1", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": basketId, "code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.RemoveItem())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNoContent, rr.Code)
+	suite.Len(basket.GetLines(), 0)
+
+	// When the product is not in the basket
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetReceipt() {
+	// Given
+	basketId := uuid.New().String()
+	controller := NewCheckoutController(mux.NewRouter(), NewCheckoutService(suite.datasourceMock,
+		WithTaxes(model.TaxPolicy{Mode: model.TaxInclusive, DefaultRegion: "es",
+			Rates: map[string]model.TaxRates{"es": {model.StandardTax: 21}}})))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s/receipt?region=fr", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(controller.GetReceipt())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+
+	// When
+	req, err = http.NewRequest("GET", fmt.Sprintf("/baskets/%s/receipt", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+	var receipt responses.ReceiptResponse
+	suite.Nil(json.NewDecoder(rr.Body).Decode(&receipt))
+	suite.Equal("es", receipt.Region)
+	suite.Equal(model.TaxInclusive, receipt.Mode)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetReceiptTaxesDisabled() {
+	// Given
+	basketId := uuid.New().String()
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s/receipt", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetReceipt())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotImplemented, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetNonExistingOrder() {
+	// Given
+	orderId := uuid.New().String()
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder",
+		mock.AnythingOfType("string")).Return((*model.Order)(nil), errors.NewOrderNotFound(orderId))
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/orders/%s", orderId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetOrder())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestPayOrderPaymentsDisabled() {
+	// Given
+	orderId := uuid.New().String()
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", mock.AnythingOfType("string")).
+		Return(&model.Order{Id: orderId, Payment: model.Payment{Status: model.PaymentPending}}, nil)
+
+	// When
+	req, err := http.NewRequest("POST", fmt.Sprintf("/orders/%s/payment", orderId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.PayOrder())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotImplemented, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestRefundOrderNotCaptured() {
+	// Given
+	orderId := uuid.New().String()
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", mock.AnythingOfType("string")).
+		Return(&model.Order{Id: orderId, Payment: model.Payment{Status: model.PaymentPending}}, nil)
+
+	// When
+	req, err := http.NewRequest("POST", fmt.Sprintf("/orders/%s/refund", orderId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.RefundOrder())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusConflict, rr.Code)
+}
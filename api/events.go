@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/pubsub"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// LastEventIdHeader is sent by the clients reconnecting to the event stream
+	LastEventIdHeader = "Last-Event-ID"
+	// Time between the comments keeping the idle streams open through the proxies
+	eventsHeartbeat = 15 * time.Second
+	// Time allowed to write an event, the server write timeout does not apply to the streams
+	eventWriteTimeout = 10 * time.Second
+	// Time the clients wait before reconnecting
+	eventsRetry = 3 * time.Second
+)
+
+// BasketEvents handles requests to follow the changes of a basket as server-sent events. Every
+// event has the lines, the total and the promotions applied. The first event is the current
+// basket, or the events missed since the Last-Event-ID when the client reconnects.
+// Http method: GET
+// Path parameter: basket id
+// Return: an event stream if successful or a http error code otherwise.
+func (c *CheckoutController) BasketEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		var lastEventId uint64
+		if header := r.Header.Get(LastEventIdHeader); header != "" {
+			var err error
+			if lastEventId, err = strconv.ParseUint(header, 10, 64); err != nil {
+				responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Invalid "+LastEventIdHeader)
+				return
+			}
+		}
+
+		subscription, events, err := c.checkoutService.SubscribeBasket(r.Context(), basketId, lastEventId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		defer subscription.Close()
+
+		stream := &eventStream{w: w, controller: http.NewResponseController(w), basketId: basketId}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// Stops nginx from buffering the stream
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		if err := stream.write(fmt.Sprintf("retry: %d\n\n", eventsRetry/time.Millisecond)); err != nil {
+			logger.Debugf("Event stream closed: %v", err)
+			return
+		}
+		for _, event := range events {
+			if err := stream.send(event); err != nil {
+				logger.Debugf("Event stream closed: %v", err)
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(c.heartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case event, ok := <-subscription.Events():
+				// Closed when the basket is deleted, the server shuts down or the client falls
+				// behind, it reconnects with the last event id in that case
+				if !ok {
+					return
+				}
+				if err := stream.send(event); err != nil {
+					logger.Debugf("Event stream closed: %v", err)
+					return
+				}
+				if event.Type == BasketDeletedEvent {
+					return
+				}
+
+			case <-heartbeat.C:
+				if err := stream.write(": heartbeat\n\n"); err != nil {
+					logger.Debugf("Event stream closed: %v", err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// eventStream writes the server-sent events of a basket
+type eventStream struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	basketId   string
+}
+
+func (s *eventStream) send(event pubsub.Event) error {
+	var data interface{} = responses.NewBasketResponse{Id: s.basketId}
+	if price, ok := event.Data.(model.BasketPrice); ok {
+		data = responses.ToBasketEventResponse(s.basketId, price)
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return s.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, encoded))
+}
+
+func (s *eventStream) write(message string) error {
+	// Writers not supporting deadlines keep the server ones
+	_ = s.controller.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+
+	if _, err := io.WriteString(s.w, message); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type BasketEventsTestSuite struct {
+	suite.Suite
+
+	datasourceMock  *mocks.DatasourceMock
+	checkoutService CheckoutService
+	controller      *CheckoutController
+	server          *httptest.Server
+}
+
+// sseEvent is an event read from the stream, comments have only the comment set
+type sseEvent struct {
+	id      uint64
+	typ     string
+	data    string
+	comment string
+}
+
+func TestBasketEventsSuite(t *testing.T) {
+	suite.Run(t, new(BasketEventsTestSuite))
+}
+
+func (suite *BasketEventsTestSuite) SetupTest() {
+	router := mux.NewRouter()
+	apiRoute := router.PathPrefix("/api/v1").Subrouter().StrictSlash(true)
+
+	suite.datasourceMock = mocks.NewDatasourceMock()
+	suite.checkoutService = NewCheckoutService(suite.datasourceMock)
+	suite.controller = NewCheckoutController(apiRoute, suite.checkoutService)
+	suite.server = httptest.NewServer(router)
+}
+
+func (suite *BasketEventsTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *BasketEventsTestSuite) subscribe(basketId, lastEventId string) *http.Response {
+	req, err := http.NewRequest("GET", suite.server.URL+"/api/v1/baskets/"+basketId+"/events", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventId != "" {
+		req.Header.Set(LastEventIdHeader, lastEventId)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	return resp
+}
+
+// readEvent reads the next event or comment of the stream, skipping the retry field
+func readEvent(reader *bufio.Reader) (sseEvent, error) {
+	var event sseEvent
+	read := false
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return event, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if line == "" {
+			if read {
+				return event, nil
+			}
+			continue
+		}
+
+		field := strings.SplitN(line, ":", 2)
+		value := ""
+		if len(field) == 2 {
+			value = strings.TrimPrefix(field[1], " ")
+		}
+
+		switch field[0] {
+		case "":
+			event.comment = value
+			read = true
+		case "id":
+			event.id, _ = strconv.ParseUint(value, 10, 64)
+			read = true
+		case "event":
+			event.typ = value
+			read = true
+		case "data":
+			event.data = value
+			read = true
+		}
+	}
+}
+
+func (suite *BasketEventsTestSuite) nextEvent(reader *bufio.Reader) (sseEvent, responses.BasketEventResponse) {
+	events := make(chan sseEvent, 1)
+	go func() {
+		event, err := readEvent(reader)
+		if err != nil {
+			close(events)
+			return
+		}
+		events <- event
+	}()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			suite.T().Fatal("Event stream closed")
+		}
+
+		var data responses.BasketEventResponse
+		if event.data != "" {
+			suite.Nil(json.Unmarshal([]byte(event.data), &data))
+		}
+		return event, data
+	case <-time.After(2 * time.Second):
+		suite.T().Fatal("No event received")
+	}
+	return sseEvent{}, responses.BasketEventResponse{}
+}
+
+func (suite *BasketEventsTestSuite) TestEventsNonExistingBasket() {
+	// Given
+	suite.datasourceMock.On("GetBasket", "missing").Return(new(model.Basket), errors.NewBasketNotFound("missing"))
+
+	// When
+	resp := suite.subscribe("missing", "")
+	defer resp.Body.Close()
+
+	// Then
+	suite.Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *BasketEventsTestSuite) TestEventsInvalidLastEventId() {
+	// When
+	resp := suite.subscribe("basket-1", "not-a-number")
+	defer resp.Body.Close()
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func (suite *BasketEventsTestSuite) TestEventsOfBasketChanges() {
+	// Given
+	basket := model.NewBasket("basket-1")
+	suite.datasourceMock.On("GetBasket", "basket-1").Return(basket, nil)
+	suite.datasourceMock.On("GetProduct", model.ProductCode("VOUCHER")).
+		Return(model.Product{Code: "VOUCHER", Name: "Voucher", Price: 500}, nil)
+	suite.datasourceMock.On("ReserveStock", "basket-1", model.ProductCode("VOUCHER")).Return(nil)
+	suite.datasourceMock.On("GetPromotions").Return([]model.Promotion{
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"VOUCHER": {{Buy: 2, Free: 1}}})})
+	suite.datasourceMock.On("DeleteBasket", "basket-1").Return()
+
+	// When
+	resp := suite.subscribe("basket-1", "")
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	// Then
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	event, data := suite.nextEvent(reader)
+	suite.Equal(BasketSnapshotEvent, event.typ)
+	suite.Equal("basket-1", data.Id)
+	suite.Len(data.Lines, 0)
+
+	// When
+	for i := 0; i < 2; i++ {
+		suite.Nil(suite.checkoutService.AddProduct(context.Background(), "basket-1", "VOUCHER"))
+	}
+
+	// Then
+	event, data = suite.nextEvent(reader)
+	suite.Equal(BasketLinesEvent, event.typ)
+	suite.Equal(5.0, data.Total)
+
+	event, data = suite.nextEvent(reader)
+	suite.Equal(BasketLinesEvent, event.typ)
+	suite.Equal(5.0, data.Total)
+	suite.Len(data.Lines, 1)
+	suite.Equal(2, data.Lines[0].Amount)
+	suite.Len(data.Promotions, 1)
+	suite.Equal(model.PromotionType("FREE_ITEMS"), data.Promotions[0].Type)
+	suite.Equal(5.0, data.Promotions[0].Discount)
+
+	// When
+	_, err := suite.checkoutService.GetBasketPrice(context.Background(), "basket-1")
+
+	// Then
+	suite.Nil(err)
+	priceEvent, data := suite.nextEvent(reader)
+	suite.Equal(BasketPriceEvent, priceEvent.typ)
+	suite.True(priceEvent.id > event.id)
+	suite.Equal(5.0, data.Total)
+
+	// When
+	suite.checkoutService.DeleteBasket(context.Background(), "basket-1")
+
+	// Then
+	event, data = suite.nextEvent(reader)
+	suite.Equal(BasketDeletedEvent, event.typ)
+	suite.Equal("basket-1", data.Id)
+
+	_, err = readEvent(reader)
+	suite.NotNil(err, "Stream should end once the basket is deleted")
+}
+
+func (suite *BasketEventsTestSuite) TestEventsReplayedOnReconnect() {
+	// Given
+	basket := model.NewBasket("basket-1")
+	suite.datasourceMock.On("GetBasket", "basket-1").Return(basket, nil)
+	suite.datasourceMock.On("GetProduct", model.ProductCode("VOUCHER")).
+		Return(model.Product{Code: "VOUCHER", Name: "Voucher", Price: 500}, nil)
+	suite.datasourceMock.On("ReserveStock", "basket-1", model.ProductCode("VOUCHER")).Return(nil)
+	suite.datasourceMock.On("GetPromotions").Return([]model.Promotion{})
+
+	resp := suite.subscribe("basket-1", "")
+	snapshot, _ := suite.nextEvent(bufio.NewReader(resp.Body))
+	_ = resp.Body.Close()
+
+	suite.Nil(suite.checkoutService.AddProduct(context.Background(), "basket-1", "VOUCHER"))
+
+	// When
+	resp = suite.subscribe("basket-1", strconv.FormatUint(snapshot.id, 10))
+	defer resp.Body.Close()
+
+	// Then
+	event, data := suite.nextEvent(bufio.NewReader(resp.Body))
+	suite.Equal(BasketLinesEvent, event.typ)
+	suite.Equal(5.0, data.Total)
+}
+
+func (suite *BasketEventsTestSuite) TestEventsHeartbeat() {
+	// Given
+	suite.controller.heartbeat = 10 * time.Millisecond
+	suite.datasourceMock.On("GetBasket", "basket-1").Return(model.NewBasket("basket-1"), nil)
+	suite.datasourceMock.On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	resp := suite.subscribe("basket-1", "")
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	// Then
+	event, _ := suite.nextEvent(reader)
+	suite.Equal(BasketSnapshotEvent, event.typ)
+
+	event, _ = suite.nextEvent(reader)
+	suite.Equal("heartbeat", event.comment)
+}
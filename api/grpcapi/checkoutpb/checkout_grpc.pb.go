@@ -0,0 +1,245 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package checkoutpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CheckoutServiceClient is the client API for CheckoutService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CheckoutServiceClient interface {
+	CreateBasket(ctx context.Context, in *CreateBasketRequest, opts ...grpc.CallOption) (*CreateBasketResponse, error)
+	AddProduct(ctx context.Context, in *AddProductRequest, opts ...grpc.CallOption) (*AddProductResponse, error)
+	GetBasket(ctx context.Context, in *GetBasketRequest, opts ...grpc.CallOption) (*Basket, error)
+	GetBasketPrice(ctx context.Context, in *GetBasketPriceRequest, opts ...grpc.CallOption) (*GetBasketPriceResponse, error)
+	DeleteBasket(ctx context.Context, in *DeleteBasketRequest, opts ...grpc.CallOption) (*DeleteBasketResponse, error)
+}
+
+type checkoutServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCheckoutServiceClient(cc grpc.ClientConnInterface) CheckoutServiceClient {
+	return &checkoutServiceClient{cc}
+}
+
+func (c *checkoutServiceClient) CreateBasket(ctx context.Context, in *CreateBasketRequest, opts ...grpc.CallOption) (*CreateBasketResponse, error) {
+	out := new(CreateBasketResponse)
+	err := c.cc.Invoke(ctx, "/checkout.v1.CheckoutService/CreateBasket", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *checkoutServiceClient) AddProduct(ctx context.Context, in *AddProductRequest, opts ...grpc.CallOption) (*AddProductResponse, error) {
+	out := new(AddProductResponse)
+	err := c.cc.Invoke(ctx, "/checkout.v1.CheckoutService/AddProduct", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *checkoutServiceClient) GetBasket(ctx context.Context, in *GetBasketRequest, opts ...grpc.CallOption) (*Basket, error) {
+	out := new(Basket)
+	err := c.cc.Invoke(ctx, "/checkout.v1.CheckoutService/GetBasket", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *checkoutServiceClient) GetBasketPrice(ctx context.Context, in *GetBasketPriceRequest, opts ...grpc.CallOption) (*GetBasketPriceResponse, error) {
+	out := new(GetBasketPriceResponse)
+	err := c.cc.Invoke(ctx, "/checkout.v1.CheckoutService/GetBasketPrice", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *checkoutServiceClient) DeleteBasket(ctx context.Context, in *DeleteBasketRequest, opts ...grpc.CallOption) (*DeleteBasketResponse, error) {
+	out := new(DeleteBasketResponse)
+	err := c.cc.Invoke(ctx, "/checkout.v1.CheckoutService/DeleteBasket", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CheckoutServiceServer is the server API for CheckoutService service.
+// All implementations must embed UnimplementedCheckoutServiceServer
+// for forward compatibility
+type CheckoutServiceServer interface {
+	CreateBasket(context.Context, *CreateBasketRequest) (*CreateBasketResponse, error)
+	AddProduct(context.Context, *AddProductRequest) (*AddProductResponse, error)
+	GetBasket(context.Context, *GetBasketRequest) (*Basket, error)
+	GetBasketPrice(context.Context, *GetBasketPriceRequest) (*GetBasketPriceResponse, error)
+	DeleteBasket(context.Context, *DeleteBasketRequest) (*DeleteBasketResponse, error)
+	mustEmbedUnimplementedCheckoutServiceServer()
+}
+
+// UnimplementedCheckoutServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCheckoutServiceServer struct {
+}
+
+func (UnimplementedCheckoutServiceServer) CreateBasket(context.Context, *CreateBasketRequest) (*CreateBasketResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateBasket not implemented")
+}
+func (UnimplementedCheckoutServiceServer) AddProduct(context.Context, *AddProductRequest) (*AddProductResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddProduct not implemented")
+}
+func (UnimplementedCheckoutServiceServer) GetBasket(context.Context, *GetBasketRequest) (*Basket, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBasket not implemented")
+}
+func (UnimplementedCheckoutServiceServer) GetBasketPrice(context.Context, *GetBasketPriceRequest) (*GetBasketPriceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBasketPrice not implemented")
+}
+func (UnimplementedCheckoutServiceServer) DeleteBasket(context.Context, *DeleteBasketRequest) (*DeleteBasketResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteBasket not implemented")
+}
+func (UnimplementedCheckoutServiceServer) mustEmbedUnimplementedCheckoutServiceServer() {}
+
+// UnsafeCheckoutServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CheckoutServiceServer will
+// result in compilation errors.
+type UnsafeCheckoutServiceServer interface {
+	mustEmbedUnimplementedCheckoutServiceServer()
+}
+
+func RegisterCheckoutServiceServer(s grpc.ServiceRegistrar, srv CheckoutServiceServer) {
+	s.RegisterService(&CheckoutService_ServiceDesc, srv)
+}
+
+func _CheckoutService_CreateBasket_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateBasketRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CheckoutServiceServer).CreateBasket(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/checkout.v1.CheckoutService/CreateBasket",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CheckoutServiceServer).CreateBasket(ctx, req.(*CreateBasketRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CheckoutService_AddProduct_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddProductRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CheckoutServiceServer).AddProduct(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/checkout.v1.CheckoutService/AddProduct",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CheckoutServiceServer).AddProduct(ctx, req.(*AddProductRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CheckoutService_GetBasket_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBasketRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CheckoutServiceServer).GetBasket(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/checkout.v1.CheckoutService/GetBasket",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CheckoutServiceServer).GetBasket(ctx, req.(*GetBasketRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CheckoutService_GetBasketPrice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBasketPriceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CheckoutServiceServer).GetBasketPrice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/checkout.v1.CheckoutService/GetBasketPrice",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CheckoutServiceServer).GetBasketPrice(ctx, req.(*GetBasketPriceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CheckoutService_DeleteBasket_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBasketRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CheckoutServiceServer).DeleteBasket(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/checkout.v1.CheckoutService/DeleteBasket",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CheckoutServiceServer).DeleteBasket(ctx, req.(*DeleteBasketRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CheckoutService_ServiceDesc is the grpc.ServiceDesc for CheckoutService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CheckoutService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "checkout.v1.CheckoutService",
+	HandlerType: (*CheckoutServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateBasket",
+			Handler:    _CheckoutService_CreateBasket_Handler,
+		},
+		{
+			MethodName: "AddProduct",
+			Handler:    _CheckoutService_AddProduct_Handler,
+		},
+		{
+			MethodName: "GetBasket",
+			Handler:    _CheckoutService_GetBasket_Handler,
+		},
+		{
+			MethodName: "GetBasketPrice",
+			Handler:    _CheckoutService_GetBasketPrice_Handler,
+		},
+		{
+			MethodName: "DeleteBasket",
+			Handler:    _CheckoutService_DeleteBasket_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "checkout.proto",
+}
@@ -0,0 +1,4 @@
+// Package checkoutpb holds the protobuf messages and the gRPC service of the checkout api
+package checkoutpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative checkout.proto
@@ -0,0 +1,55 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+)
+
+// statusFromError maps a service error to the gRPC code matching the http status the REST api
+// answers. As in the REST api, the message of server errors is only logged.
+func statusFromError(ctx context.Context, err error) error {
+	code := CodeFromHttpStatus(responses.GetStatusByError(err))
+
+	if code == codes.Internal || code == codes.Unknown {
+		logging.GetLoggerWithContext(ctx).Error(err.Error())
+		return status.Error(code, http.StatusText(http.StatusInternalServerError))
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// CodeFromHttpStatus returns the gRPC code of an http status
+func CodeFromHttpStatus(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return codes.OK
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusRequestTimeout:
+		return codes.Canceled
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+
+	return codes.Unknown
+}
@@ -0,0 +1,114 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metadata keys, lower case as http2 header names
+const (
+	requestIdKey  = "x-request-id"
+	retryAfterKey = "retry-after"
+)
+
+// LoggingInterceptor accepts the x-request-id metadata sent by the caller, or generates it, puts it
+// on the context and logs an access entry per call
+func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now().UTC()
+
+	var requestId string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIdKey); len(values) > 0 {
+			requestId = values[0]
+		}
+	}
+	requestId = logging.RequestIdOrNew(requestId)
+
+	ctx = logging.WithTraceContext(logging.WithRequestId(ctx, requestId), logging.NewTraceContext())
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIdKey, requestId))
+
+	resp, err := handler(ctx, req)
+
+	fields := logrus.Fields{
+		"method":   info.FullMethod,
+		"code":     status.Code(err).String(),
+		"duration": float64(time.Now().UTC().Sub(start).Nanoseconds()) / 1e6,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["ip"] = p.Addr.String()
+	}
+	logging.GetLoggerWithContext(ctx).WithFields(fields).Info("access")
+
+	return resp, err
+}
+
+// AuthInterceptor authenticates the calls with the credentials of the REST api, sent as the
+// authorization or x-api-key metadata, and puts the principal on the context
+func AuthInterceptor(authenticator auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// The authenticators read http headers, metadata keys are header names
+		r := &http.Request{Header: make(http.Header)}
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			for key, values := range md {
+				for _, value := range values {
+					r.Header.Add(key, value)
+				}
+			}
+		}
+
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			logging.GetLoggerWithContext(ctx).WithField("reason", err.Error()).Info("Call not authenticated")
+			return nil, status.Error(codes.Unauthenticated, "Authentication required")
+		}
+
+		return handler(auth.WithPrincipal(ctx, principal), req)
+	}
+}
+
+// RateLimitInterceptor refuses with ResourceExhausted the calls of the clients exceeding the
+// limiter rate, the retry-after metadata has the seconds to wait. It goes after AuthInterceptor.
+func RateLimitInterceptor(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := clientKey(ctx)
+
+		allowed, retryAfter := limiter.Allow(key)
+		if !allowed {
+			logging.GetLoggerWithContext(ctx).WithField("client", key).Info("Rate limit exceeded")
+
+			seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+			_ = grpc.SetTrailer(ctx, metadata.Pairs(retryAfterKey, seconds))
+			return nil, status.Error(codes.ResourceExhausted, "Rate limit exceeded")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func clientKey(ctx context.Context) string {
+	if principal := auth.PrincipalFromContext(ctx); principal != nil {
+		return "principal:" + principal.Subject
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "ip:" + host
+	}
+	return "unknown"
+}
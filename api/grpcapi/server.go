@@ -0,0 +1,107 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/alfcope/checkouttest/api"
+	"github.com/alfcope/checkouttest/api/grpcapi/checkoutpb"
+	"github.com/alfcope/checkouttest/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// Server implements the gRPC CheckoutService on top of the service used by the REST api
+type Server struct {
+	checkoutpb.UnimplementedCheckoutServiceServer
+
+	service api.CheckoutService
+}
+
+func NewServer(service api.CheckoutService) *Server {
+	return &Server{service: service}
+}
+
+// NewGrpcServer creates a gRPC server with the CheckoutService registered. The interceptors run
+// after the logging one. Without a tls configuration the server is plaintext.
+func NewGrpcServer(service api.CheckoutService, tlsConfig *tls.Config, interceptors ...grpc.UnaryServerInterceptor) *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{LoggingInterceptor}, interceptors...)...),
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(options...)
+	checkoutpb.RegisterCheckoutServiceServer(server, NewServer(service))
+
+	return server
+}
+
+func (s *Server) CreateBasket(ctx context.Context, request *checkoutpb.CreateBasketRequest) (*checkoutpb.CreateBasketResponse, error) {
+	id, err := s.service.CreateBasket(ctx, model.Currency(strings.ToUpper(request.Currency)))
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	return &checkoutpb.CreateBasketResponse{Id: id}, nil
+}
+
+func (s *Server) AddProduct(ctx context.Context, request *checkoutpb.AddProductRequest) (*checkoutpb.AddProductResponse, error) {
+	if request.Code == "" {
+		return nil, status.Error(codes.InvalidArgument, "Empty product code")
+	}
+
+	if err := s.service.AddProduct(ctx, request.BasketId, model.ProductCode(request.Code)); err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	return &checkoutpb.AddProductResponse{}, nil
+}
+
+func (s *Server) GetBasket(ctx context.Context, request *checkoutpb.GetBasketRequest) (*checkoutpb.Basket, error) {
+	basket, err := s.service.GetBasket(ctx, request.BasketId)
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	lines := basket.GetLines()
+	response := &checkoutpb.Basket{
+		Id:       basket.Id,
+		Lines:    make([]*checkoutpb.Line, 0, len(lines)),
+		Currency: string(basket.Currency),
+	}
+	for _, l := range lines {
+		response.Lines = append(response.Lines, &checkoutpb.Line{
+			Code:   string(l.Code),
+			Name:   l.Name,
+			Price:  int32(l.Price),
+			Amount: int32(l.GetAmount()),
+		})
+	}
+
+	return response, nil
+}
+
+func (s *Server) GetBasketPrice(ctx context.Context, request *checkoutpb.GetBasketPriceRequest) (*checkoutpb.GetBasketPriceResponse, error) {
+	total, err := s.service.GetBasketPrice(ctx, request.BasketId)
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	// The price has no currency, it is the one of the basket, fixed when it is created
+	basket, err := s.service.GetBasket(ctx, request.BasketId)
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	return &checkoutpb.GetBasketPriceResponse{Total: total, Currency: string(basket.Currency)}, nil
+}
+
+func (s *Server) DeleteBasket(ctx context.Context, request *checkoutpb.DeleteBasketRequest) (*checkoutpb.DeleteBasketResponse, error) {
+	s.service.DeleteBasket(ctx, request.BasketId)
+
+	return &checkoutpb.DeleteBasketResponse{}, nil
+}
@@ -0,0 +1,280 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/api"
+	"github.com/alfcope/checkouttest/api/grpcapi/checkoutpb"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"testing"
+)
+
+const bufferSize = 1024 * 1024
+
+type GrpcServerTestSuite struct {
+	suite.Suite
+
+	datasourceMock *mocks.DatasourceMock
+	server         *grpc.Server
+	conn           *grpc.ClientConn
+	client         checkoutpb.CheckoutServiceClient
+}
+
+func TestGrpcServerSuite(t *testing.T) {
+	suite.Run(t, new(GrpcServerTestSuite))
+}
+
+func (suite *GrpcServerTestSuite) SetupSuite() {
+	suite.datasourceMock = mocks.NewDatasourceMock()
+	suite.server = NewGrpcServer(api.NewCheckoutService(suite.datasourceMock), nil)
+	suite.conn, suite.client = serveInMemory(suite.T(), suite.server)
+}
+
+func (suite *GrpcServerTestSuite) TearDownSuite() {
+	_ = suite.conn.Close()
+	suite.server.Stop()
+}
+
+func (suite *GrpcServerTestSuite) TearDownTest() {
+	suite.datasourceMock.ExpectedCalls = nil
+	suite.datasourceMock.Calls = nil
+}
+
+// serveInMemory serves the server on a bufconn listener and returns a client connected to it
+func serveInMemory(t *testing.T, server *grpc.Server) (*grpc.ClientConn, checkoutpb.CheckoutServiceClient) {
+	listener := bufconn.Listen(bufferSize)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return conn, checkoutpb.NewCheckoutServiceClient(conn)
+}
+
+func (suite *GrpcServerTestSuite) TestCreateBasket() {
+	// Given
+	suite.datasourceMock.On("AddBasket", mock.AnythingOfType("*model.Basket")).Return(nil)
+
+	// When
+	response, err := suite.client.CreateBasket(context.Background(), &checkoutpb.CreateBasketRequest{})
+
+	// Then
+	suite.Nil(err)
+	suite.NotEqual("", response.Id)
+}
+
+func (suite *GrpcServerTestSuite) TestAddProduct() {
+	// Given
+	basket := model.NewBasket("basket-1")
+	suite.datasourceMock.On("GetProduct", model.ProductCode("VOUCHER")).
+		Return(model.Product{Code: "VOUCHER", Name: "Voucher", Price: 500}, nil)
+	suite.datasourceMock.On("GetBasket", "basket-1").Return(basket, nil)
+	suite.datasourceMock.On("ReserveStock", "basket-1", model.ProductCode("VOUCHER")).Return(nil)
+
+	// When
+	_, err := suite.client.AddProduct(context.Background(), &checkoutpb.AddProductRequest{BasketId: "basket-1", Code: "VOUCHER"})
+
+	// Then
+	suite.Nil(err)
+	suite.Len(basket.GetLines(), 1)
+}
+
+func (suite *GrpcServerTestSuite) TestAddProductNotFound() {
+	// Given
+	suite.datasourceMock.On("GetProduct", model.ProductCode("MISSING")).
+		Return(model.Product{}, errors.NewProductNotFound("MISSING"))
+
+	// When
+	_, err := suite.client.AddProduct(context.Background(), &checkoutpb.AddProductRequest{BasketId: "basket-1", Code: "MISSING"})
+
+	// Then
+	suite.Equal(codes.NotFound, status.Code(err))
+}
+
+func (suite *GrpcServerTestSuite) TestAddProductEmptyCode() {
+	// When
+	_, err := suite.client.AddProduct(context.Background(), &checkoutpb.AddProductRequest{BasketId: "basket-1"})
+
+	// Then
+	suite.Equal(codes.InvalidArgument, status.Code(err))
+	suite.datasourceMock.AssertNotCalled(suite.T(), "GetProduct", mock.Anything)
+}
+
+func (suite *GrpcServerTestSuite) TestGetBasket() {
+	// Given
+	basket := model.NewBasket("basket-1")
+	_ = basket.AddProduct(model.Product{Code: "VOUCHER", Name: "Voucher", Price: 500})
+	_ = basket.AddProduct(model.Product{Code: "VOUCHER", Name: "Voucher", Price: 500})
+	suite.datasourceMock.On("GetBasket", "basket-1").Return(basket, nil)
+
+	// When
+	response, err := suite.client.GetBasket(context.Background(), &checkoutpb.GetBasketRequest{BasketId: "basket-1"})
+
+	// Then
+	suite.Nil(err)
+	suite.Equal("basket-1", response.Id)
+	suite.Len(response.Lines, 1)
+	suite.Equal("VOUCHER", response.Lines[0].Code)
+	suite.Equal(int32(500), response.Lines[0].Price)
+	suite.Equal(int32(2), response.Lines[0].Amount)
+}
+
+func (suite *GrpcServerTestSuite) TestGetBasketNotFound() {
+	// Given
+	suite.datasourceMock.On("GetBasket", "missing").Return(new(model.Basket), errors.NewBasketNotFound("missing"))
+
+	// When
+	_, err := suite.client.GetBasket(context.Background(), &checkoutpb.GetBasketRequest{BasketId: "missing"})
+
+	// Then
+	suite.Equal(codes.NotFound, status.Code(err))
+}
+
+func (suite *GrpcServerTestSuite) TestGetBasketPrice() {
+	// Given
+	basket := model.NewBasket("basket-1")
+	_ = basket.AddProduct(model.Product{Code: "VOUCHER", Name: "Voucher", Price: 500})
+	suite.datasourceMock.On("GetBasket", "basket-1").Return(basket, nil)
+	suite.datasourceMock.On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	response, err := suite.client.GetBasketPrice(context.Background(), &checkoutpb.GetBasketPriceRequest{BasketId: "basket-1"})
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(5.0, response.Total)
+}
+
+func (suite *GrpcServerTestSuite) TestDeleteBasket() {
+	// Given
+	suite.datasourceMock.On("DeleteBasket", "basket-1").Return()
+
+	// When
+	_, err := suite.client.DeleteBasket(context.Background(), &checkoutpb.DeleteBasketRequest{BasketId: "basket-1"})
+
+	// Then
+	suite.Nil(err)
+	suite.datasourceMock.AssertCalled(suite.T(), "DeleteBasket", "basket-1")
+}
+
+func TestBasketInCurrency(t *testing.T) {
+	datasourceMock := mocks.NewDatasourceMock()
+	var basket *model.Basket
+	datasourceMock.On("AddBasket", mock.AnythingOfType("*model.Basket")).
+		Run(func(args mock.Arguments) { basket = args.Get(0).(*model.Basket) }).Return(nil)
+
+	service := api.NewCheckoutService(datasourceMock,
+		api.WithCurrencies(model.Currencies{Base: "EUR", Accepted: []model.Currency{"GBP"}}))
+	server := NewGrpcServer(service, nil)
+	defer server.Stop()
+	conn, client := serveInMemory(t, server)
+	defer conn.Close()
+
+	// A basket in pounds
+	created, err := client.CreateBasket(context.Background(), &checkoutpb.CreateBasketRequest{Currency: "gbp"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	datasourceMock.On("GetBasket", created.Id).Return(basket, nil)
+	datasourceMock.On("GetProduct", model.ProductCode("VOUCHER")).Return(
+		model.Product{Code: "VOUCHER", Name: "Voucher", Price: 500, Prices: map[model.Currency]int{"GBP": 425}}, nil)
+	datasourceMock.On("ReserveStock", created.Id, model.ProductCode("VOUCHER")).Return(nil)
+	datasourceMock.On("GetPromotions").Return([]model.Promotion{})
+
+	if _, err = client.AddProduct(context.Background(), &checkoutpb.AddProductRequest{BasketId: created.Id, Code: "VOUCHER"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Its lines and its total are in pounds
+	response, err := client.GetBasket(context.Background(), &checkoutpb.GetBasketRequest{BasketId: created.Id})
+	if err != nil || response.Currency != "GBP" || response.Lines[0].Price != 425 {
+		t.Errorf("Wanted the basket in pounds, got %v %v", response, err)
+	}
+
+	price, err := client.GetBasketPrice(context.Background(), &checkoutpb.GetBasketPriceRequest{BasketId: created.Id})
+	if err != nil || price.Currency != "GBP" || price.Total != 4.25 {
+		t.Errorf("Wanted the total in pounds, got %v %v", price, err)
+	}
+
+	// The currencies not accepted are refused
+	_, err = client.CreateBasket(context.Background(), &checkoutpb.CreateBasketRequest{Currency: "JPY"})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("Wanted an invalid argument, got %v", code)
+	}
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	authenticator, err := auth.NewAPIKeyAuthenticator([]config.APIKeyConfig{{Key: "key-1", Subject: "till-1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	datasourceMock := mocks.NewDatasourceMock()
+	datasourceMock.On("AddBasket", mock.AnythingOfType("*model.Basket")).Return(nil)
+
+	server := NewGrpcServer(api.NewCheckoutService(datasourceMock), nil, AuthInterceptor(authenticator))
+	defer server.Stop()
+	conn, client := serveInMemory(t, server)
+	defer conn.Close()
+
+	for _, tc := range []struct {
+		name string
+		key  string
+		code codes.Code
+	}{
+		{"no credentials", "", codes.Unauthenticated},
+		{"invalid key", "key-2", codes.Unauthenticated},
+		{"valid key", "key-1", codes.OK},
+	} {
+		ctx := context.Background()
+		if tc.key != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, auth.APIKeyHeader, tc.key)
+		}
+
+		_, err := client.CreateBasket(ctx, &checkoutpb.CreateBasketRequest{})
+		if code := status.Code(err); code != tc.code {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.code, code)
+		}
+	}
+}
+
+func TestCodeFromHttpStatus(t *testing.T) {
+	for httpStatus, code := range map[int]codes.Code{
+		http.StatusOK:                  codes.OK,
+		http.StatusUnprocessableEntity: codes.InvalidArgument,
+		http.StatusUnauthorized:        codes.Unauthenticated,
+		http.StatusForbidden:           codes.PermissionDenied,
+		http.StatusNotFound:            codes.NotFound,
+		http.StatusRequestTimeout:      codes.Canceled,
+		http.StatusTooManyRequests:     codes.ResourceExhausted,
+		http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+		http.StatusInternalServerError: codes.Internal,
+		http.StatusNotImplemented:      codes.Unimplemented,
+		http.StatusTeapot:              codes.Unknown,
+	} {
+		if got := CodeFromHttpStatus(httpStatus); got != code {
+			t.Errorf("%d: expected %v, got %v", httpStatus, code, got)
+		}
+	}
+}
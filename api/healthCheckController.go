@@ -1,16 +1,168 @@
 package api
 
 import (
-	"github.com/etherlabsio/healthcheck"
+	"context"
+	"fmt"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/datasource"
 	"github.com/gorilla/mux"
+	"net/http"
+	"sync/atomic"
 	"time"
 )
 
-func AddHealthCheckRoute(router *mux.Router) {
+// Status of the health checks
+const (
+	StatusOk   = "ok"
+	StatusFail = "fail"
+)
+
+// Time given to every readiness check
+const checkTimeout = 2 * time.Second
+
+// HealthCheck is a named readiness check. It returns a detail shown in the response.
+type HealthCheck struct {
+	Name  string
+	Check func(context.Context) (string, error)
+}
+
+type CheckStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status           string        `json:"status"`
+	CatalogueVersion string        `json:"catalogueVersion,omitempty"`
+	Checks           []CheckStatus `json:"checks,omitempty"`
+}
+
+type HealthController struct {
+	ds       datasource.Datasource
+	checks   []HealthCheck
+	draining int32
+}
+
+// NewHealthController registers /livez and /readyz. Readiness checks the catalogue, the
+// datasource storage when it is external, and that the server is not draining.
+func NewHealthController(router *mux.Router, ds datasource.Datasource) *HealthController {
+	controller := &HealthController{ds: ds}
+
+	controller.checks = []HealthCheck{
+		{Name: "catalogue", Check: controller.checkCatalogue},
+		{Name: "datasource", Check: controller.checkDatasource},
+		{Name: "draining", Check: controller.checkDraining},
+	}
+
+	// swagger:route GET /livez health getLiveness
+	router.HandleFunc("/livez", controller.Liveness()).Methods("GET")
+	// swagger:route GET /readyz health getReadiness
+	router.HandleFunc("/readyz", controller.Readiness()).Methods("GET")
+
+	return controller
+}
+
+// SetDraining makes the readiness fail so no new traffic is routed to the server
+func (h *HealthController) SetDraining(draining bool) {
+	var value int32
+	if draining {
+		value = 1
+	}
+	atomic.StoreInt32(&h.draining, value)
+}
+
+func (h *HealthController) IsDraining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+// AddCheck adds a readiness check
+func (h *HealthController) AddCheck(check HealthCheck) {
+	h.checks = append(h.checks, check)
+}
+
+// Liveness only reports the process is able to serve requests
+func (h *HealthController) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responses.Response(w, nil, http.StatusOK, HealthResponse{Status: StatusOk})
+	}
+}
+
+// Readiness runs every check and reports their status. Any failing check makes it answer 503.
+func (h *HealthController) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := HealthResponse{
+			Status: StatusOk,
+			Checks: make([]CheckStatus, 0, len(h.checks)),
+		}
+
+		if catalogue, ok := h.ds.(datasource.Catalogue); ok {
+			response.CatalogueVersion = catalogue.CatalogueInfo().Version
+		}
+
+		for _, check := range h.checks {
+			status := runCheck(r.Context(), check)
+			if status.Status != StatusOk {
+				response.Status = StatusFail
+			}
+			response.Checks = append(response.Checks, status)
+		}
+
+		code := http.StatusOK
+		if response.Status != StatusOk {
+			code = http.StatusServiceUnavailable
+		}
+
+		responses.Response(w, nil, code, response)
+	}
+}
+
+func runCheck(ctx context.Context, check HealthCheck) CheckStatus {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	detail, err := check.Check(ctx)
+	if err != nil {
+		return CheckStatus{Name: check.Name, Status: StatusFail, Detail: detail, Error: err.Error()}
+	}
+
+	return CheckStatus{Name: check.Name, Status: StatusOk, Detail: detail}
+}
+
+func (h *HealthController) checkCatalogue(ctx context.Context) (string, error) {
+	catalogue, ok := h.ds.(datasource.Catalogue)
+	if !ok {
+		return "not reported by the datasource", nil
+	}
+
+	info := catalogue.CatalogueInfo()
+	detail := fmt.Sprintf("%d products, %d promotions", info.Products, info.Promotions)
+
+	if info.Products == 0 {
+		return detail, fmt.Errorf("no products loaded")
+	}
+
+	return detail, nil
+}
+
+func (h *HealthController) checkDatasource(ctx context.Context) (string, error) {
+	pinger, ok := h.ds.(datasource.Pinger)
+	if !ok {
+		return "in memory", nil
+	}
+
+	if err := pinger.Ping(ctx); err != nil {
+		return "", err
+	}
+
+	return "reachable", nil
+}
 
-	healthCheckRouter := router.PathPrefix("/healthcheck").Subrouter()
+func (h *HealthController) checkDraining(ctx context.Context) (string, error) {
+	if h.IsDraining() {
+		return "", fmt.Errorf("server is draining")
+	}
 
-	healthCheckRouter.Handle("/", healthcheck.Handler(
-		healthcheck.WithTimeout(2*time.Second),
-	))
+	return "", nil
 }
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	goerrors "errors"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// storageDatasource is a datasource reporting its catalogue and backed by an external storage
+type storageDatasource struct {
+	*mocks.DatasourceMock
+
+	info    datasource.CatalogueInfo
+	pingErr error
+}
+
+func (s *storageDatasource) CatalogueInfo() datasource.CatalogueInfo {
+	return s.info
+}
+
+func (s *storageDatasource) Ping(ctx context.Context) error {
+	return s.pingErr
+}
+
+type HealthControllerTestSuite struct {
+	suite.Suite
+
+	router     *mux.Router
+	controller *HealthController
+	ds         *storageDatasource
+}
+
+func TestHealthControllerSuite(t *testing.T) {
+	suite.Run(t, new(HealthControllerTestSuite))
+}
+
+func (suite *HealthControllerTestSuite) SetupTest() {
+	suite.ds = &storageDatasource{
+		DatasourceMock: mocks.NewDatasourceMock(),
+		info:           datasource.CatalogueInfo{Version: "abc123", Products: 3, Promotions: 2},
+	}
+	suite.router = mux.NewRouter()
+	suite.controller = NewHealthController(suite.router, suite.ds)
+}
+
+func (suite *HealthControllerTestSuite) readiness() (int, HealthResponse) {
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	var response HealthResponse
+	suite.Nil(json.Unmarshal(rr.Body.Bytes(), &response))
+
+	return rr.Code, response
+}
+
+func failedChecks(response HealthResponse) []string {
+	var failed []string
+	for _, check := range response.Checks {
+		if check.Status != StatusOk {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+func (suite *HealthControllerTestSuite) TestLiveness() {
+	// Given
+	suite.controller.SetDraining(true)
+
+	// When
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, httptest.NewRequest("GET", "/livez", nil))
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+}
+
+func (suite *HealthControllerTestSuite) TestReady() {
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	suite.Equal(http.StatusOK, code)
+	suite.Equal(StatusOk, response.Status)
+	suite.Equal("abc123", response.CatalogueVersion)
+	suite.Len(response.Checks, 3)
+	suite.Empty(failedChecks(response))
+}
+
+func (suite *HealthControllerTestSuite) TestNotReadyWithoutProducts() {
+	// Given
+	suite.ds.info.Products = 0
+
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	suite.Equal(http.StatusServiceUnavailable, code)
+	suite.Equal(StatusFail, response.Status)
+	suite.Equal([]string{"catalogue"}, failedChecks(response))
+}
+
+func (suite *HealthControllerTestSuite) TestNotReadyStorageUnreachable() {
+	// Given
+	suite.ds.pingErr = goerrors.New("connection refused")
+
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	suite.Equal(http.StatusServiceUnavailable, code)
+	suite.Equal([]string{"datasource"}, failedChecks(response))
+	suite.Equal("connection refused", response.Checks[1].Error)
+}
+
+func (suite *HealthControllerTestSuite) TestNotReadyWhileDraining() {
+	// Given
+	suite.controller.SetDraining(true)
+
+	// When
+	code, response := suite.readiness()
+
+	// Then
+	suite.Equal(http.StatusServiceUnavailable, code)
+	suite.Equal([]string{"draining"}, failedChecks(response))
+}
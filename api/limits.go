@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/ratelimit"
+	"github.com/gorilla/mux"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// BodyLimitMiddleware makes reading more than maxBytes of a request body fail with a validation
+// error, answered as 422 by the handlers
+func BodyLimitMiddleware(maxBytes int64) mux.MiddlewareFunc {
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				responses.ResponseError(w, logging.GetLoggerWithFields(r), http.StatusUnprocessableEntity,
+					bodyTooLarge(maxBytes).Error())
+				return
+			}
+
+			r.Body = &limitedBody{ReadCloser: r.Body, remaining: maxBytes, maxBytes: maxBytes}
+			nextHandler.ServeHTTP(w, r)
+		})
+	}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	maxBytes  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, bodyTooLarge(b.maxBytes)
+	}
+
+	// Read one byte over the limit to tell a body of exactly maxBytes from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), bodyTooLarge(b.maxBytes)
+	}
+	return n, err
+}
+
+func bodyTooLarge(maxBytes int64) error {
+	return errors.NewValidationError([]*errors.ValidationErrorDescription{
+		errors.NewValidationErrorDescription("body", fmt.Sprintf("Request body larger than %d bytes", maxBytes))})
+}
+
+// RateLimitMiddleware answers 429 with a Retry-After header to the clients exceeding the limiter
+// rate. Clients are told apart by their principal, or by their ip when authentication is
+// disabled, so it goes after AuthMiddleware.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) mux.MiddlewareFunc {
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := clientKey(r)
+
+			allowed, retryAfter := limiter.Allow(key)
+			if !allowed {
+				logger := logging.GetLoggerWithFields(r)
+				logger.WithField("client", key).Info("Rate limit exceeded")
+
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				responses.ResponseError(w, logger, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+
+			nextHandler.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientKey(r *http.Request) string {
+	if principal := auth.PrincipalFromContext(r.Context()); principal != nil {
+		return "principal:" + principal.Subject
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/requests"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/pkg/ratelimit"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type LimitsTestSuite struct {
+	suite.Suite
+}
+
+func TestLimitsSuite(t *testing.T) {
+	suite.Run(t, new(LimitsTestSuite))
+}
+
+func (suite *LimitsTestSuite) TestRateLimit() {
+	// Given
+	handler := RateLimitMiddleware(ratelimit.NewLimiter(1, 2))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/baskets/", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// When
+	suite.Equal(http.StatusNoContent, request("192.0.2.1:1000").Code)
+	suite.Equal(http.StatusNoContent, request("192.0.2.1:1001").Code)
+	rr := request("192.0.2.1:1002")
+
+	// Then
+	suite.Equal(http.StatusTooManyRequests, rr.Code)
+	suite.Equal("1", rr.Header().Get("Retry-After"))
+
+	// Other clients are not limited
+	suite.Equal(http.StatusNoContent, request("192.0.2.2:1000").Code)
+}
+
+func (suite *LimitsTestSuite) TestBodyLimit() {
+	// Given
+	handler := BodyLimitMiddleware(16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, err := requests.NewAddItemRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, nil, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		responses.Response(w, nil, http.StatusOK, request)
+	}))
+
+	bodies := map[string]int{
+		`{"code":"P1"}`:     http.StatusOK,
+		`{"code":"P1"}   `:  http.StatusOK,
+		`{"code":"P1"}    `: http.StatusUnprocessableEntity,
+		`{"code":"` + strings.Repeat("P", 64) + `"}`: http.StatusUnprocessableEntity,
+	}
+
+	for body, status := range bodies {
+		// When
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/baskets/id/items/", bytes.NewBufferString(body)))
+
+		// Then
+		suite.Equal(status, rr.Code, body)
+	}
+}
+
+func (suite *LimitsTestSuite) TestBodyLimitUnknownLength() {
+	// Given
+	handler := BodyLimitMiddleware(16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := requests.NewAddItemRequest(r.Body)
+		responses.ResponseError(w, nil, responses.GetStatusByError(err), err.Error())
+	}))
+
+	req := httptest.NewRequest("POST", "/baskets/id/items/", strings.NewReader(`{"code":"`+strings.Repeat("P", 64)+`"}`))
+	req.ContentLength = -1
+
+	// When
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+
+	var body responses.ErrorResponse
+	suite.Nil(json.Unmarshal(rr.Body.Bytes(), &body))
+	suite.Contains(body.Error, "larger than 16 bytes")
+}
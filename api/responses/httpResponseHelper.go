@@ -1,51 +1,282 @@
 package responses
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/payments"
+	"github.com/alfcope/checkouttest/pkg/logging"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"time"
 )
 
 type NewBasketResponse struct {
 	Id string `json:"id"`
 }
 
+type BasketResponse struct {
+	Id       string         `json:"id"`
+	Currency model.Currency `json:"currency,omitempty"`
+	Lines    []LineResponse `json:"lines"`
+}
+
+type LineResponse struct {
+	Code   model.ProductCode `json:"code"`
+	Name   string            `json:"name"`
+	Price  int               `json:"price"`
+	Amount int               `json:"amount"`
+}
+
+func ToBasketResponse(basket *model.Basket) BasketResponse {
+	return BasketResponse{
+		Id:       basket.Id,
+		Currency: basket.Currency,
+		Lines:    toLineResponses(basket.GetLines()),
+	}
+}
+
+func toLineResponses(lines []model.Line) []LineResponse {
+	response := make([]LineResponse, 0, len(lines))
+
+	for _, l := range lines {
+		response = append(response, LineResponse{
+			Code:   l.Code,
+			Name:   l.Name,
+			Price:  l.Price,
+			Amount: l.GetAmount(),
+		})
+	}
+
+	return response
+}
+
+// BasketEventResponse is the data of the basket events, but the deleted one
+type BasketEventResponse struct {
+	Id         string                     `json:"id"`
+	Lines      []LineResponse             `json:"lines"`
+	Total      float64                    `json:"total"`
+	Currency   model.Currency             `json:"currency,omitempty"`
+	Promotions []AppliedPromotionResponse `json:"promotions"`
+}
+
+type AppliedPromotionResponse struct {
+	Type     model.PromotionType `json:"type"`
+	Discount float64             `json:"discount"`
+}
+
+func ToBasketEventResponse(id string, price model.BasketPrice) BasketEventResponse {
+	response := BasketEventResponse{
+		Id:         id,
+		Lines:      toLineResponses(price.Lines),
+		Total:      price.Total,
+		Currency:   price.Currency,
+		Promotions: toPromotionResponses(price.Promotions),
+	}
+
+	return response
+}
+
+func toPromotionResponses(promotions []model.AppliedPromotion) []AppliedPromotionResponse {
+	response := make([]AppliedPromotionResponse, 0, len(promotions))
+
+	for _, p := range promotions {
+		response = append(response, AppliedPromotionResponse{
+			Type:     p.Type,
+			Discount: p.Discount,
+		})
+	}
+
+	return response
+}
+
+type OrderResponse struct {
+	Id         string                     `json:"id"`
+	BasketId   string                     `json:"basketId"`
+	Lines      []LineResponse             `json:"lines"`
+	Promotions []AppliedPromotionResponse `json:"promotions"`
+	Total      float64                    `json:"total"`
+	Currency   model.Currency             `json:"currency,omitempty"`
+	Receipt    *ReceiptResponse           `json:"receipt,omitempty"`
+	CreatedAt  time.Time                  `json:"createdAt"`
+	Payment    PaymentResponse            `json:"payment"`
+}
+
+type PaymentResponse struct {
+	Status        model.PaymentStatus `json:"status"`
+	FailureReason string              `json:"failureReason,omitempty"`
+	UpdatedAt     time.Time           `json:"updatedAt"`
+}
+
+func ToOrderResponse(order *model.Order) OrderResponse {
+	response := OrderResponse{
+		Id:         order.Id,
+		BasketId:   order.BasketId,
+		Lines:      make([]LineResponse, 0, len(order.Lines)),
+		Promotions: toPromotionResponses(order.Promotions),
+		Total:      order.Total,
+		Currency:   order.Currency,
+		CreatedAt:  order.CreatedAt,
+		Payment: PaymentResponse{
+			Status:        order.Payment.Status,
+			FailureReason: order.Payment.FailureReason,
+			UpdatedAt:     order.Payment.UpdatedAt,
+		},
+	}
+
+	if order.Receipt != nil {
+		receipt := ToReceiptResponse(*order.Receipt)
+		response.Receipt = &receipt
+	}
+	for _, l := range order.Lines {
+		response.Lines = append(response.Lines, LineResponse{
+			Code:   l.Code,
+			Name:   l.Name,
+			Price:  l.Price,
+			Amount: l.Amount,
+		})
+	}
+
+	return response
+}
+
+// ReceiptResponse splits the price of a basket into its net, its tax per rate and its gross
+type ReceiptResponse struct {
+	Region   string                `json:"region"`
+	Mode     model.PricingMode     `json:"pricing"`
+	Currency model.Currency        `json:"currency,omitempty"`
+	Lines    []ReceiptLineResponse `json:"lines"`
+	Taxes    []TaxLineResponse     `json:"taxes"`
+	Net      float64               `json:"net"`
+	Tax      float64               `json:"tax"`
+	Gross    float64               `json:"gross"`
+}
+
+type ReceiptLineResponse struct {
+	Code     model.ProductCode `json:"code"`
+	Name     string            `json:"name"`
+	Price    int               `json:"price"`
+	Amount   int               `json:"amount"`
+	Discount float64           `json:"discount"`
+	Total    float64           `json:"total"`
+	Category model.TaxCategory `json:"taxCategory"`
+	Rate     float64           `json:"taxRate"`
+}
+
+type TaxLineResponse struct {
+	Rate float64 `json:"rate"`
+	Net  float64 `json:"net"`
+	Tax  float64 `json:"tax"`
+}
+
+func ToReceiptResponse(receipt model.Receipt) ReceiptResponse {
+	response := ReceiptResponse{
+		Region:   receipt.Region,
+		Mode:     receipt.Mode,
+		Currency: receipt.Currency,
+		Lines:    make([]ReceiptLineResponse, 0, len(receipt.Lines)),
+		Taxes:    make([]TaxLineResponse, 0, len(receipt.Taxes)),
+		Net:      receipt.Net,
+		Tax:      receipt.Tax,
+		Gross:    receipt.Gross,
+	}
+
+	for _, l := range receipt.Lines {
+		response.Lines = append(response.Lines, ReceiptLineResponse{
+			Code:     l.Code,
+			Name:     l.Name,
+			Price:    l.Price,
+			Amount:   l.Amount,
+			Discount: l.Discount,
+			Total:    l.Total,
+			Category: l.Category,
+			Rate:     l.Rate,
+		})
+	}
+	for _, t := range receipt.Taxes {
+		response.Taxes = append(response.Taxes, TaxLineResponse{
+			Rate: t.Rate,
+			Net:  t.Net,
+			Tax:  t.Tax,
+		})
+	}
+
+	return response
+}
+
 type PriceBasketResponse struct {
 	Total float64 `json:"total"`
 }
 
-// Sends a response error
+// ErrorResponse is the body of the error responses
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	RequestId string `json:"requestId,omitempty"`
+}
+
+// Sends a response error. The message of server errors is only logged, the caller gets the
+// status text and the request id to report the failure.
 func ResponseError(w http.ResponseWriter, log *logrus.Entry, status int, msg string) {
 	if log != nil && msg != "" {
 		log.Error(msg)
 	}
 
+	if msg == "" || status >= http.StatusInternalServerError {
+		msg = http.StatusText(status)
+	}
+
+	body, err := json.Marshal(ErrorResponse{Error: msg, RequestId: w.Header().Get(logging.RequestIdHeader)})
+	if err != nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
+	_, _ = w.Write(body)
 }
 
 func Response(w http.ResponseWriter, log *logrus.Entry, status int, payload interface{}) {
-	w.WriteHeader(status)
+	if payload == nil {
+		w.WriteHeader(status)
+		return
+	}
 
-	if payload != nil {
-		w.Header().Set("Content-Type", "application/json")
-		jsonEncoded, err := json.Marshal(payload)
+	jsonEncoded, err := json.Marshal(payload)
+	if err != nil {
+		ResponseError(w, log, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-		if err != nil {
-			ResponseError(w, log, http.StatusInternalServerError, err.Error())
-		}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 
-		_, err = w.Write(jsonEncoded)
-		if err != nil {
-			ResponseError(w, log, http.StatusInternalServerError, err.Error())
-		}
+	_, err = w.Write(jsonEncoded)
+	if err != nil && log != nil {
+		log.Error(err.Error())
 	}
 }
 
 func GetStatusByError(err error) int {
 	switch err.(type) {
-	case *errors.BasketNotFound, *errors.ProductNotFound, *errors.PromotionNotFound:
+	case *errors.BasketNotFound, *errors.ProductNotFound, *errors.PromotionNotFound, *errors.OrderNotFound:
 		return http.StatusNotFound
+	case *errors.BasketClosed, *errors.PaymentStateError, *errors.OutOfStock:
+		return http.StatusConflict
+	case *errors.ValidationError, *errors.PriceNotFound, *errors.TaxRateNotFound:
+		return http.StatusUnprocessableEntity
+	case *payments.DeclinedError:
+		return http.StatusPaymentRequired
+	case *errors.FeatureDisabled:
+		return http.StatusNotImplemented
+	}
+
+	switch err {
+	case context.DeadlineExceeded, payments.ErrTimeout:
+		return http.StatusGatewayTimeout
+	case context.Canceled:
+		return http.StatusRequestTimeout
 	}
 
 	return http.StatusInternalServerError
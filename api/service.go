@@ -1,69 +1,735 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"github.com/alfcope/checkouttest/api/responses"
 	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/payments"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/metrics"
+	"github.com/alfcope/checkouttest/pkg/pubsub"
+	"github.com/alfcope/checkouttest/pkg/tracing"
+	"github.com/alfcope/checkouttest/pkg/webhooks"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"math"
+	"time"
+)
+
+// Types of the basket events, the data of every event is the model.BasketPrice of the basket but
+// for the deleted one which has none
+const (
+	// BasketSnapshotEvent gives the current basket to the subscribers that can't get the events
+	// they missed
+	BasketSnapshotEvent = "basket"
+	BasketLinesEvent    = "lines"
+	BasketPriceEvent    = "price"
+	// BasketClosedEvent has the price of the basket checked out
+	BasketClosedEvent  = "closed"
+	BasketDeletedEvent = "deleted"
 )
 
 type checkoutService struct {
-	ds datasource.Datasource
+	ds           datasource.Datasource
+	basketLimits model.BasketLimits
+	events       *pubsub.Broker
+	webhooks     *webhooks.Dispatcher
+
+	payments payments.PaymentGateway
+	// Time allowed to every call to the payment gateway
+	paymentTimeout time.Duration
+
+	// taxes is nil when the receipts are not calculated
+	taxes *model.TaxPolicy
+
+	currencies model.Currencies
+}
+
+// ServiceOption configures the checkout service
+type ServiceOption func(*checkoutService)
+
+// WithBasketLimits bounds the content of the baskets created by the service
+func WithBasketLimits(limits model.BasketLimits) ServiceOption {
+	return func(c *checkoutService) {
+		c.basketLimits = limits
+	}
+}
+
+// WithEventBroker publishes the basket events on the broker, the service creates its own otherwise
+func WithEventBroker(broker *pubsub.Broker) ServiceOption {
+	return func(c *checkoutService) {
+		c.events = broker
+	}
+}
+
+// WithWebhooks sends the basket lifecycle events to the webhooks of the dispatcher
+func WithWebhooks(dispatcher *webhooks.Dispatcher) ServiceOption {
+	return func(c *checkoutService) {
+		c.webhooks = dispatcher
+	}
+}
+
+// WithPaymentGateway takes the payment of the orders through the gateway, every call bounded by
+// the timeout. The orders stay pending without a gateway.
+func WithPaymentGateway(gateway payments.PaymentGateway, timeout time.Duration) ServiceOption {
+	return func(c *checkoutService) {
+		c.payments = gateway
+		c.paymentTimeout = timeout
+	}
+}
+
+// WithTaxes calculates the receipts of the baskets with the policy, the orders placed keep theirs
+func WithTaxes(policy model.TaxPolicy) ServiceOption {
+	return func(c *checkoutService) {
+		c.taxes = &policy
+	}
+}
+
+// WithCurrencies prices the baskets in the currencies, only the base one is accepted otherwise
+func WithCurrencies(currencies model.Currencies) ServiceOption {
+	return func(c *checkoutService) {
+		c.currencies = currencies
+	}
 }
 
 type CheckoutService interface {
-	CreateBasket() (string, error)
-	AddProduct(string, model.ProductCode) error
-	GetBasketPrice(string) (float64, error)
-	DeleteBasket(string)
+	// CreateBasket creates a basket priced in the currency, the base one when empty
+	CreateBasket(ctx context.Context, currency model.Currency) (string, error)
+	AddProduct(context.Context, string, model.ProductCode) error
+	// RemoveProduct removes a unit of the product from the basket
+	RemoveProduct(context.Context, string, model.ProductCode) error
+	GetBasket(context.Context, string) (*model.Basket, error)
+	GetBasketPrice(context.Context, string) (float64, error)
+	// GetReceipt returns the receipt of the basket with the taxes of the region, the default one
+	// when empty
+	GetReceipt(ctx context.Context, id string, region string) (model.Receipt, error)
+	DeleteBasket(context.Context, string)
+	// ExpireBaskets deletes the baskets not changed for longer than the ttl and returns how many
+	ExpireBaskets(ctx context.Context, ttl time.Duration) int
+	// SubscribeBasket subscribes to the events of a basket published after the lastEventId, the
+	// ones already published are returned
+	SubscribeBasket(context.Context, string, uint64) (*pubsub.Subscription, []pubsub.Event, error)
+	// Checkout closes the basket, places the order of its content and takes its payment. A
+	// payment failure does not fail the checkout, it is the payment status of the order.
+	Checkout(context.Context, string) (*model.Order, error)
+	GetOrder(context.Context, string) (*model.Order, error)
+	// PayOrder takes again the payment of an order whose payment failed
+	PayOrder(context.Context, string) (*model.Order, error)
+	RefundOrder(context.Context, string) (*model.Order, error)
 }
 
-func NewCheckoutService(ds datasource.Datasource) CheckoutService {
-	return &checkoutService{
-		ds: ds,
+func NewCheckoutService(ds datasource.Datasource, options ...ServiceOption) CheckoutService {
+	service := &checkoutService{
+		ds:     ds,
+		events: pubsub.NewBroker(),
 	}
+
+	for _, option := range options {
+		option(service)
+	}
+
+	return service
 }
 
-func (c *checkoutService) CreateBasket() (string, error) {
+func (c *checkoutService) CreateBasket(ctx context.Context, currency model.Currency) (_ string, err error) {
 	//TODO: unlikely hash collision could happen!! Use distributed id generator
 	id := uuid.New().String()
 
+	ctx, span := tracing.Start(ctx, "CheckoutService.CreateBasket", tracing.BasketIdKey.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	if currency == "" {
+		currency = c.currencies.Base
+	}
+	if !c.currencies.Accepts(currency) {
+		return "", errors.NewValidationError([]*errors.ValidationErrorDescription{
+			errors.NewValidationErrorDescription("currency", fmt.Sprintf("Currency %v not accepted", currency))})
+	}
+
 	basket := model.NewBasket(id)
+	basket.Limits = c.basketLimits
+	basket.Currency = currency
+	if principal := auth.PrincipalFromContext(ctx); principal != nil {
+		basket.Owner = principal.Owner()
+	}
 
-	err := c.ds.AddBasket(basket)
+	err = c.ds.AddBasket(ctx, basket)
 	if err != nil {
 		return "", err
 	}
 
+	c.notify(webhooks.BasketCreated, func() interface{} { return responses.NewBasketResponse{Id: id} })
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"basketId": id,
+		"currency": currency,
+	}).Debug("Basket created")
 	return id, nil
 }
 
-func (c *checkoutService) AddProduct(id string, pCode model.ProductCode) error {
+func (c *checkoutService) AddProduct(ctx context.Context, id string, pCode model.ProductCode) (err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.AddProduct",
+		tracing.BasketIdKey.String(id), tracing.ProductCodeKey.String(string(pCode)))
+	defer func() { tracing.End(span, err) }()
+
+	p, err := c.ds.GetProduct(ctx, pCode)
+	if err != nil {
+		return err
+	}
 
-	p, err := c.ds.GetProduct(pCode)
+	basket, err := c.getOwnedBasket(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	basket, err := c.ds.GetBasket(id)
+	p, err = p.PricedIn(basket.Currency, c.currencies)
 	if err != nil {
 		return err
 	}
 
-	return basket.AddProduct(p)
+	// Do not change the basket once the caller has gone away
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if err = c.ds.ReserveStock(ctx, id, pCode); err != nil {
+		return err
+	}
+	if err = basket.AddProduct(p); err != nil {
+		c.ds.ReleaseStock(ctx, id, pCode)
+		return err
+	}
+
+	c.events.Publish(id, BasketLinesEvent, func() interface{} {
+		return basket.Price(ctx, c.promotions(ctx, basket))
+	})
+	c.notify(webhooks.BasketChanged, func() interface{} { return responses.ToBasketResponse(basket) })
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"basketId":    id,
+		"productCode": pCode,
+	}).Debug("Product added")
+	return nil
 }
 
-func (c *checkoutService) GetBasketPrice(id string) (float64, error) {
+func (c *checkoutService) RemoveProduct(ctx context.Context, id string, pCode model.ProductCode) (err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.RemoveProduct",
+		tracing.BasketIdKey.String(id), tracing.ProductCodeKey.String(string(pCode)))
+	defer func() { tracing.End(span, err) }()
 
-	basket, err := c.ds.GetBasket(id)
+	basket, err := c.getOwnedBasket(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Do not change the basket once the caller has gone away
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if err = basket.RemoveProduct(pCode); err != nil {
+		return err
+	}
+	c.ds.ReleaseStock(ctx, id, pCode)
+
+	c.events.Publish(id, BasketLinesEvent, func() interface{} {
+		return basket.Price(ctx, c.promotions(ctx, basket))
+	})
+	c.notify(webhooks.BasketChanged, func() interface{} { return responses.ToBasketResponse(basket) })
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"basketId":    id,
+		"productCode": pCode,
+	}).Debug("Product removed")
+	return nil
+}
+
+func (c *checkoutService) GetBasket(ctx context.Context, id string) (_ *model.Basket, err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.GetBasket", tracing.BasketIdKey.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	return c.getOwnedBasket(ctx, id)
+}
+
+func (c *checkoutService) GetBasketPrice(ctx context.Context, id string) (_ float64, err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.GetBasketPrice", tracing.BasketIdKey.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	basket, err := c.getOwnedBasket(ctx, id)
 	if err != nil {
 		return 0, err
 	}
 
-	promotions := c.ds.GetPromotions()
+	promotions := c.promotions(ctx, basket)
+
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// Priced while publishing when the basket is watched, so the event follows the order of the changes
+	var price model.BasketPrice
+	if _, published := c.events.Publish(id, BasketPriceEvent, func() interface{} {
+		price = basket.Price(ctx, promotions)
+		return price
+	}); !published {
+		price = basket.Price(ctx, promotions)
+	}
+	c.recordPromotions(price)
+	c.notify(webhooks.BasketPriced, func() interface{} { return responses.ToBasketEventResponse(id, price) })
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"basketId": id,
+		"total":    price.Total,
+	}).Debug("Basket priced")
+	return price.Total, nil
+}
+
+func (c *checkoutService) GetReceipt(ctx context.Context, id string, region string) (_ model.Receipt, err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.GetReceipt", tracing.BasketIdKey.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	if c.taxes == nil {
+		return model.Receipt{}, errors.NewFeatureDisabled("Taxes")
+	}
+
+	basket, err := c.getOwnedBasket(ctx, id)
+	if err != nil {
+		return model.Receipt{}, err
+	}
+
+	promotions := c.promotions(ctx, basket)
+
+	if err = ctx.Err(); err != nil {
+		return model.Receipt{}, err
+	}
+
+	receipt, err := c.taxes.Receipt(basket.Price(ctx, promotions), region)
+	if err != nil {
+		return model.Receipt{}, err
+	}
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"basketId": id,
+		"region":   receipt.Region,
+		"gross":    receipt.Gross,
+	}).Debug("Basket receipt")
+	return receipt, nil
+}
+
+func (c *checkoutService) DeleteBasket(ctx context.Context, id string) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.DeleteBasket", tracing.BasketIdKey.String(id))
+	defer span.End()
+
+	// Baskets of other owners are left untouched, deleting is idempotent so it is not reported
+	if auth.PrincipalFromContext(ctx) != nil {
+		if _, err := c.getOwnedBasket(ctx, id); err != nil {
+			return
+		}
+	}
+
+	c.deleteBasket(ctx, id)
+}
+
+func (c *checkoutService) ExpireBaskets(ctx context.Context, ttl time.Duration) int {
+	ctx, span := tracing.Start(ctx, "CheckoutService.ExpireBaskets")
+	defer span.End()
+
+	updatedBefore := time.Now().Add(-ttl)
+
+	expired := 0
+	for _, id := range c.ds.GetExpiredBaskets(ctx, updatedBefore) {
+		// The basket could have changed since it was listed
+		basket, err := c.ds.GetBasket(ctx, id)
+		if err != nil || !basket.UpdatedAt().Before(updatedBefore) {
+			continue
+		}
+
+		c.deleteBasket(ctx, id)
+		expired++
+	}
+
+	if expired > 0 {
+		logging.GetLoggerWithContext(ctx).WithField("baskets", expired).Info("Baskets expired")
+	}
+	return expired
+}
+
+// deleteBasket deletes the basket, releasing its stock, and tells its watchers
+func (c *checkoutService) deleteBasket(ctx context.Context, id string) {
+	c.ds.DeleteBasket(ctx, id)
+
+	c.events.Publish(id, BasketDeletedEvent, func() interface{} { return nil })
+	c.events.CloseTopic(id)
+	c.notify(webhooks.BasketDeleted, func() interface{} { return responses.NewBasketResponse{Id: id} })
+}
+
+func (c *checkoutService) SubscribeBasket(ctx context.Context, id string, lastEventId uint64) (_ *pubsub.Subscription, _ []pubsub.Event, err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.SubscribeBasket", tracing.BasketIdKey.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	basket, err := c.getOwnedBasket(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subscription, missed, complete := c.events.Subscribe(id, lastEventId)
+	if !complete {
+		// Taken after subscribing so no change is lost, the subscriber may get it twice
+		missed = []pubsub.Event{{
+			Id:   subscription.Since(),
+			Type: BasketSnapshotEvent,
+			Data: basket.Price(ctx, c.promotions(ctx, basket)),
+		}}
+	}
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"basketId":    id,
+		"lastEventId": lastEventId,
+		"replayed":    complete,
+	}).Debug("Basket subscribed")
+	return subscription, missed, nil
+}
+
+func (c *checkoutService) Checkout(ctx context.Context, basketId string) (_ *model.Order, err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.Checkout", tracing.BasketIdKey.String(basketId))
+	defer func() { tracing.End(span, err) }()
+
+	basket, err := c.getOwnedBasket(ctx, basketId)
+	if err != nil {
+		return nil, err
+	}
+
+	promotions := c.promotions(ctx, basket)
+
+	// Do not close the basket once the caller has gone away
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	price, err := basket.Checkout(ctx, promotions)
+	if err != nil {
+		return nil, err
+	}
+
+	order := model.NewOrder(uuid.New().String(), basket, price, time.Now().UTC())
+	if c.taxes != nil {
+		receipt, taxErr := c.taxes.Receipt(price, "")
+		if taxErr != nil {
+			basket.Reopen()
+			return nil, taxErr
+		}
+		// The gross is charged, over the catalogue prices when they do not include the tax
+		order.Receipt = &receipt
+		order.Total = receipt.Gross
+	}
+
+	if err = c.ds.AddOrder(ctx, order); err != nil {
+		basket.Reopen()
+		return nil, err
+	}
+	span.SetAttributes(tracing.OrderIdKey.String(order.Id))
+	c.recordPromotions(price)
+
+	// The basket can't change any more, its watchers get the final price
+	c.events.Publish(basketId, BasketClosedEvent, func() interface{} { return price })
 
-	return basket.CalculatePrice(promotions), nil
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"basketId": basketId,
+		"orderId":  order.Id,
+		"total":    order.Total,
+	}).Info("Order placed")
+
+	if paid, payErr := c.pay(ctx, order); payErr != nil {
+		// The order is placed, its payment can be taken again
+		logging.GetLoggerWithContext(ctx).WithField("orderId", order.Id).Errorf("Error taking the payment: %v", payErr)
+	} else {
+		order = paid
+	}
+
+	c.notify(webhooks.OrderPlaced, func() interface{} { return responses.ToOrderResponse(order) })
+	return order, nil
 }
 
-func (c *checkoutService) DeleteBasket(id string) {
-	c.ds.DeleteBasket(id)
+func (c *checkoutService) GetOrder(ctx context.Context, id string) (_ *model.Order, err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.GetOrder", tracing.OrderIdKey.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	return c.getOwnedOrder(ctx, id)
+}
+
+func (c *checkoutService) PayOrder(ctx context.Context, id string) (_ *model.Order, err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.PayOrder", tracing.OrderIdKey.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	order, err := c.getOwnedOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.payments == nil {
+		return nil, errors.NewFeatureDisabled("Payments")
+	}
+
+	if order.Payment.Status == model.PaymentFailed {
+		order, err = c.updatePayment(ctx, order, model.Payment{Status: model.PaymentPending})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if order.Payment.Status != model.PaymentPending {
+		return nil, errors.NewPaymentStateError(id, string(order.Payment.Status), string(model.PaymentAuthorized))
+	}
+
+	return c.pay(ctx, order)
+}
+
+func (c *checkoutService) RefundOrder(ctx context.Context, id string) (_ *model.Order, err error) {
+	ctx, span := tracing.Start(ctx, "CheckoutService.RefundOrder", tracing.OrderIdKey.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	order, err := c.getOwnedOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !order.Payment.CanMoveTo(model.PaymentRefunded) {
+		return nil, errors.NewPaymentStateError(id, string(order.Payment.Status), string(model.PaymentRefunded))
+	}
+	if c.payments == nil {
+		return nil, errors.NewFeatureDisabled("Payments")
+	}
+
+	authorizationId := order.Payment.AuthorizationId
+	if err = c.callGateway(ctx, func(ctx context.Context) error {
+		return c.payments.Refund(ctx, authorizationId, toCents(order.Total), c.orderCurrency(order))
+	}); err != nil {
+		return nil, err
+	}
+
+	order, err = c.updatePayment(ctx, order, model.Payment{Status: model.PaymentRefunded, AuthorizationId: authorizationId})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"orderId": id,
+		"total":   order.Total,
+	}).Info("Order refunded")
+	return order, nil
+}
+
+// pay authorizes and captures the total of a pending order. The payment is not abandoned when the
+// caller goes away, the gateway could have taken it. Declines and timeouts of the gateway leave
+// the order failed, the error returned is the one storing the payment status. A capture failed is
+// only retried once its authorization is voided, otherwise the gateway could have taken it and the
+// order needs reconciliation.
+func (c *checkoutService) pay(ctx context.Context, order *model.Order) (*model.Order, error) {
+	if c.payments == nil {
+		return order, nil
+	}
+	ctx = detachedContext{ctx}
+	amount := toCents(order.Total)
+	currency := c.orderCurrency(order)
+
+	var authorizationId string
+	if err := c.callGateway(ctx, func(ctx context.Context) (err error) {
+		authorizationId, err = c.payments.Authorize(ctx, order.Id, amount, currency)
+		return err
+	}); err != nil {
+		return c.paymentFailed(ctx, order, "", err)
+	}
+
+	authorized, err := c.updatePayment(ctx, order, model.Payment{Status: model.PaymentAuthorized, AuthorizationId: authorizationId})
+	if err != nil {
+		// Somebody else is taking the payment, this authorization is not needed
+		_ = c.void(ctx, order.Id, authorizationId)
+		return nil, err
+	}
+
+	if err := c.callGateway(ctx, func(ctx context.Context) error {
+		return c.payments.Capture(ctx, authorizationId, amount, currency)
+	}); err != nil {
+		if voidErr := c.void(ctx, order.Id, authorizationId); voidErr != nil {
+			return c.paymentUnreconciled(ctx, authorized, err)
+		}
+		return c.paymentFailed(ctx, authorized, authorizationId, err)
+	}
+
+	captured, err := c.updatePayment(ctx, authorized, model.Payment{Status: model.PaymentCaptured, AuthorizationId: authorizationId})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"orderId": order.Id,
+		"total":   order.Total,
+	}).Info("Order paid")
+	return captured, nil
+}
+
+func (c *checkoutService) paymentFailed(ctx context.Context, order *model.Order, authorizationId string, cause error) (*model.Order, error) {
+	cause = gatewayError(cause)
+
+	logging.GetLoggerWithContext(ctx).WithField("orderId", order.Id).Warnf("Payment failed: %v", cause)
+	return c.updatePayment(ctx, order, model.Payment{
+		Status:          model.PaymentFailed,
+		AuthorizationId: authorizationId,
+		FailureReason:   cause.Error(),
+	})
+}
+
+// paymentUnreconciled leaves the order authorized by the gateway out of the payment retries, its
+// capture could have been taken
+func (c *checkoutService) paymentUnreconciled(ctx context.Context, order *model.Order, cause error) (*model.Order, error) {
+	cause = gatewayError(cause)
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"orderId":         order.Id,
+		"authorizationId": order.Payment.AuthorizationId,
+	}).Errorf("Payment needs reconciliation, the capture failed and the authorization could not be voided: %v", cause)
+	return c.updatePayment(ctx, order, model.Payment{
+		Status:          model.PaymentNeedsReconciliation,
+		AuthorizationId: order.Payment.AuthorizationId,
+		FailureReason:   cause.Error(),
+	})
+}
+
+// detachedContext keeps the values of its parent, like the trace and the logging fields, but is
+// never cancelled nor times out with it
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// gatewayError returns the error of a gateway call, the deadlines of the calls are gateway timeouts
+func gatewayError(err error) error {
+	if err == context.DeadlineExceeded {
+		return payments.ErrTimeout
+	}
+	return err
+}
+
+// void releases an authorization not captured, a failure leaves the amount held until the
+// authorization expires
+func (c *checkoutService) void(ctx context.Context, orderId, authorizationId string) error {
+	err := c.callGateway(ctx, func(ctx context.Context) error {
+		return c.payments.Void(ctx, authorizationId)
+	})
+	if err != nil {
+		logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+			"orderId":         orderId,
+			"authorizationId": authorizationId,
+		}).Errorf("Error voiding the authorization: %v", err)
+	}
+	return err
+}
+
+// callGateway calls the payment gateway with the payment timeout
+func (c *checkoutService) callGateway(ctx context.Context, call func(context.Context) error) error {
+	if c.paymentTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.paymentTimeout)
+		defer cancel()
+	}
+
+	return call(ctx)
+}
+
+// updatePayment stores the payment of the order, it fails when the payment status has changed
+// since the order was read
+func (c *checkoutService) updatePayment(ctx context.Context, order *model.Order, payment model.Payment) (*model.Order, error) {
+	payment.UpdatedAt = time.Now().UTC()
+	if err := c.ds.UpdateOrderPayment(ctx, order.Id, order.Payment.Status, payment); err != nil {
+		return nil, err
+	}
+
+	updated := *order
+	updated.Payment = payment
+	return &updated, nil
+}
+
+// recordPromotions reports the promotions applied to a price asked for or checked out. The
+// prices of the events and snapshots are not reported, they would count a promotion every time
+// the basket changes. The discounts are labelled with the currency of the price, they can't be
+// added up across currencies.
+func (c *checkoutService) recordPromotions(price model.BasketPrice) {
+	currency := price.Currency
+	if currency == "" {
+		currency = c.currencies.Base
+	}
+	for _, p := range price.Promotions {
+		metrics.PromotionApplied(string(p.Type), string(currency), int(toCents(p.Discount)))
+	}
+}
+
+// orderCurrency returns the currency the order is charged in, the base one for the orders placed
+// without currency
+func (c *checkoutService) orderCurrency(order *model.Order) string {
+	if order.Currency == "" {
+		return string(c.currencies.Base)
+	}
+	return string(order.Currency)
+}
+
+// toCents converts a total to the cents charged
+func toCents(total float64) int64 {
+	return int64(math.Round(total * 100))
+}
+
+// getOwnedOrder returns the order when the principal of the context can access it. As the
+// baskets, orders of other owners are reported as not found.
+func (c *checkoutService) getOwnedOrder(ctx context.Context, id string) (*model.Order, error) {
+	order, err := c.ds.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := auth.PrincipalFromContext(ctx)
+	if principal == nil || principal.HasScope(auth.AdminScope) || order.Owner == principal.Owner() {
+		return order, nil
+	}
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"orderId": id,
+		"subject": principal.Subject,
+	}).Info("Access to an order of another owner")
+	return nil, errors.NewOrderNotFound(id)
+}
+
+// promotions returns the promotions with their amounts in the currency of the basket
+func (c *checkoutService) promotions(ctx context.Context, basket *model.Basket) []model.Promotion {
+	return model.PromotionsIn(c.ds.GetPromotions(ctx), basket.Currency, c.currencies)
+}
+
+// notify sends the event to the webhooks, the data is only built when they are enabled
+func (c *checkoutService) notify(eventType string, data func() interface{}) {
+	if c.webhooks != nil {
+		c.webhooks.Publish(eventType, data())
+	}
+}
+
+// getOwnedBasket returns the basket when the principal of the context can access it. Baskets of
+// other owners are reported as not found so their ids can't be probed.
+func (c *checkoutService) getOwnedBasket(ctx context.Context, id string) (*model.Basket, error) {
+	basket, err := c.ds.GetBasket(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := auth.PrincipalFromContext(ctx)
+	if principal == nil || principal.HasScope(auth.AdminScope) || basket.Owner == principal.Owner() {
+		return basket, nil
+	}
+
+	logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+		"basketId": id,
+		"subject":  principal.Subject,
+	}).Info("Access to a basket of another owner")
+	return nil, errors.NewBasketNotFound(id)
 }
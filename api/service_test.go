@@ -1,14 +1,29 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/alfcope/checkouttest/datasource"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/internal/tests/mocks"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/payments"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/metrics"
+	"github.com/alfcope/checkouttest/pkg/tracing"
+	"github.com/alfcope/checkouttest/pkg/webhooks"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type CheckoutServiceTestSuite struct {
@@ -38,7 +53,7 @@ func (suite *CheckoutServiceTestSuite) TestCreateBasketDuplicatedId() {
 	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.AnythingOfType("*model.Basket")).Return(errors.NewPrimaryKeyError(basketId))
 
 	// When
-	b, err := suite.checkoutService.CreateBasket()
+	b, err := suite.checkoutService.CreateBasket(context.Background(), "")
 
 	// Then
 	suite.Equal("", b)
@@ -54,7 +69,7 @@ func (suite *CheckoutServiceTestSuite) TestCreateBasket() {
 	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.AnythingOfType("*model.Basket")).Return(nil)
 
 	// When
-	b, err := suite.checkoutService.CreateBasket()
+	b, err := suite.checkoutService.CreateBasket(context.Background(), "")
 
 	// Then
 	suite.NotEqual("", b)
@@ -68,7 +83,7 @@ func (suite *CheckoutServiceTestSuite) TestAddNonExistingProduct() {
 		mock.AnythingOfType("model.ProductCode")).Return(*new(model.Product), errors.NewProductNotFound(productCode))
 
 	// When
-	err := suite.checkoutService.AddProduct(uuid.New().String(), model.ProductCode(productCode))
+	err := suite.checkoutService.AddProduct(context.Background(), uuid.New().String(), model.ProductCode(productCode))
 
 	// Then
 	if productNotFound, ok := err.(*errors.ProductNotFound); ok {
@@ -93,7 +108,7 @@ func (suite *CheckoutServiceTestSuite) TestAddProductToNonExistingBasket() {
 		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
 
 	// When
-	err := suite.checkoutService.AddProduct(uuid.New().String(), productCode)
+	err := suite.checkoutService.AddProduct(context.Background(), uuid.New().String(), productCode)
 
 	// Then
 	if basketNotFound, ok := err.(*errors.BasketNotFound); ok {
@@ -113,14 +128,109 @@ func (suite *CheckoutServiceTestSuite) TestAddProduct() {
 		mock.AnythingOfType("model.ProductCode")).Return(product, nil)
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
 		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock",
+		mock.AnythingOfType("string"), productCode).Return(nil)
 
 	// When
-	err := suite.checkoutService.AddProduct(uuid.New().String(), productCode)
+	err := suite.checkoutService.AddProduct(context.Background(), uuid.New().String(), productCode)
 
 	// Then
 	suite.Nil(err)
 }
 
+func (suite *CheckoutServiceTestSuite) TestAddProductOutOfStock() {
+	// Given
+	basketId := uuid.New().String()
+	var productCode model.ProductCode = "P1"
+	basket := model.NewBasket(basketId)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(model.Product{Code: productCode, Name: "Prod 1", Price: 1000}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock",
+		basketId, productCode).Return(errors.NewOutOfStock(string(productCode)))
+
+	// When
+	err := suite.checkoutService.AddProduct(context.Background(), basketId, productCode)
+
+	// Then
+	if outOfStock, ok := err.(*errors.OutOfStock); ok {
+		suite.Equal(string(productCode), outOfStock.Code)
+	} else {
+		suite.T().Errorf("Error should be an out of stock error, got %T", err)
+	}
+	suite.Len(basket.GetLines(), 0)
+}
+
+func (suite *CheckoutServiceTestSuite) TestAddProductReleasesStockWhenRefused() {
+	// Given
+	basketId := uuid.New().String()
+	var productCode model.ProductCode = "P1"
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(model.Product{Code: productCode, Name: "Prod 1", Price: -10}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(model.NewBasket(basketId), nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock", basketId, productCode).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReleaseStock", basketId, productCode).Return()
+
+	// When
+	err := suite.checkoutService.AddProduct(context.Background(), basketId, productCode)
+
+	// Then
+	suite.NotNil(err)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "ReleaseStock", basketId, productCode)
+}
+
+func (suite *CheckoutServiceTestSuite) TestRemoveProduct() {
+	// Given
+	basketId := uuid.New().String()
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: 1000}
+	basket := model.NewBasket(basketId)
+	suite.Require().Nil(basket.AddProduct(product))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReleaseStock", basketId, product.Code).Return()
+
+	// When
+	err := suite.checkoutService.RemoveProduct(context.Background(), basketId, product.Code)
+
+	// Then
+	suite.Nil(err)
+	suite.Len(basket.GetLines(), 0)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "ReleaseStock", basketId, product.Code)
+
+	// When the product is no longer in the basket
+	err = suite.checkoutService.RemoveProduct(context.Background(), basketId, product.Code)
+
+	// Then
+	if _, ok := err.(*errors.ProductNotFound); !ok {
+		suite.T().Errorf("Error should be a product not found error, got %T", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNumberOfCalls(suite.T(), "ReleaseStock", 1)
+}
+
+func (suite *CheckoutServiceTestSuite) TestExpireBaskets() {
+	// Given
+	expired := model.NewBasket(uuid.New().String())
+	time.Sleep(200 * time.Millisecond)
+	changed := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetExpiredBaskets",
+		mock.AnythingOfType("time.Time")).Return([]string{expired.Id, changed.Id})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", expired.Id).Return(expired, nil)
+	// Changed after it was listed
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", changed.Id).Return(changed, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasket", expired.Id).Return()
+
+	// When
+	count := suite.checkoutService.ExpireBaskets(context.Background(), 100*time.Millisecond)
+
+	// Then
+	suite.Equal(1, count)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "DeleteBasket", expired.Id)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "DeleteBasket", changed.Id)
+}
+
 func (suite *CheckoutServiceTestSuite) TestGetPriceNonExistingBasket() {
 	// Given
 	basketId := uuid.New().String()
@@ -129,7 +239,7 @@ func (suite *CheckoutServiceTestSuite) TestGetPriceNonExistingBasket() {
 		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
 
 	// When
-	price, err := suite.checkoutService.GetBasketPrice(uuid.New().String())
+	price, err := suite.checkoutService.GetBasketPrice(context.Background(), uuid.New().String())
 
 	// Then
 	if basketNotFound, ok := err.(*errors.BasketNotFound); ok {
@@ -151,9 +261,686 @@ func (suite *CheckoutServiceTestSuite) TestGetPriceEmptyBasket() {
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
 
 	// When
-	price, err := suite.checkoutService.GetBasketPrice(uuid.New().String())
+	price, err := suite.checkoutService.GetBasketPrice(context.Background(), uuid.New().String())
 
 	// Then
 	suite.Nil(err)
 	suite.Equal(float64(0), price)
 }
+
+func (suite *CheckoutServiceTestSuite) TestGetNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	_, err := suite.checkoutService.GetBasket(context.Background(), basketId)
+
+	// Then
+	if basketNotFound, ok := err.(*errors.BasketNotFound); ok {
+		suite.Equal(basketId, basketNotFound.Id)
+	} else {
+		suite.T().Error("Error should be a basket not found error ")
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestCreateBasketRecordsOwner() {
+	// Given
+	var created *model.Basket
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.AnythingOfType("*model.Basket")).
+		Run(func(args mock.Arguments) { created = args.Get(0).(*model.Basket) }).Return(nil)
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "till-1", Store: "store-1"})
+
+	// When
+	_, err := suite.checkoutService.CreateBasket(ctx, "")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal("store:store-1", created.Owner)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetBasketOfAnotherStore() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	basket.Owner = "store:store-1"
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "till-2", Store: "store-2"})
+
+	// When
+	_, err := suite.checkoutService.GetBasket(ctx, basketId)
+
+	// Then
+	if basketNotFound, ok := err.(*errors.BasketNotFound); ok {
+		suite.Equal(basketId, basketNotFound.Id)
+	} else {
+		suite.T().Error("Error should be a basket not found error ")
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetBasketOfSameStoreAndAdmin() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	basket.Owner = "store:store-1"
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+
+	principals := []*auth.Principal{
+		{Subject: "till-2", Store: "store-1"},
+		{Subject: "ops", Scopes: []string{auth.AdminScope}},
+	}
+
+	for _, principal := range principals {
+		// When
+		b, err := suite.checkoutService.GetBasket(auth.WithPrincipal(context.Background(), principal), basketId)
+
+		// Then
+		suite.Nil(err, principal.Subject)
+		suite.Equal(basket, b, principal.Subject)
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestDeleteBasketOfAnotherStore() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	basket.Owner = "store:store-1"
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "till-2", Store: "store-2"})
+
+	// When
+	suite.checkoutService.DeleteBasket(ctx, basketId)
+
+	// Then
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "DeleteBasket", basketId)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetPriceExpiredContext() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	// When
+	_, err := suite.checkoutService.GetBasketPrice(ctx, basketId)
+
+	// Then
+	suite.Equal(context.DeadlineExceeded, err)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetPriceSpans() {
+	// Given
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(tracing.NewTracerProvider("test", 1, sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Product 1", Price: 1000})
+	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P2": {{Buy: 3, Free: 1}}})}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	service := NewCheckoutService(datasource.WithTracing(suite.datasourceMock))
+
+	// When
+	_, err := service.GetBasketPrice(context.Background(), basketId)
+
+	// Then
+	suite.Nil(err)
+
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+
+	suite.Len(spans["CheckoutService.GetBasketPrice"], 1)
+	root := spans["CheckoutService.GetBasketPrice"][0].SpanContext().SpanID()
+
+	for _, name := range []string{"Datasource.GetBasket", "Datasource.GetPromotions", "Basket.CalculatePrice"} {
+		if suite.Len(spans[name], 1, name) {
+			suite.Equal(root, spans[name][0].Parent().SpanID(), name)
+		}
+	}
+
+	pricing := spans["Basket.CalculatePrice"][0]
+	suite.Contains(pricing.Attributes(), tracing.BasketLinesKey.Int(1))
+	suite.Len(spans["Basket.Lock"], 1)
+
+	if suite.Len(spans["Promotion.Resolve"], 2) {
+		suite.Equal(pricing.SpanContext().SpanID(), spans["Promotion.Resolve"][0].Parent().SpanID())
+		suite.Contains(spans["Promotion.Resolve"][0].Attributes(), tracing.PromotionTypeKey.String("BULK"))
+		suite.Contains(spans["Promotion.Resolve"][1].Attributes(), tracing.PromotionTypeKey.String("FREE_ITEMS"))
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestLifecycleWebhooks() {
+	// Given
+	delivered := make(chan webhooks.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhooks.Event
+		suite.Nil(json.NewDecoder(r.Body).Decode(&event))
+		delivered <- event
+	}))
+	defer receiver.Close()
+
+	dispatcher := webhooks.NewDispatcher([]webhooks.Subscription{{URL: receiver.URL, Secret: "secret",
+		Events: []string{webhooks.BasketCreated, webhooks.BasketChanged, webhooks.BasketPriced, webhooks.BasketDeleted}}})
+	service := NewCheckoutService(suite.datasourceMock, WithWebhooks(dispatcher))
+
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: 1000}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.AnythingOfType("*model.Basket")).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", product.Code).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasket", mock.AnythingOfType("string")).Return()
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock", mock.AnythingOfType("string"), product.Code).Return(nil)
+
+	// When
+	basketId, err := service.CreateBasket(context.Background(), "")
+	suite.Nil(err)
+
+	basket := model.NewBasket(basketId)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+
+	suite.Nil(service.AddProduct(context.Background(), basketId, product.Code))
+	_, err = service.GetBasketPrice(context.Background(), basketId)
+	suite.Nil(err)
+	service.DeleteBasket(context.Background(), basketId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	suite.Nil(dispatcher.Close(ctx))
+	close(delivered)
+
+	// Then
+	var types []string
+	for event := range delivered {
+		types = append(types, event.Type)
+
+		data := event.Data.(map[string]interface{})
+		suite.Equal(basketId, data["id"])
+		if event.Type == webhooks.BasketPriced {
+			suite.Equal(10.0, data["total"])
+		}
+	}
+	suite.Equal([]string{webhooks.BasketCreated, webhooks.BasketChanged, webhooks.BasketPriced, webhooks.BasketDeleted}, types)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckout() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1000})
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1000})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.AnythingOfType("*model.Order")).Return(nil)
+
+	// When
+	order, err := suite.checkoutService.Checkout(context.Background(), basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.NotEqual("", order.Id)
+	suite.Equal(basketId, order.BasketId)
+	suite.Equal(float64(20), order.Total)
+	suite.Equal([]model.OrderLine{{Code: "P1", Name: "Prod 1", Price: 1000, Amount: 2}}, order.Lines)
+	suite.True(basket.IsClosed())
+
+	// A closed basket can't be checked out again
+	_, err = suite.checkoutService.Checkout(context.Background(), basketId)
+	if _, ok := err.(*errors.BasketClosed); !ok {
+		suite.T().Errorf("Error should be a basket closed error, got %v", err)
+	}
+}
+
+// promotionRecorder counts the promotions reported to the metrics
+type promotionRecorder struct {
+	applied []string
+}
+
+func (r *promotionRecorder) ObserveRequest(string, string, int, time.Duration) {}
+func (r *promotionRecorder) SetOpenBaskets(int)                                {}
+func (r *promotionRecorder) PromotionApplied(promotionType, currency string, discount int) {
+	r.applied = append(r.applied, promotionType)
+}
+
+func (suite *CheckoutServiceTestSuite) TestPromotionsRecordedWhenPriced() {
+	// Given
+	recorder := &promotionRecorder{}
+	metrics.SetRecorder(recorder)
+	defer metrics.SetRecorder(nil)
+
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: 1000}
+	_ = basket.AddProduct(product)
+	_ = basket.AddProduct(product)
+	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}})}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", product.Code).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock", basketId, product.Code).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.AnythingOfType("*model.Order")).Return(nil)
+
+	// When
+	suite.Nil(suite.checkoutService.AddProduct(context.Background(), basketId, product.Code))
+	appliedOnChange := len(recorder.applied)
+	_, err := suite.checkoutService.GetBasketPrice(context.Background(), basketId)
+	suite.Nil(err)
+	_, err = suite.checkoutService.Checkout(context.Background(), basketId)
+	suite.Nil(err)
+
+	// Then
+	suite.Equal(0, appliedOnChange, "Changing a basket should not record its promotions")
+	suite.Equal([]string{"BULK", "BULK"}, recorder.applied)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutOrderNotStored() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.AnythingOfType("*model.Order")).
+		Return(errors.NewPrimaryKeyError("order"))
+
+	// When
+	_, err := suite.checkoutService.Checkout(context.Background(), basketId)
+
+	// Then
+	suite.NotNil(err)
+	suite.False(basket.IsClosed(), "The basket should be open when the order is not placed")
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutWithTaxes() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1000})
+	_ = basket.AddProduct(model.Product{Code: "P2", Name: "Prod 2", Price: 500, TaxCategory: "reduced"})
+	service := NewCheckoutService(suite.datasourceMock, WithTaxes(model.TaxPolicy{Mode: model.TaxExclusive,
+		DefaultRegion: "es", Rates: map[string]model.TaxRates{"es": {model.StandardTax: 21, "reduced": 10}}}))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.AnythingOfType("*model.Order")).Return(nil)
+
+	// When
+	order, err := service.Checkout(context.Background(), basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.Require().NotNil(order.Receipt)
+	suite.Equal(15.0, order.Receipt.Net)
+	suite.Equal(2.6, order.Receipt.Tax)
+	suite.Equal(17.6, order.Total, "The tax exclusive prices are charged with the tax")
+	suite.Len(order.Receipt.Taxes, 2)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetReceipt() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1210})
+	service := NewCheckoutService(suite.datasourceMock, WithTaxes(model.TaxPolicy{Mode: model.TaxInclusive,
+		DefaultRegion: "es", Rates: map[string]model.TaxRates{"es": {model.StandardTax: 21}}}))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	receipt, err := service.GetReceipt(context.Background(), basketId, "")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal("es", receipt.Region)
+	suite.Equal(10.0, receipt.Net)
+	suite.Equal(2.1, receipt.Tax)
+	suite.Equal(12.1, receipt.Gross)
+
+	// When the region has no rates
+	_, err = service.GetReceipt(context.Background(), basketId, "fr")
+
+	// Then
+	if _, ok := err.(*errors.ValidationError); !ok {
+		suite.T().Errorf("Error should be a validation error, got %v", err)
+	}
+
+	// When the taxes are not enabled
+	_, err = suite.checkoutService.GetReceipt(context.Background(), basketId, "")
+
+	// Then
+	if _, ok := err.(*errors.FeatureDisabled); !ok {
+		suite.T().Errorf("Error should be a feature disabled error, got %v", err)
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestCreateBasketInCurrency() {
+	// Given
+	service := NewCheckoutService(suite.datasourceMock, WithCurrencies(model.Currencies{Base: "EUR", Accepted: []model.Currency{"GBP"}}))
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.AnythingOfType("*model.Basket")).Return(nil)
+
+	// When
+	_, err := service.CreateBasket(context.Background(), "GBP")
+	_, baseErr := service.CreateBasket(context.Background(), "")
+
+	// Then
+	suite.Nil(err)
+	suite.Nil(baseErr)
+	calls := suite.datasourceMock.(*mocks.DatasourceMock).Calls
+	suite.Require().Len(calls, 2)
+	suite.Equal(model.Currency("GBP"), calls[0].Arguments.Get(0).(*model.Basket).Currency)
+	suite.Equal(model.Currency("EUR"), calls[1].Arguments.Get(0).(*model.Basket).Currency)
+
+	// When the currency is not accepted
+	_, err = service.CreateBasket(context.Background(), "JPY")
+
+	// Then
+	if validationError, ok := err.(*errors.ValidationError); ok {
+		suite.Equal("currency", validationError.Errors[0].Field)
+	} else {
+		suite.T().Errorf("Error should be a validation error, got %v", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNumberOfCalls(suite.T(), "AddBasket", 2)
+}
+
+func (suite *CheckoutServiceTestSuite) TestAddProductWithoutPriceInCurrency() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	basket.Currency = "GBP"
+	service := NewCheckoutService(suite.datasourceMock, WithCurrencies(model.Currencies{Base: "EUR", Accepted: []model.Currency{"GBP"}}))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(model.Product{Code: "P1", Name: "Prod 1", Price: 1000}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+
+	// When
+	err := service.AddProduct(context.Background(), basketId, "P1")
+
+	// Then
+	if priceNotFound, ok := err.(*errors.PriceNotFound); ok {
+		suite.Equal("GBP", priceNotFound.Currency)
+	} else {
+		suite.T().Errorf("Error should be a price not found error, got %v", err)
+	}
+	suite.Empty(basket.GetLines())
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "ReserveStock", basketId, model.ProductCode("P1"))
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutInCurrency() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	basket.Currency = "GBP"
+	service := NewCheckoutService(suite.datasourceMock, WithCurrencies(model.Currencies{Base: "EUR", Accepted: []model.Currency{"GBP"}}))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", mock.AnythingOfType("model.ProductCode")).Return(
+		model.Product{Code: "P1", Name: "Prod 1", Price: 2000, Prices: map[model.Currency]int{"GBP": 1700}}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReserveStock", basketId, model.ProductCode("P1")).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{
+		model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{
+			"P1": {{Buy: 3, Price: 1900, Prices: map[model.Currency]int{"GBP": 1600}}}}),
+	})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.AnythingOfType("*model.Order")).Return(nil)
+
+	for i := 0; i < 3; i++ {
+		suite.Require().Nil(service.AddProduct(context.Background(), basketId, "P1"))
+	}
+
+	// When
+	order, err := service.Checkout(context.Background(), basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.Currency("GBP"), order.Currency)
+	suite.Equal(1700, order.Lines[0].Price)
+	suite.Equal(48.0, order.Total, "The bulk price in pounds should be charged")
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetOrderOfAnotherStore() {
+	// Given
+	orderId := uuid.New().String()
+	order := &model.Order{Id: orderId, Owner: "store:store-1"}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", orderId).Return(order, nil)
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "till-2", Store: "store-2"})
+
+	// When
+	_, err := suite.checkoutService.GetOrder(ctx, orderId)
+
+	// Then
+	if orderNotFound, ok := err.(*errors.OrderNotFound); ok {
+		suite.Equal(orderId, orderNotFound.Id)
+	} else {
+		suite.T().Error("Error should be an order not found error")
+	}
+
+	// When
+	o, err := suite.checkoutService.GetOrder(auth.WithPrincipal(context.Background(),
+		&auth.Principal{Subject: "till-1", Store: "store-1"}), orderId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(order, o)
+}
+
+func (suite *CheckoutServiceTestSuite) checkoutWithGateway(gateway payments.PaymentGateway, timeout time.Duration) *model.Order {
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	basket.Currency = "GBP"
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: 1050})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.AnythingOfType("*model.Order")).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateOrderPayment", mock.AnythingOfType("string"),
+		mock.AnythingOfType("model.PaymentStatus"), mock.AnythingOfType("model.Payment")).Return(nil)
+
+	service := NewCheckoutService(suite.datasourceMock, WithPaymentGateway(gateway, timeout),
+		WithCurrencies(model.Currencies{Base: "EUR", Accepted: []model.Currency{"GBP"}}))
+	order, err := service.Checkout(context.Background(), basketId)
+	suite.Require().Nil(err)
+	suite.True(basket.IsClosed())
+
+	return order
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutPaymentCaptured() {
+	// Given
+	gateway := payments.NewFakeGateway()
+
+	// When
+	order := suite.checkoutWithGateway(gateway, time.Second)
+
+	// Then
+	suite.Equal(model.PaymentCaptured, order.Payment.Status)
+	suite.NotEqual("", order.Payment.AuthorizationId)
+
+	updates := suite.datasourceMock.(*mocks.DatasourceMock).Calls
+	var transitions []model.PaymentStatus
+	for _, call := range updates {
+		if call.Method == "UpdateOrderPayment" {
+			transitions = append(transitions, call.Arguments.Get(1).(model.PaymentStatus),
+				call.Arguments.Get(2).(model.Payment).Status)
+		}
+	}
+	suite.Equal([]model.PaymentStatus{model.PaymentPending, model.PaymentAuthorized,
+		model.PaymentAuthorized, model.PaymentCaptured}, transitions)
+
+	// The whole total was captured in the currency of the basket
+	suite.NotNil(gateway.Refund(context.Background(), order.Payment.AuthorizationId, 1051, "GBP"))
+	suite.NotNil(gateway.Refund(context.Background(), order.Payment.AuthorizationId, 1050, "EUR"))
+	suite.Nil(gateway.Refund(context.Background(), order.Payment.AuthorizationId, 1050, "GBP"))
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutPaymentDeclined() {
+	// Given
+	gateway := payments.NewFakeGateway()
+	gateway.Script(payments.Decline)
+
+	// When
+	order := suite.checkoutWithGateway(gateway, time.Second)
+
+	// Then
+	suite.Equal(model.PaymentFailed, order.Payment.Status)
+	suite.Contains(order.Payment.FailureReason, "declined")
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutPaymentTimeout() {
+	// Given
+	gateway := payments.NewFakeGateway(payments.WithOutcome(payments.Timeout))
+
+	// When
+	order := suite.checkoutWithGateway(gateway, 10*time.Millisecond)
+
+	// Then
+	suite.Equal(model.PaymentFailed, order.Payment.Status)
+	suite.Equal(payments.ErrTimeout.Error(), order.Payment.FailureReason)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutCaptureDeclinedVoidsAuthorization() {
+	// Given
+	gateway := payments.NewFakeGateway()
+	gateway.Script(payments.Approve, payments.Decline)
+
+	// When
+	order := suite.checkoutWithGateway(gateway, time.Second)
+
+	// Then
+	suite.Equal(model.PaymentFailed, order.Payment.Status)
+	if _, ok := gateway.Capture(context.Background(), order.Payment.AuthorizationId, 1050, "GBP").(*payments.DeclinedError); !ok {
+		suite.T().Error("The authorization should have been voided")
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutCaptureTimeoutNotVoidedNeedsReconciliation() {
+	// Given
+	gateway := payments.NewFakeGateway()
+	gateway.Script(payments.Approve, payments.Timeout, payments.Timeout)
+
+	// When
+	order := suite.checkoutWithGateway(gateway, 10*time.Millisecond)
+
+	// Then
+	suite.Equal(model.PaymentNeedsReconciliation, order.Payment.Status)
+	suite.Equal(payments.ErrTimeout.Error(), order.Payment.FailureReason)
+	suite.NotEqual("", order.Payment.AuthorizationId)
+
+	// The payment can't be taken again, the first capture could have been taken
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", order.Id).Return(order, nil)
+	service := NewCheckoutService(suite.datasourceMock, WithPaymentGateway(gateway, time.Second))
+
+	_, err := service.PayOrder(context.Background(), order.Id)
+	if _, ok := err.(*errors.PaymentStateError); !ok {
+		suite.T().Errorf("Error should be a payment state error, got %v", err)
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestDetachedContext() {
+	// Given
+	ctx, cancel := context.WithTimeout(logging.WithRequestId(context.Background(), "request-1"), time.Minute)
+	detached := detachedContext{ctx}
+
+	// When
+	cancel()
+
+	// Then
+	suite.Equal(context.Canceled, ctx.Err())
+	suite.Nil(detached.Err())
+	suite.Nil(detached.Done())
+	_, hasDeadline := detached.Deadline()
+	suite.False(hasDeadline)
+	suite.Equal("request-1", logging.RequestIdFromContext(detached))
+}
+
+func (suite *CheckoutServiceTestSuite) TestPayFailedOrder() {
+	// Given
+	orderId := uuid.New().String()
+	order := &model.Order{Id: orderId, Total: 10.5, Payment: model.Payment{Status: model.PaymentFailed}}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", orderId).Return(order, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateOrderPayment", orderId,
+		mock.AnythingOfType("model.PaymentStatus"), mock.AnythingOfType("model.Payment")).Return(nil)
+
+	service := NewCheckoutService(suite.datasourceMock, WithPaymentGateway(payments.NewFakeGateway(), time.Second))
+
+	// When
+	paid, err := service.PayOrder(context.Background(), orderId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.PaymentCaptured, paid.Payment.Status)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "UpdateOrderPayment", orderId,
+		model.PaymentFailed, mock.MatchedBy(func(p model.Payment) bool { return p.Status == model.PaymentPending }))
+}
+
+func (suite *CheckoutServiceTestSuite) TestRefundOrder() {
+	// Given
+	gateway := payments.NewFakeGateway()
+	authorizationId, _ := gateway.Authorize(context.Background(), "order", 1050, "EUR")
+	_ = gateway.Capture(context.Background(), authorizationId, 1050, "EUR")
+
+	orderId := uuid.New().String()
+	order := &model.Order{Id: orderId, Total: 10.5, Currency: "EUR",
+		Payment: model.Payment{Status: model.PaymentCaptured, AuthorizationId: authorizationId}}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", orderId).Return(order, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateOrderPayment", orderId, model.PaymentCaptured,
+		mock.AnythingOfType("model.Payment")).Return(nil)
+
+	service := NewCheckoutService(suite.datasourceMock, WithPaymentGateway(gateway, time.Second))
+
+	// When
+	refunded, err := service.RefundOrder(context.Background(), orderId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.PaymentRefunded, refunded.Payment.Status)
+	suite.Equal(authorizationId, refunded.Payment.AuthorizationId)
+}
+
+func (suite *CheckoutServiceTestSuite) TestRefundOrderNotCaptured() {
+	// Given
+	orderId := uuid.New().String()
+	order := &model.Order{Id: orderId, Payment: model.Payment{Status: model.PaymentFailed}}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", orderId).Return(order, nil)
+
+	service := NewCheckoutService(suite.datasourceMock, WithPaymentGateway(payments.NewFakeGateway(), time.Second))
+
+	// When
+	_, err := service.RefundOrder(context.Background(), orderId)
+
+	// Then
+	if stateError, ok := err.(*errors.PaymentStateError); ok {
+		suite.Equal(string(model.PaymentFailed), stateError.From)
+		suite.Equal(string(model.PaymentRefunded), stateError.To)
+	} else {
+		suite.T().Errorf("Error should be a payment state error, got %v", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UpdateOrderPayment",
+		mock.Anything, mock.Anything, mock.Anything)
+}
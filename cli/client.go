@@ -2,51 +2,261 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/alfcope/checkouttest/api/requests"
 	"github.com/alfcope/checkouttest/api/responses"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/google/uuid"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
+// Timeout applied to requests whose context does not carry a deadline
+const DefaultTimeout = 5 * time.Second
+
 type CheckoutClient struct {
 	serverUrl  string
 	apiVersion int
 	httpClient *http.Client
+	timeout    time.Duration
+
+	transport   http.RoundTripper
+	tlsConfig   *tls.Config
+	headers     http.Header
+	retryPolicy *RetryPolicy
+
+	// Error applying the options, returned by every call
+	err error
 }
 
-func NewCheckoutClient(serverUrl string, version int) *CheckoutClient {
-	return &CheckoutClient{
+func NewCheckoutClient(serverUrl string, version int, options ...Option) *CheckoutClient {
+	client := &CheckoutClient{
 		serverUrl:  serverUrl,
 		apiVersion: version,
-		httpClient: &http.Client{
-			Timeout: time.Second * 5,
-		},
+		timeout:    DefaultTimeout,
+		headers:    make(http.Header),
+	}
+
+	for _, option := range options {
+		option(client)
+	}
+
+	if client.httpClient == nil {
+		client.httpClient = &http.Client{}
+	}
+	if client.transport != nil {
+		client.httpClient.Transport = client.transport
+	}
+	if client.tlsConfig != nil {
+		transport := client.httpClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		if t, ok := transport.(*http.Transport); ok {
+			t = t.Clone()
+			t.TLSClientConfig = client.tlsConfig
+			client.httpClient.Transport = t
+		}
+	}
+
+	return client
+}
+
+// do sends the request bound to the context, retrying it when the retry policy allows it.
+// Every attempt has its own timeout so a hung attempt can be retried: the default timeout
+// when the caller has not set a deadline, otherwise its share of the time left to the
+// deadline. The returned cancel function releases the context of the attempt answered.
+func (c *CheckoutClient) do(ctx context.Context, req *http.Request) (*http.Response, context.CancelFunc, error) {
+	return c.send(ctx, req, true)
+}
+
+// doOnce sends the request without retries, for the calls whose method is idempotent but whose
+// effect is not
+func (c *CheckoutClient) doOnce(ctx context.Context, req *http.Request) (*http.Response, context.CancelFunc, error) {
+	return c.send(ctx, req, false)
+}
+
+func (c *CheckoutClient) send(ctx context.Context, req *http.Request, retryable bool) (*http.Response, context.CancelFunc, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	for key, values := range c.headers {
+		req.Header[key] = values
+	}
+	if key := idempotencyKeyFromContext(ctx); key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	setTraceHeaders(ctx, req)
+
+	attempts := 1
+	if c.retryPolicy != nil && c.retryPolicy.MaxAttempts > 1 && retryable && isRetryable(req) {
+		attempts = c.retryPolicy.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := c.attemptContext(ctx, attempts-attempt+1)
+
+		attemptReq := req.WithContext(attemptCtx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		resp, err := c.httpClient.Do(attemptReq)
+		if attempt >= attempts || !shouldRetry(ctx, resp, err) {
+			if err != nil {
+				cancel()
+				return nil, nil, err
+			}
+			return resp, cancel, nil
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+
+		select {
+		case <-time.After(c.retryPolicy.backoff(attempt)):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// attemptContext bounds an attempt of a call with the attempts left, including this one
+func (c *CheckoutClient) attemptContext(ctx context.Context, attemptsLeft int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		if c.timeout <= 0 {
+			return context.WithCancel(ctx)
+		}
+		return context.WithTimeout(ctx, c.timeout)
+	}
+
+	// The last attempt has all the time left
+	return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(attemptsLeft))
+}
+
+type contextKey int
+
+const idempotencyKeyKey contextKey = iota
+
+// WithIdempotencyKey sends the key in the Idempotency-Key header of the calls made with the
+// context, which makes their POST requests eligible for retries. All the attempts of a call
+// share the key.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey, key)
+}
+
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey).(string)
+	return key
+}
+
+// setTraceHeaders propagates the request id and the trace of the context, or starts new ones.
+// All the attempts of a call share them.
+func setTraceHeaders(ctx context.Context, req *http.Request) {
+	if requestId := logging.RequestIdFromContext(ctx); requestId != "" {
+		req.Header.Set(logging.RequestIdHeader, requestId)
+	} else if req.Header.Get(logging.RequestIdHeader) == "" {
+		req.Header.Set(logging.RequestIdHeader, uuid.New().String())
+	}
+
+	trace, ok := logging.TraceContextFromContext(ctx)
+	if ok {
+		trace = trace.ChildOf()
+	} else {
+		trace = logging.NewTraceContext()
 	}
+	req.Header.Set(logging.TraceparentHeader, trace.Traceparent())
 }
 
-func (c *CheckoutClient) AddBasket() (string, error) {
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v%d/baskets/", c.serverUrl, c.apiVersion), nil)
+// isRetryable reports whether sending the request twice has the same effect as sending it once
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return req.Header.Get(IdempotencyKeyHeader) != ""
+	}
+	return false
+}
+
+// shouldRetry reports whether an attempt failed for a transient reason. The context is the one of
+// the call, the timeout of the attempt is a transport timeout.
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	// Nothing left to retry once the caller has gone away or its deadline is over
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		netErr, ok := err.(net.Error)
+		return ok && netErr.Timeout()
+	}
+
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// backoff returns a random delay between zero and the exponential bound of the attempt
+func (r *RetryPolicy) backoff(attempt int) time.Duration {
+	bound := r.BaseDelay << uint(attempt-1)
+	if bound <= 0 || (r.MaxDelay > 0 && bound > r.MaxDelay) {
+		bound = r.MaxDelay
+	}
+	if bound <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(bound)))
+}
+
+func (c *CheckoutClient) AddBasket(ctx context.Context) (string, error) {
+	return c.AddBasketInCurrency(ctx, "")
+}
+
+// AddBasketInCurrency creates a basket priced in the currency, the base one of the server when empty
+func (c *CheckoutClient) AddBasketInCurrency(ctx context.Context, currency string) (string, error) {
+	basketsUrl := fmt.Sprintf("%s/api/v%d/baskets/", c.serverUrl, c.apiVersion)
+	if currency = strings.TrimSpace(currency); currency != "" {
+		basketsUrl += "?currency=" + url.QueryEscape(currency)
+	}
+
+	req, err := http.NewRequest("POST", basketsUrl, nil)
 	if err != nil {
 		return "", fmt.Errorf("there was an error creating http request: %v", err)
 	}
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, cancel, err := c.do(ctx, req)
 	if err != nil {
 		return "", err
 	}
+	defer cancel()
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
 		log.Printf("%s\n", resp.Status)
-		return "", fmt.Errorf("%s", resp.Status)
+		return "", newResponseError(resp)
 	}
 
 	if resp.Body != nil {
@@ -67,9 +277,9 @@ func (c *CheckoutClient) AddBasket() (string, error) {
 	return "", errors.New("empty response")
 }
 
-func (c *CheckoutClient) AddItem(basketId, productCode string) error {
+func (c *CheckoutClient) AddItem(ctx context.Context, basketId, productCode string) error {
 	if strings.TrimSpace(basketId) == "" || strings.TrimSpace(productCode) == "" {
-		return errors.New("invalid request")
+		return ErrInvalidRequest
 	}
 
 	ir := requests.AddItemRequest{Code: model.ProductCode(productCode)}
@@ -83,22 +293,50 @@ func (c *CheckoutClient) AddItem(basketId, productCode string) error {
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, cancel, err := c.do(ctx, req)
 	if err != nil {
 		return err
 	}
+	defer cancel()
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("%s", resp.Status)
+		return newResponseError(resp)
 	}
 
 	return nil
 }
 
-func (c *CheckoutClient) GetPrice(basketId string) (float64, error) {
+// RemoveItem removes a unit of the product from the basket
+func (c *CheckoutClient) RemoveItem(ctx context.Context, basketId, productCode string) error {
+	if strings.TrimSpace(basketId) == "" || strings.TrimSpace(productCode) == "" {
+		return ErrInvalidRequest
+	}
+
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/v%d/baskets/%s/items/%s", c.serverUrl, c.apiVersion,
+		strings.TrimSpace(basketId), strings.TrimSpace(productCode)), nil)
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+
+	// Every call removes a unit, a retry could remove two
+	resp, cancel, err := c.doOnce(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return newResponseError(resp)
+	}
+
+	return nil
+}
+
+func (c *CheckoutClient) GetPrice(ctx context.Context, basketId string) (float64, error) {
 	if strings.TrimSpace(basketId) == "" {
-		return float64(-1), errors.New("invalid request")
+		return float64(-1), ErrInvalidRequest
 	}
 
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v%d/baskets/%s?price", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), nil)
@@ -107,14 +345,15 @@ func (c *CheckoutClient) GetPrice(basketId string) (float64, error) {
 	}
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, cancel, err := c.do(ctx, req)
 	if err != nil {
 		return float64(-1), err
 	}
+	defer cancel()
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return float64(-1), fmt.Errorf("%s", resp.Status)
+		return float64(-1), newResponseError(resp)
 	}
 
 	if resp.Body != nil {
@@ -135,9 +374,92 @@ func (c *CheckoutClient) GetPrice(basketId string) (float64, error) {
 	return float64(0), errors.New("empty response")
 }
 
-func (c *CheckoutClient) DeleteBasket(basketId string) error {
+func (c *CheckoutClient) GetBasket(ctx context.Context, basketId string) (*responses.BasketResponse, error) {
 	if strings.TrimSpace(basketId) == "" {
-		return errors.New("invalid request")
+		return nil, ErrInvalidRequest
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v%d/baskets/%s", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, cancel, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newResponseError(resp)
+	}
+
+	if resp.Body != nil {
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		b := responses.BasketResponse{}
+		err = json.Unmarshal(responseBody, &b)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		return &b, nil
+	}
+
+	return nil, errors.New("empty response")
+}
+
+// GetReceipt returns the receipt of the basket with the taxes of the region, the default one of
+// the server when empty
+func (c *CheckoutClient) GetReceipt(ctx context.Context, basketId, region string) (*responses.ReceiptResponse, error) {
+	if strings.TrimSpace(basketId) == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	receiptUrl := fmt.Sprintf("%s/api/v%d/baskets/%s/receipt", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId))
+	if region = strings.TrimSpace(region); region != "" {
+		receiptUrl += "?region=" + url.QueryEscape(region)
+	}
+
+	req, err := http.NewRequest("GET", receiptUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, cancel, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newResponseError(resp)
+	}
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching response body: %v", err)
+	}
+
+	r := responses.ReceiptResponse{}
+	err = json.Unmarshal(responseBody, &r)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching response body: %v", err)
+	}
+
+	return &r, nil
+}
+
+func (c *CheckoutClient) DeleteBasket(ctx context.Context, basketId string) error {
+	if strings.TrimSpace(basketId) == "" {
+		return ErrInvalidRequest
 	}
 
 	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/v%d/baskets/%s", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), nil)
@@ -145,15 +467,122 @@ func (c *CheckoutClient) DeleteBasket(basketId string) error {
 		return fmt.Errorf("there was an error creating http request: %v", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, cancel, err := c.do(ctx, req)
 	if err != nil {
 		return err
 	}
+	defer cancel()
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("%s", resp.Status)
+		return newResponseError(resp)
 	}
 
 	return nil
 }
+
+// Checkout closes the basket and returns the order placed with its content
+func (c *CheckoutClient) Checkout(ctx context.Context, basketId string) (*responses.OrderResponse, error) {
+	if strings.TrimSpace(basketId) == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v%d/baskets/%s/checkout", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, cancel, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, newResponseError(resp)
+	}
+
+	return readOrder(resp)
+}
+
+func (c *CheckoutClient) GetOrder(ctx context.Context, orderId string) (*responses.OrderResponse, error) {
+	if strings.TrimSpace(orderId) == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v%d/orders/%s", c.serverUrl, c.apiVersion, strings.TrimSpace(orderId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, cancel, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newResponseError(resp)
+	}
+
+	return readOrder(resp)
+}
+
+// PayOrder takes again the payment of an order whose payment failed
+func (c *CheckoutClient) PayOrder(ctx context.Context, orderId string) (*responses.OrderResponse, error) {
+	return c.postOrder(ctx, orderId, "payment")
+}
+
+// RefundOrder refunds the payment captured of an order
+func (c *CheckoutClient) RefundOrder(ctx context.Context, orderId string) (*responses.OrderResponse, error) {
+	return c.postOrder(ctx, orderId, "refund")
+}
+
+// postOrder posts to an action of the order and returns the order changed
+func (c *CheckoutClient) postOrder(ctx context.Context, orderId, action string) (*responses.OrderResponse, error) {
+	if strings.TrimSpace(orderId) == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v%d/orders/%s/%s", c.serverUrl, c.apiVersion, strings.TrimSpace(orderId), action), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, cancel, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newResponseError(resp)
+	}
+
+	return readOrder(resp)
+}
+
+func readOrder(resp *http.Response) (*responses.OrderResponse, error) {
+	if resp.Body == nil {
+		return nil, errors.New("empty response")
+	}
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching response body: %v", err)
+	}
+
+	o := responses.OrderResponse{}
+	err = json.Unmarshal(responseBody, &o)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching response body: %v", err)
+	}
+
+	return &o, nil
+}
@@ -1,14 +1,19 @@
 package cli
 
 import (
+	"context"
+	goerrors "errors"
 	"fmt"
 	"github.com/alfcope/checkouttest/api/responses"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
 	"net/http"
 	"testing"
+	"time"
 )
 
 type CheckoutClientTestSuite struct {
@@ -29,6 +34,7 @@ func (suite *CheckoutClientTestSuite) SetupSuite() {
 
 func (suite *CheckoutClientTestSuite) TearDownTest() {
 	suite.server.StubResponse(0, nil)
+	suite.server.StubDelay(0)
 }
 
 func (suite *CheckoutClientTestSuite) TestCreateBasketDuplicatedId() {
@@ -36,7 +42,7 @@ func (suite *CheckoutClientTestSuite) TestCreateBasketDuplicatedId() {
 	suite.server.StubResponse(responses.GetStatusByError(errors.NewPrimaryKeyError(uuid.New().String())), nil)
 
 	// When
-	b, err := suite.client.AddBasket()
+	b, err := suite.client.AddBasket(context.Background())
 
 	// Then
 	suite.Equal("", b)
@@ -49,20 +55,36 @@ func (suite *CheckoutClientTestSuite) TestCreateBasket() {
 	suite.server.StubResponse(http.StatusCreated, responses.NewBasketResponse{Id: basketId})
 
 	// When
-	idResponse, err := suite.client.AddBasket()
+	idResponse, err := suite.client.AddBasket(context.Background())
 
 	// Then
 	suite.Nil(err)
 	suite.Equal(basketId, idResponse)
 }
 
+func (suite *CheckoutClientTestSuite) TestCreateBasketInCurrencyNotAccepted() {
+	// Given
+	suite.server.StubResponse(http.StatusUnprocessableEntity, nil)
+
+	// When
+	idResponse, err := suite.client.AddBasketInCurrency(context.Background(), "JPY")
+
+	// Then
+	suite.Equal("", idResponse)
+	if responseError, ok := err.(*ResponseError); ok {
+		suite.True(responseError.IsValidation())
+	} else {
+		suite.T().Errorf("Wanted response error, got %T", err)
+	}
+}
+
 func (suite *CheckoutClientTestSuite) TestAddItemBasketEmptyBasketId() {
 	// Given
 	basketId := "    "
 	productCode := "TSHIRT"
 
 	// When
-	err := suite.client.AddItem(basketId, productCode)
+	err := suite.client.AddItem(context.Background(), basketId, productCode)
 
 	// Then
 	suite.EqualError(err, "invalid request")
@@ -74,7 +96,7 @@ func (suite *CheckoutClientTestSuite) TestAddItemBasketEmptyProductCode() {
 	productCode := "    "
 
 	// When
-	err := suite.client.AddItem(basketId, productCode)
+	err := suite.client.AddItem(context.Background(), basketId, productCode)
 
 	// Then
 	suite.EqualError(err, "invalid request")
@@ -87,7 +109,7 @@ func (suite *CheckoutClientTestSuite) TestAddItemBasketNotFoundError() {
 	suite.server.StubResponse(http.StatusNotFound, nil)
 
 	// When
-	err := suite.client.AddItem(basketId, productCode)
+	err := suite.client.AddItem(context.Background(), basketId, productCode)
 
 	// Then
 	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
@@ -100,7 +122,29 @@ func (suite *CheckoutClientTestSuite) TestAddItemBasket() {
 	suite.server.StubResponse(http.StatusCreated, nil)
 
 	// When
-	err := suite.client.AddItem(basketId, productCode)
+	err := suite.client.AddItem(context.Background(), basketId, productCode)
+
+	// Then
+	suite.Nil(err)
+}
+
+func (suite *CheckoutClientTestSuite) TestRemoveItemOutOfBasket() {
+	// Given
+	suite.server.StubResponse(http.StatusNotFound, nil)
+
+	// When
+	err := suite.client.RemoveItem(context.Background(), uuid.New().String(), "TSHIRT")
+
+	// Then
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
+}
+
+func (suite *CheckoutClientTestSuite) TestRemoveItem() {
+	// Given
+	suite.server.StubResponse(http.StatusNoContent, nil)
+
+	// When
+	err := suite.client.RemoveItem(context.Background(), uuid.New().String(), "TSHIRT")
 
 	// Then
 	suite.Nil(err)
@@ -111,7 +155,7 @@ func (suite *CheckoutClientTestSuite) TestGetBasketPriceNotFoundError() {
 	suite.server.StubResponse(http.StatusNotFound, nil)
 
 	// When
-	price, err := suite.client.GetPrice(uuid.New().String())
+	price, err := suite.client.GetPrice(context.Background(), uuid.New().String())
 
 	// Then
 	suite.Equal(float64(-1), price)
@@ -124,19 +168,49 @@ func (suite *CheckoutClientTestSuite) TestGetBasketPrice() {
 	suite.server.StubResponse(http.StatusOK, responses.PriceBasketResponse{Total: float64(6580) / 100})
 
 	// When
-	price, err := suite.client.GetPrice(uuid.New().String())
+	price, err := suite.client.GetPrice(context.Background(), uuid.New().String())
 
 	// Then
 	suite.Nil(err)
 	suite.Equal(float64(6580)/100, price)
 }
 
+func (suite *CheckoutClientTestSuite) TestGetReceipt() {
+	// Given
+	suite.server.StubResponse(http.StatusOK, responses.ReceiptResponse{Region: "es", Net: 10, Tax: 2.1, Gross: 12.1,
+		Taxes: []responses.TaxLineResponse{{Rate: 21, Net: 10, Tax: 2.1}}})
+
+	// When
+	receipt, err := suite.client.GetReceipt(context.Background(), uuid.New().String(), "es")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(12.1, receipt.Gross)
+	suite.Len(receipt.Taxes, 1)
+}
+
+func (suite *CheckoutClientTestSuite) TestGetReceiptUnknownRegion() {
+	// Given
+	suite.server.StubResponse(http.StatusUnprocessableEntity, nil)
+
+	// When
+	receipt, err := suite.client.GetReceipt(context.Background(), uuid.New().String(), "fr")
+
+	// Then
+	suite.Nil(receipt)
+	if responseError, ok := err.(*ResponseError); ok {
+		suite.True(responseError.IsValidation())
+	} else {
+		suite.T().Errorf("Wanted response error, got %T", err)
+	}
+}
+
 func (suite *CheckoutClientTestSuite) TestDeleteBasketNotFoundError() {
 	// Given
 	suite.server.StubResponse(http.StatusNotFound, nil)
 
 	// When
-	err := suite.client.DeleteBasket(uuid.New().String())
+	err := suite.client.DeleteBasket(context.Background(), uuid.New().String())
 
 	// Then
 	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
@@ -147,8 +221,182 @@ func (suite *CheckoutClientTestSuite) TestDeleteBasket() {
 	suite.server.StubResponse(http.StatusNoContent, nil)
 
 	// When
-	err := suite.client.DeleteBasket(uuid.New().String())
+	err := suite.client.DeleteBasket(context.Background(), uuid.New().String())
+
+	// Then
+	suite.Nil(err)
+}
+
+func (suite *CheckoutClientTestSuite) TestGetBasketNotFoundError() {
+	// Given
+	suite.server.StubResponse(http.StatusNotFound, nil)
+
+	// When
+	basket, err := suite.client.GetBasket(context.Background(), uuid.New().String())
+
+	// Then
+	suite.Nil(basket)
+	if responseError, ok := err.(*ResponseError); ok {
+		suite.True(responseError.IsNotFound())
+	} else {
+		suite.T().Errorf("Wanted response error, got %T", err)
+	}
+}
+
+func (suite *CheckoutClientTestSuite) TestGetBasket() {
+	// Given
+	basketId := uuid.New().String()
+	suite.server.StubResponse(http.StatusOK, responses.BasketResponse{Id: basketId,
+		Lines: []responses.LineResponse{{Code: "TSHIRT", Name: "T-Shirt", Price: 2000, Amount: 2}}})
+
+	// When
+	basket, err := suite.client.GetBasket(context.Background(), basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(basketId, basket.Id)
+	suite.Equal(1, len(basket.Lines))
+	suite.Equal(2, basket.Lines[0].Amount)
+}
+
+func (suite *CheckoutClientTestSuite) TestCheckoutClosedBasket() {
+	// Given
+	suite.server.StubResponse(http.StatusConflict, nil)
+
+	// When
+	order, err := suite.client.Checkout(context.Background(), uuid.New().String())
+
+	// Then
+	suite.Nil(order)
+	if responseError, ok := err.(*ResponseError); ok {
+		suite.True(responseError.IsConflict())
+		suite.False(responseError.IsValidation())
+	} else {
+		suite.T().Errorf("Wanted response error, got %T", err)
+	}
+}
+
+func (suite *CheckoutClientTestSuite) TestCheckout() {
+	// Given
+	basketId := uuid.New().String()
+	orderId := uuid.New().String()
+	suite.server.StubResponse(http.StatusCreated, responses.OrderResponse{Id: orderId, BasketId: basketId, Total: 40,
+		Lines: []responses.LineResponse{{Code: "TSHIRT", Name: "T-Shirt", Price: 2000, Amount: 2}}})
+
+	// When
+	order, err := suite.client.Checkout(context.Background(), basketId)
 
 	// Then
 	suite.Nil(err)
+	suite.Equal(orderId, order.Id)
+	suite.Equal(basketId, order.BasketId)
+	suite.Equal(float64(40), order.Total)
+	suite.Equal(1, len(order.Lines))
+}
+
+func (suite *CheckoutClientTestSuite) TestGetOrderNotFoundError() {
+	// Given
+	suite.server.StubResponse(http.StatusNotFound, nil)
+
+	// When
+	order, err := suite.client.GetOrder(context.Background(), uuid.New().String())
+
+	// Then
+	suite.Nil(order)
+	if responseError, ok := err.(*ResponseError); ok {
+		suite.True(responseError.IsNotFound())
+	} else {
+		suite.T().Errorf("Wanted response error, got %T", err)
+	}
+}
+
+func (suite *CheckoutClientTestSuite) TestPayOrder() {
+	// Given
+	orderId := uuid.New().String()
+	suite.server.StubResponse(http.StatusOK, responses.OrderResponse{Id: orderId,
+		Payment: responses.PaymentResponse{Status: model.PaymentCaptured}})
+
+	// When
+	order, err := suite.client.PayOrder(context.Background(), orderId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(orderId, order.Id)
+	suite.Equal(model.PaymentCaptured, order.Payment.Status)
+}
+
+func (suite *CheckoutClientTestSuite) TestRefundOrderNotCaptured() {
+	// Given
+	suite.server.StubResponse(http.StatusConflict, nil)
+
+	// When
+	order, err := suite.client.RefundOrder(context.Background(), uuid.New().String())
+
+	// Then
+	suite.Nil(order)
+	if responseError, ok := err.(*ResponseError); ok {
+		suite.True(responseError.IsConflict())
+	} else {
+		suite.T().Errorf("Wanted response error, got %T", err)
+	}
+}
+
+func (suite *CheckoutClientTestSuite) TestGetBasketPriceDeadlineExceeded() {
+	// Given
+	suite.server.StubResponse(http.StatusOK, responses.PriceBasketResponse{Total: float64(6580) / 100})
+	suite.server.StubDelay(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// When
+	price, err := suite.client.GetPrice(ctx, uuid.New().String())
+
+	// Then
+	suite.Equal(float64(-1), price)
+	suite.True(goerrors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+}
+
+func TestRequestIdPropagation(t *testing.T) {
+	server, _ := newInMemoryServer(t)
+	defer server.Close()
+	client := NewCheckoutClient(server.URL, 1)
+
+	trace := logging.NewTraceContext()
+	ctx := logging.WithTraceContext(logging.WithRequestId(context.Background(), "req-1"), trace)
+
+	_, err := client.GetPrice(ctx, uuid.New().String())
+
+	responseError, ok := err.(*ResponseError)
+	if !ok {
+		t.Fatalf("Expected a response error but got %v", err)
+	}
+	if !responseError.IsNotFound() {
+		t.Errorf("Expected not found but got %v", responseError)
+	}
+	if responseError.RequestId != "req-1" {
+		t.Errorf("Expected request id req-1 but got %q", responseError.RequestId)
+	}
+	if responseError.Message == "" {
+		t.Errorf("Expected the server error message")
+	}
+}
+
+func TestRequestIdGeneratedPerCall(t *testing.T) {
+	server := newFlakyServer(http.StatusServiceUnavailable)
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithRetryPolicy(fastRetries))
+
+	_, err := client.GetPrice(context.Background(), "b1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	first, second := server.requests[0].Header, server.requests[1].Header
+	if first.Get(logging.RequestIdHeader) == "" || first.Get(logging.RequestIdHeader) != second.Get(logging.RequestIdHeader) {
+		t.Errorf("Expected the same request id in every attempt")
+	}
+	if _, ok := logging.ParseTraceparent(first.Get(logging.TraceparentHeader)); !ok {
+		t.Errorf("Expected a valid traceparent but got %q", first.Get(logging.TraceparentHeader))
+	}
 }
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrInvalidRequest is returned when the request parameters are rejected before reaching the server
+var ErrInvalidRequest = errors.New("invalid request")
+
+// Largest error body read to find out the error message
+const maxErrorBodySize = 64 << 10
+
+// ResponseError is returned when the server answers with an unexpected http status
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	// Error message sent by the server, if any
+	Message string
+	// Id of the failed request, to be quoted when reporting the error
+	RequestId string
+}
+
+func newResponseError(resp *http.Response) *ResponseError {
+	responseError := &ResponseError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RequestId:  resp.Header.Get(logging.RequestIdHeader),
+	}
+
+	if resp.Body != nil {
+		var body responses.ErrorResponse
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBodySize)).Decode(&body); err == nil {
+			responseError.Message = body.Error
+			if responseError.RequestId == "" {
+				responseError.RequestId = body.RequestId
+			}
+		}
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+	}
+
+	// Servers not echoing the id are reported with the id that was sent
+	if responseError.RequestId == "" && resp.Request != nil {
+		responseError.RequestId = resp.Request.Header.Get(logging.RequestIdHeader)
+	}
+
+	return responseError
+}
+
+func (e *ResponseError) Error() string {
+	return e.Status
+}
+
+// IsNotFound reports whether the server could not find the requested resource
+func (e *ResponseError) IsNotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports whether the request conflicts with the state of the resource, like adding
+// products to a basket already checked out
+func (e *ResponseError) IsConflict() bool {
+	return e.StatusCode == http.StatusConflict
+}
+
+// IsValidation reports whether the server rejected the request as invalid
+func (e *ResponseError) IsValidation() bool {
+	return e.StatusCode >= http.StatusBadRequest && e.StatusCode < http.StatusInternalServerError &&
+		e.StatusCode != http.StatusNotFound && e.StatusCode != http.StatusConflict
+}
+
+// IsServerError reports whether the server failed processing the request
+func (e *ResponseError) IsServerError() bool {
+	return e.StatusCode >= http.StatusInternalServerError
+}
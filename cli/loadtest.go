@@ -0,0 +1,341 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alfcope/checkouttest/model"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Endpoints measured by the load test
+const (
+	EndpointCreate = "create"
+	EndpointAdd    = "add"
+	EndpointPrice  = "price"
+	EndpointShow   = "show"
+	EndpointDelete = "delete"
+)
+
+type WeightedProduct struct {
+	Product model.Product
+	Weight  int
+}
+
+// OperationMix holds the relative weight of every operation a shopper runs against its basket
+type OperationMix struct {
+	Add   int
+	Price int
+	Show  int
+}
+
+type LoadTestConfig struct {
+	// Number of concurrent virtual shoppers
+	Shoppers int
+	// Shoppers sharing the same basket, used to put the basket lock under contention
+	ShoppersPerBasket int
+	// Baskets created, filled, verified and deleted by every group of shoppers
+	Baskets int
+	// Operations run by every shopper on each basket
+	OperationsPerBasket int
+
+	Mix        OperationMix
+	Products   []WeightedProduct
+	Promotions []model.Promotion
+
+	Seed int64
+}
+
+type EndpointReport struct {
+	Requests int
+	Errors   int
+
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+func (e *EndpointReport) ErrorRate() float64 {
+	if e.Requests == 0 {
+		return 0
+	}
+	return float64(e.Errors) / float64(e.Requests)
+}
+
+type LoadTestReport struct {
+	Elapsed   time.Duration
+	Endpoints map[string]*EndpointReport
+
+	Baskets         int
+	PriceMismatches int
+}
+
+func (r *LoadTestReport) Requests() int {
+	total := 0
+	for _, e := range r.Endpoints {
+		total += e.Requests
+	}
+	return total
+}
+
+// Throughput returns the number of requests per second
+func (r *LoadTestReport) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests()) / r.Elapsed.Seconds()
+}
+
+// EndpointNames returns the measured endpoints sorted by name
+func (r *LoadTestReport) EndpointNames() []string {
+	names := make([]string, 0, len(r.Endpoints))
+	for name := range r.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *LoadTestConfig) validate() error {
+	if c.Shoppers <= 0 || c.ShoppersPerBasket <= 0 || c.Baskets <= 0 || c.OperationsPerBasket < 0 {
+		return errors.New("shoppers, shoppers per basket and baskets must be positive")
+	}
+	if c.Shoppers%c.ShoppersPerBasket != 0 {
+		return fmt.Errorf("%d shoppers can not be split in groups of %d", c.Shoppers, c.ShoppersPerBasket)
+	}
+	if c.Mix.Add < 0 || c.Mix.Price < 0 || c.Mix.Show < 0 || c.Mix.Add+c.Mix.Price+c.Mix.Show == 0 {
+		return errors.New("invalid operation mix")
+	}
+
+	totalWeight := 0
+	for _, p := range c.Products {
+		if p.Weight < 0 {
+			return fmt.Errorf("invalid weight for product %v", p.Product.Code)
+		}
+		totalWeight += p.Weight
+	}
+	if totalWeight == 0 {
+		return errors.New("no products available")
+	}
+
+	return nil
+}
+
+// LoadTest runs groups of concurrent virtual shoppers against the server. Every group works on
+// one basket at a time and, once all its shoppers are done, checks the server price against the
+// price computed locally with the same promotions.
+func (c *CheckoutClient) LoadTest(ctx context.Context, config LoadTestConfig) (*LoadTestReport, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	stats := newLoadStats()
+	mismatches := 0
+	mismatchesMux := sync.Mutex{}
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	groups := config.Shoppers / config.ShoppersPerBasket
+	for g := 0; g < groups; g++ {
+		wg.Add(1)
+		go func(group int) {
+			defer wg.Done()
+
+			for b := 0; b < config.Baskets && ctx.Err() == nil; b++ {
+				seed := config.Seed + int64(group*config.Baskets+b)*int64(config.ShoppersPerBasket)
+				if !c.runBasket(ctx, config, seed, stats) {
+					mismatchesMux.Lock()
+					mismatches++
+					mismatchesMux.Unlock()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	return &LoadTestReport{
+		Elapsed:         time.Since(start),
+		Endpoints:       stats.reports(),
+		Baskets:         groups * config.Baskets,
+		PriceMismatches: mismatches,
+	}, nil
+}
+
+// runBasket drives one basket through its whole life and reports whether the final price matched
+func (c *CheckoutClient) runBasket(ctx context.Context, config LoadTestConfig, seed int64, stats *loadStats) bool {
+	var id string
+	err := stats.measure(EndpointCreate, func() (err error) {
+		id, err = c.AddBasket(ctx)
+		return err
+	})
+	if err != nil {
+		// Nothing to verify when the basket could not be created
+		return true
+	}
+
+	expected := model.NewBasket(id)
+	exclusive := config.ShoppersPerBasket == 1
+	consistent := true
+	consistentMux := sync.Mutex{}
+
+	var wg sync.WaitGroup
+	for s := 0; s < config.ShoppersPerBasket; s++ {
+		wg.Add(1)
+		go func(rnd *rand.Rand) {
+			defer wg.Done()
+
+			for i := 0; i < config.OperationsPerBasket && ctx.Err() == nil; i++ {
+				switch pickOperation(rnd, config.Mix) {
+				case EndpointAdd:
+					p := pickProduct(rnd, config.Products)
+					err := stats.measure(EndpointAdd, func() error {
+						return c.AddItem(ctx, id, string(p.Code))
+					})
+					if err == nil {
+						_ = expected.AddProduct(p)
+					}
+
+				case EndpointPrice:
+					var total float64
+					err := stats.measure(EndpointPrice, func() (err error) {
+						total, err = c.GetPrice(ctx, id)
+						return err
+					})
+					// Intermediate prices can only be checked when nobody else changes the basket
+					if err == nil && exclusive && !samePrice(total, expected.CalculatePrice(ctx, config.Promotions)) {
+						consistentMux.Lock()
+						consistent = false
+						consistentMux.Unlock()
+					}
+
+				case EndpointShow:
+					_ = stats.measure(EndpointShow, func() error {
+						_, err := c.GetBasket(ctx, id)
+						return err
+					})
+				}
+			}
+		}(rand.New(rand.NewSource(seed + int64(s))))
+	}
+	wg.Wait()
+
+	var total float64
+	err = stats.measure(EndpointPrice, func() (err error) {
+		total, err = c.GetPrice(ctx, id)
+		return err
+	})
+	if err == nil && !samePrice(total, expected.CalculatePrice(ctx, config.Promotions)) {
+		consistent = false
+	}
+
+	_ = stats.measure(EndpointDelete, func() error {
+		return c.DeleteBasket(ctx, id)
+	})
+
+	return consistent
+}
+
+func pickOperation(rnd *rand.Rand, mix OperationMix) string {
+	n := rnd.Intn(mix.Add + mix.Price + mix.Show)
+	switch {
+	case n < mix.Add:
+		return EndpointAdd
+	case n < mix.Add+mix.Price:
+		return EndpointPrice
+	}
+	return EndpointShow
+}
+
+func pickProduct(rnd *rand.Rand, products []WeightedProduct) model.Product {
+	total := 0
+	for _, p := range products {
+		total += p.Weight
+	}
+
+	n := rnd.Intn(total)
+	for _, p := range products {
+		if n < p.Weight {
+			return p.Product
+		}
+		n -= p.Weight
+	}
+
+	return products[len(products)-1].Product
+}
+
+func samePrice(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// loadStats collects the latencies and errors of every endpoint
+type loadStats struct {
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	mux       sync.Mutex
+}
+
+func newLoadStats() *loadStats {
+	return &loadStats{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+}
+
+func (s *loadStats) measure(endpoint string, call func() error) error {
+	start := time.Now()
+	err := call()
+	elapsed := time.Since(start)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.latencies[endpoint] = append(s.latencies[endpoint], elapsed)
+	if err != nil {
+		s.errors[endpoint]++
+	}
+
+	return err
+}
+
+func (s *loadStats) reports() map[string]*EndpointReport {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	reports := make(map[string]*EndpointReport, len(s.latencies))
+	for endpoint, latencies := range s.latencies {
+		sorted := make([]time.Duration, len(latencies))
+		copy(sorted, latencies)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		reports[endpoint] = &EndpointReport{
+			Requests: len(sorted),
+			Errors:   s.errors[endpoint],
+			P50:      percentile(sorted, 50),
+			P90:      percentile(sorted, 90),
+			P99:      percentile(sorted, 99),
+			Max:      sorted[len(sorted)-1],
+		}
+	}
+
+	return reports
+}
+
+// percentile uses the nearest rank method over sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(float64(p)/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
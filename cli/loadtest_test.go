@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/stretchr/testify/suite"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type LoadTestTestSuite struct {
+	suite.Suite
+
+	client *CheckoutClient
+	server *httptest.Server
+	ds     *datasource.InMemoryDatasource
+}
+
+func TestLoadTestSuite(t *testing.T) {
+	suite.Run(t, new(LoadTestTestSuite))
+}
+
+func (suite *LoadTestTestSuite) SetupSuite() {
+	suite.server, suite.ds = newInMemoryServer(suite.T())
+	suite.client = NewCheckoutClient(suite.server.URL, 1)
+}
+
+func (suite *LoadTestTestSuite) TearDownSuite() {
+	suite.server.Close()
+}
+
+func (suite *LoadTestTestSuite) loadTestConfig(shoppers, shoppersPerBasket int) LoadTestConfig {
+	var products []WeightedProduct
+	for i, code := range []model.ProductCode{"VOUCHER", "TSHIRT", "MUG"} {
+		p, err := suite.ds.GetProduct(context.Background(), code)
+		if err != nil {
+			suite.T().Fatalf("Error getting product: %v", err)
+		}
+		products = append(products, WeightedProduct{Product: p, Weight: 3 - i})
+	}
+
+	return LoadTestConfig{
+		Shoppers:            shoppers,
+		ShoppersPerBasket:   shoppersPerBasket,
+		Baskets:             3,
+		OperationsPerBasket: 10,
+		Mix:                 OperationMix{Add: 6, Price: 3, Show: 1},
+		Products:            products,
+		Promotions:          suite.ds.GetPromotions(context.Background()),
+		Seed:                1,
+	}
+}
+
+func (suite *LoadTestTestSuite) TestLoadTestExclusiveBaskets() {
+	// Given
+	config := suite.loadTestConfig(4, 1)
+
+	// When
+	report, err := suite.client.LoadTest(context.Background(), config)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(12, report.Baskets)
+	suite.Equal(0, report.PriceMismatches)
+	suite.Equal(12, report.Endpoints[EndpointCreate].Requests)
+	suite.Equal(12, report.Endpoints[EndpointDelete].Requests)
+	for _, name := range report.EndpointNames() {
+		suite.Equal(0, report.Endpoints[name].Errors, "endpoint %v", name)
+	}
+	suite.True(report.Throughput() > 0)
+}
+
+func (suite *LoadTestTestSuite) TestLoadTestSharedBaskets() {
+	// Given
+	config := suite.loadTestConfig(6, 3)
+
+	// When
+	report, err := suite.client.LoadTest(context.Background(), config)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(6, report.Baskets)
+	suite.Equal(0, report.PriceMismatches)
+}
+
+func (suite *LoadTestTestSuite) TestLoadTestInvalidConfig() {
+	// Given
+	config := suite.loadTestConfig(5, 2)
+
+	// When
+	_, err := suite.client.LoadTest(context.Background(), config)
+
+	// Then
+	suite.NotNil(err)
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	if p := percentile(latencies, 50); p != 50*time.Millisecond {
+		t.Errorf("Wanted p50 50ms but got %v", p)
+	}
+	if p := percentile(latencies, 99); p != 99*time.Millisecond {
+		t.Errorf("Wanted p99 99ms but got %v", p)
+	}
+	if p := percentile(latencies[:1], 90); p != time.Millisecond {
+		t.Errorf("Wanted p90 1ms but got %v", p)
+	}
+}
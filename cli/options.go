@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"crypto/tls"
+	"github.com/alfcope/checkouttest/pkg/tlsconfig"
+	"net/http"
+	"time"
+)
+
+// Header used to mark POST requests as safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Option configures a CheckoutClient
+type Option func(*CheckoutClient)
+
+// RetryPolicy controls how failed requests are retried. Only idempotent requests, or POST
+// requests carrying an idempotency key, are retried after a 502, a 503 or a transport timeout.
+// The client does not make up the keys, the caller sets them with WithIdempotencyKey when the
+// server applies a key only once.
+type RetryPolicy struct {
+	// Total number of attempts, including the first one
+	MaxAttempts int
+	// Upper bound of the first backoff, doubled on every attempt
+	BaseDelay time.Duration
+	// Upper bound of any backoff
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy retries twice with a jittered backoff starting at 100ms
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// WithHttpClient replaces the http client used to send the requests
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(c *CheckoutClient) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport sets the transport of the http client
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *CheckoutClient) {
+		c.transport = transport
+	}
+}
+
+// WithTLSConfig sets the tls configuration of the transport. It is only applied when the
+// transport is an *http.Transport.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *CheckoutClient) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// WithTLSFiles trusts the CA certificates of caFile and presents the client certificate of
+// certFile and keyFile, reloaded when they change. Empty paths are skipped. An error loading
+// the files is returned by every call of the client.
+func WithTLSFiles(caFile, certFile, keyFile string) Option {
+	return func(c *CheckoutClient) {
+		c.tlsConfig, c.err = tlsconfig.NewClientConfig(caFile, certFile, keyFile)
+	}
+}
+
+// WithTimeout sets the timeout of every attempt of the calls whose context has no deadline. Zero
+// disables it.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *CheckoutClient) {
+		c.timeout = timeout
+	}
+}
+
+// WithHeader adds a header, such as Authorization, to every request
+func WithHeader(key, value string) Option {
+	return func(c *CheckoutClient) {
+		c.headers.Set(key, value)
+	}
+}
+
+// WithAPIKey authenticates every request with a static api key
+func WithAPIKey(key string) Option {
+	return WithHeader("X-API-Key", key)
+}
+
+// WithBearerToken authenticates every request with a jwt
+func WithBearerToken(token string) Option {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithUserAgent sets the User-Agent header of every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *CheckoutClient) {
+		c.headers.Set("User-Agent", userAgent)
+	}
+}
+
+// WithRetryPolicy enables retries
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *CheckoutClient) {
+		c.retryPolicy = &policy
+	}
+}
@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer answers with the queued status codes before answering with success
+type flakyServer struct {
+	server *httptest.Server
+
+	mux      sync.Mutex
+	failures []int
+	requests []*http.Request
+}
+
+func newFlakyServer(failures ...int) *flakyServer {
+	f := &flakyServer{failures: failures}
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mux.Lock()
+		f.requests = append(f.requests, r)
+		var status int
+		if len(f.failures) > 0 {
+			status, f.failures = f.failures[0], f.failures[1:]
+		}
+		f.mux.Unlock()
+
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(responses.NewBasketResponse{Id: "b1"})
+		default:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(responses.PriceBasketResponse{Total: 10})
+		}
+	}))
+
+	return f
+}
+
+func (f *flakyServer) attempts() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return len(f.requests)
+}
+
+type ClientOptionsTestSuite struct {
+	suite.Suite
+}
+
+func TestClientOptionsSuite(t *testing.T) {
+	suite.Run(t, new(ClientOptionsTestSuite))
+}
+
+var fastRetries = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func (suite *ClientOptionsTestSuite) TestRetryIdempotentRequest() {
+	// Given
+	server := newFlakyServer(http.StatusServiceUnavailable, http.StatusBadGateway)
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithRetryPolicy(fastRetries))
+
+	// When
+	price, err := client.GetPrice(context.Background(), "b1")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(float64(10), price)
+	suite.Equal(3, server.attempts())
+}
+
+func (suite *ClientOptionsTestSuite) TestRetryGivesUp() {
+	// Given
+	server := newFlakyServer(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithRetryPolicy(fastRetries))
+
+	// When
+	_, err := client.GetPrice(context.Background(), "b1")
+
+	// Then
+	suite.EqualError(err, "503 Service Unavailable")
+	suite.Equal(3, server.attempts())
+}
+
+// hangingServer does not answer the first request until it is canceled, it answers the next ones
+func hangingServer(attempts *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(attempts, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(responses.PriceBasketResponse{Total: 10})
+	}))
+}
+
+func (suite *ClientOptionsTestSuite) TestRetryHungAttempt() {
+	// Given
+	var attempts int32
+	server := hangingServer(&attempts)
+	defer server.Close()
+	client := NewCheckoutClient(server.URL, 1, WithRetryPolicy(fastRetries), WithTimeout(50*time.Millisecond))
+
+	// When
+	price, err := client.GetPrice(context.Background(), "b1")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(float64(10), price)
+	suite.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+
+func (suite *ClientOptionsTestSuite) TestRetryHungAttemptWithinDeadline() {
+	// Given
+	var attempts int32
+	server := hangingServer(&attempts)
+	defer server.Close()
+	client := NewCheckoutClient(server.URL, 1, WithRetryPolicy(fastRetries))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+	defer cancel()
+
+	// When
+	price, err := client.GetPrice(ctx, "b1")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(float64(10), price)
+	suite.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+
+func (suite *ClientOptionsTestSuite) TestNoRetryOnClientErrors() {
+	// Given
+	server := newFlakyServer(http.StatusNotFound)
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithRetryPolicy(fastRetries))
+
+	// When
+	_, err := client.GetPrice(context.Background(), "b1")
+
+	// Then
+	suite.NotNil(err)
+	suite.Equal(1, server.attempts())
+}
+
+func (suite *ClientOptionsTestSuite) TestNoRetryPostWithoutIdempotencyKey() {
+	// Given
+	server := newFlakyServer(http.StatusServiceUnavailable)
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithRetryPolicy(fastRetries))
+
+	// When
+	_, err := client.AddBasket(context.Background())
+	itemErr := client.AddItem(context.Background(), "b1", "MUG")
+
+	// Then
+	suite.NotNil(err)
+	suite.Nil(itemErr)
+	suite.Equal(2, server.attempts(), "The POST calls should be sent once")
+}
+
+func (suite *ClientOptionsTestSuite) TestRetryPostWithIdempotencyKey() {
+	// Given
+	server := newFlakyServer(http.StatusServiceUnavailable)
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithRetryPolicy(fastRetries))
+
+	// When
+	err := client.AddItem(WithIdempotencyKey(context.Background(), "key-1"), "b1", "MUG")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(2, server.attempts())
+	suite.Equal("key-1", server.requests[0].Header.Get(IdempotencyKeyHeader))
+	suite.Equal("key-1", server.requests[1].Header.Get(IdempotencyKeyHeader))
+}
+
+func (suite *ClientOptionsTestSuite) TestNoRetryRemoveItem() {
+	// Given
+	server := newFlakyServer(http.StatusServiceUnavailable)
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithRetryPolicy(fastRetries))
+
+	// When
+	err := client.RemoveItem(context.Background(), "b1", "MUG")
+
+	// Then
+	suite.EqualError(err, "503 Service Unavailable")
+	suite.Equal(1, server.attempts(), "A retry could remove a second unit")
+}
+
+func (suite *ClientOptionsTestSuite) TestHeaders() {
+	// Given
+	server := newFlakyServer()
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithUserAgent("till/1.0"),
+		WithHeader("Authorization", "Bearer token"))
+
+	// When
+	_, err := client.GetPrice(context.Background(), "b1")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal("till/1.0", server.requests[0].Header.Get("User-Agent"))
+	suite.Equal("Bearer token", server.requests[0].Header.Get("Authorization"))
+}
+
+func (suite *ClientOptionsTestSuite) TestCustomTransport() {
+	// Given
+	server := newFlakyServer()
+	defer server.server.Close()
+	transport := &countingTransport{next: http.DefaultTransport}
+	client := NewCheckoutClient(server.server.URL, 1, WithTransport(transport))
+
+	// When
+	_, err := client.GetPrice(context.Background(), "b1")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(1, transport.count)
+}
+
+func TestBackoffBounds(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	for attempt := 1; attempt < 10; attempt++ {
+		if d := policy.backoff(attempt); d < 0 || d >= 50*time.Millisecond {
+			t.Errorf("Backoff %v out of bounds for attempt %v", d, attempt)
+		}
+	}
+}
+
+type countingTransport struct {
+	next  http.RoundTripper
+	count int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.count++
+	return t.next.RoundTrip(r)
+}
+
+func (suite *ClientOptionsTestSuite) TestTLSFilesError() {
+	// Given
+	server := newFlakyServer()
+	defer server.server.Close()
+	client := NewCheckoutClient(server.server.URL, 1, WithTLSFiles("missing-ca.pem", "", ""))
+
+	// When
+	_, err := client.GetPrice(context.Background(), "b1")
+
+	// Then
+	suite.NotNil(err)
+	suite.Equal(0, server.attempts())
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Operations supported in a replay session file
+const (
+	ReplayCreate = "create"
+	ReplayAdd    = "add"
+	ReplayPrice  = "price"
+	ReplayDelete = "delete"
+)
+
+// ReplayOperation is a single line of a replay session file. Baskets are referenced by
+// a symbolic name that is bound to the real basket id when the create operation runs.
+type ReplayOperation struct {
+	Op     string `json:"op"`
+	Basket string `json:"basket"`
+	Code   string `json:"code,omitempty"`
+	Qty    int    `json:"qty,omitempty"`
+
+	// Expected basket total, only checked by price operations
+	Expect *float64 `json:"expect,omitempty"`
+	// Expected http status when the operation is supposed to fail
+	ExpectStatus int `json:"expectStatus,omitempty"`
+}
+
+type ReplayResult struct {
+	Line      int
+	Operation ReplayOperation
+	Passed    bool
+	Err       error
+}
+
+type ReplayReport struct {
+	Results []ReplayResult
+	Passed  int
+	Failed  int
+}
+
+func (r *ReplayReport) Success() bool {
+	return r.Failed == 0
+}
+
+// Replay executes the operations read from a jsonl session. Failing operations are recorded
+// in the report and do not stop the session; a malformed line does.
+func (c *CheckoutClient) Replay(ctx context.Context, session io.Reader) (*ReplayReport, error) {
+	report := &ReplayReport{}
+	baskets := make(map[string]string)
+
+	scanner := bufio.NewScanner(session)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var op ReplayOperation
+		if err := json.Unmarshal([]byte(text), &op); err != nil {
+			return report, fmt.Errorf("line %d: invalid operation: %v", lineNumber, err)
+		}
+
+		err := c.replayOperation(ctx, op, baskets)
+		err = checkExpectedStatus(op, err)
+
+		result := ReplayResult{
+			Line:      lineNumber,
+			Operation: op,
+			Passed:    err == nil,
+			Err:       err,
+		}
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+func (c *CheckoutClient) replayOperation(ctx context.Context, op ReplayOperation, baskets map[string]string) error {
+	if strings.TrimSpace(op.Basket) == "" {
+		return fmt.Errorf("missing basket reference")
+	}
+
+	if op.Op == ReplayCreate {
+		if _, ok := baskets[op.Basket]; ok {
+			return fmt.Errorf("basket reference %q already in use", op.Basket)
+		}
+
+		id, err := c.AddBasket(ctx)
+		if err != nil {
+			return err
+		}
+		baskets[op.Basket] = id
+		return nil
+	}
+
+	id, ok := baskets[op.Basket]
+	if !ok {
+		return fmt.Errorf("unknown basket reference %q", op.Basket)
+	}
+
+	switch op.Op {
+	case ReplayAdd:
+		qty := op.Qty
+		if qty == 0 {
+			qty = 1
+		}
+		for i := 0; i < qty; i++ {
+			if err := c.AddItem(ctx, id, op.Code); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case ReplayPrice:
+		total, err := c.GetPrice(ctx, id)
+		if err != nil {
+			return err
+		}
+		if op.Expect != nil && math.Abs(total-*op.Expect) > 0.005 {
+			return fmt.Errorf("expected total %.2f but got %.2f", *op.Expect, total)
+		}
+		return nil
+
+	case ReplayDelete:
+		return c.DeleteBasket(ctx, id)
+	}
+
+	return fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// checkExpectedStatus turns the operation error into the replay outcome when a failure is expected
+func checkExpectedStatus(op ReplayOperation, err error) error {
+	if op.ExpectStatus == 0 {
+		return err
+	}
+
+	if err == nil {
+		return fmt.Errorf("expected status %d but the operation succeeded", op.ExpectStatus)
+	}
+
+	if responseError, ok := err.(*ResponseError); ok && responseError.StatusCode == op.ExpectStatus {
+		return nil
+	}
+
+	return fmt.Errorf("expected status %d but got: %v", op.ExpectStatus, err)
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/api"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type ReplayTestSuite struct {
+	suite.Suite
+
+	client *CheckoutClient
+	server *httptest.Server
+}
+
+func TestReplaySuite(t *testing.T) {
+	suite.Run(t, new(ReplayTestSuite))
+}
+
+// newInMemoryServer starts the real api backed by an in-memory datasource loaded with the test catalogue
+func newInMemoryServer(t *testing.T) (*httptest.Server, *datasource.InMemoryDatasource) {
+	configuration, err := config.LoadConfiguration("../internal/tests/config", "service_config_test")
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err.Error())
+	}
+
+	ds, err := datasource.InitInMemoryDatasource(configuration.Data)
+	if err != nil {
+		t.Fatalf("Error initializing datasource: %s", err.Error())
+	}
+
+	routes := mux.NewRouter()
+	apiRoute := routes.PathPrefix("/api/v1").Subrouter().StrictSlash(true)
+	api.NewCheckoutController(apiRoute, api.NewCheckoutService(ds))
+
+	return httptest.NewServer(routes), ds
+}
+
+func (suite *ReplayTestSuite) SetupSuite() {
+	suite.server, _ = newInMemoryServer(suite.T())
+	suite.client = NewCheckoutClient(suite.server.URL, 1)
+}
+
+func (suite *ReplayTestSuite) TearDownSuite() {
+	suite.server.Close()
+}
+
+func (suite *ReplayTestSuite) TestReplaySession() {
+	// Given
+	session := `
+{"op": "create", "basket": "b1"}
+{"op": "add", "basket": "b1", "code": "VOUCHER"}
+{"op": "add", "basket": "b1", "code": "TSHIRT", "qty": 3}
+{"op": "price", "basket": "b1", "expect": 62.00}
+{"op": "add", "basket": "b1", "code": "FAKE", "expectStatus": 404}
+{"op": "delete", "basket": "b1"}
+{"op": "price", "basket": "b1", "expectStatus": 404}
+`
+
+	// When
+	report, err := suite.client.Replay(context.Background(), strings.NewReader(session))
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(7, report.Passed)
+	suite.True(report.Success())
+}
+
+func (suite *ReplayTestSuite) TestReplayFailedExpectations() {
+	// Given
+	session := `{"op": "create", "basket": "b1"}
+{"op": "add", "basket": "b1", "code": "MUG"}
+{"op": "price", "basket": "b1", "expect": 1.00}
+{"op": "add", "basket": "b2", "code": "MUG"}
+{"op": "add", "basket": "b1", "code": "MUG", "expectStatus": 404}`
+
+	// When
+	report, err := suite.client.Replay(context.Background(), strings.NewReader(session))
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(2, report.Passed)
+	suite.Equal(3, report.Failed)
+	suite.False(report.Results[2].Passed)
+	suite.EqualError(report.Results[2].Err, "expected total 1.00 but got 7.50")
+	suite.EqualError(report.Results[3].Err, `unknown basket reference "b2"`)
+}
+
+func (suite *ReplayTestSuite) TestReplayMalformedLine() {
+	// Given
+	session := `{"op": "create", "basket": "b1"}
+not json`
+
+	// When
+	_, err := suite.client.Replay(context.Background(), strings.NewReader(session))
+
+	// Then
+	suite.NotNil(err)
+	suite.Contains(err.Error(), "line 2")
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/cli"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Exit codes returned by the non-interactive commands
+const (
+	exitOk          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitNotFound    = 3
+	exitValidation  = 4
+	exitServerError = 5
+	exitConflict    = 6
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+type basketCommand struct {
+	client *cli.CheckoutClient
+	stdout io.Writer
+
+	output   string
+	qty      int
+	region   string
+	currency string
+}
+
+// runBasketCommand executes one of the basket subcommands and returns the process exit code
+func runBasketCommand(client *cli.CheckoutClient, args []string, stdout, stderr io.Writer) int {
+	cmd := basketCommand{
+		client: client,
+		stdout: stdout,
+	}
+
+	fs := flag.NewFlagSet("basket", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cmd.output, "output", outputTable, "output format: json|table")
+	fs.IntVar(&cmd.qty, "qty", 1, "number of units to add or remove")
+	fs.StringVar(&cmd.region, "region", "", "tax region of the receipt, the default one of the server when empty")
+	fs.StringVar(&cmd.currency, "currency", "", "currency of the basket created, the base one of the server when empty")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+
+	if cmd.output != outputTable && cmd.output != outputJson {
+		fmt.Fprintf(stderr, "invalid output format %q\n", cmd.output)
+		return exitUsage
+	}
+
+	if len(positional) == 0 {
+		fmt.Fprintln(stderr, "missing basket command")
+		return exitUsage
+	}
+
+	switch positional[0] {
+	case "create":
+		err = cmd.checkArgs(positional, 0)
+		if err == nil {
+			err = cmd.create()
+		}
+	case "add":
+		err = cmd.checkArgs(positional, 2)
+		if err == nil {
+			err = cmd.add(positional[1], positional[2])
+		}
+	case "remove":
+		err = cmd.checkArgs(positional, 2)
+		if err == nil {
+			err = cmd.remove(positional[1], positional[2])
+		}
+	case "price":
+		err = cmd.checkArgs(positional, 1)
+		if err == nil {
+			err = cmd.price(positional[1])
+		}
+	case "show":
+		err = cmd.checkArgs(positional, 1)
+		if err == nil {
+			err = cmd.show(positional[1])
+		}
+	case "receipt":
+		err = cmd.checkArgs(positional, 1)
+		if err == nil {
+			err = cmd.receipt(positional[1])
+		}
+	case "delete":
+		err = cmd.checkArgs(positional, 1)
+		if err == nil {
+			err = cmd.delete(positional[1])
+		}
+	case "checkout":
+		err = cmd.checkArgs(positional, 1)
+		if err == nil {
+			err = cmd.checkout(positional[1])
+		}
+	case "order":
+		err = cmd.checkArgs(positional, 1)
+		if err == nil {
+			err = cmd.order(positional[1])
+		}
+	case "pay":
+		err = cmd.checkArgs(positional, 1)
+		if err == nil {
+			err = cmd.pay(positional[1])
+		}
+	case "refund":
+		err = cmd.checkArgs(positional, 1)
+		if err == nil {
+			err = cmd.refund(positional[1])
+		}
+	default:
+		fmt.Fprintf(stderr, "unknown basket command %q\n", positional[0])
+		return exitUsage
+	}
+
+	if err != nil {
+		printError(stderr, err)
+		return exitCodeByError(err)
+	}
+
+	return exitOk
+}
+
+// usageError is returned when the command line arguments are wrong
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func (b *basketCommand) checkArgs(positional []string, expected int) error {
+	if len(positional)-1 != expected {
+		return &usageError{fmt.Sprintf("basket %s expects %d argument(s), got %d", positional[0], expected, len(positional)-1)}
+	}
+	return nil
+}
+
+func (b *basketCommand) create() error {
+	id, err := b.client.AddBasketInCurrency(context.Background(), b.currency)
+	if err != nil {
+		return err
+	}
+
+	return b.print(map[string]interface{}{"id": id}, [][]string{{"ID"}, {id}})
+}
+
+func (b *basketCommand) add(basketId, productCode string) error {
+	if b.qty <= 0 {
+		return cli.ErrInvalidRequest
+	}
+
+	for i := 0; i < b.qty; i++ {
+		err := b.client.AddItem(context.Background(), basketId, productCode)
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.print(map[string]interface{}{"id": basketId, "code": productCode, "quantity": b.qty},
+		[][]string{{"ID", "CODE", "QUANTITY"}, {basketId, productCode, strconv.Itoa(b.qty)}})
+}
+
+func (b *basketCommand) remove(basketId, productCode string) error {
+	if b.qty <= 0 {
+		return cli.ErrInvalidRequest
+	}
+
+	for i := 0; i < b.qty; i++ {
+		err := b.client.RemoveItem(context.Background(), basketId, productCode)
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.print(map[string]interface{}{"id": basketId, "code": productCode, "removed": b.qty},
+		[][]string{{"ID", "CODE", "REMOVED"}, {basketId, productCode, strconv.Itoa(b.qty)}})
+}
+
+func (b *basketCommand) price(basketId string) error {
+	total, err := b.client.GetPrice(context.Background(), basketId)
+	if err != nil {
+		return err
+	}
+
+	return b.print(map[string]interface{}{"id": basketId, "total": total},
+		[][]string{{"ID", "TOTAL"}, {basketId, fmt.Sprintf("%.2f", total)}})
+}
+
+func (b *basketCommand) show(basketId string) error {
+	basket, err := b.client.GetBasket(context.Background(), basketId)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"CODE", "NAME", "PRICE", "AMOUNT"}}
+	for _, l := range basket.Lines {
+		rows = append(rows, []string{string(l.Code), l.Name, fmt.Sprintf("%.2f", float64(l.Price)/100), strconv.Itoa(l.Amount)})
+	}
+
+	return b.print(basket, rows)
+}
+
+func (b *basketCommand) delete(basketId string) error {
+	err := b.client.DeleteBasket(context.Background(), basketId)
+	if err != nil {
+		return err
+	}
+
+	return b.print(map[string]interface{}{"id": basketId, "deleted": true},
+		[][]string{{"ID", "DELETED"}, {basketId, "true"}})
+}
+
+func (b *basketCommand) receipt(basketId string) error {
+	receipt, err := b.client.GetReceipt(context.Background(), basketId, b.region)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"CODE", "NAME", "AMOUNT", "DISCOUNT", "TOTAL", "TAX"}}
+	for _, l := range receipt.Lines {
+		rows = append(rows, []string{string(l.Code), l.Name, strconv.Itoa(l.Amount), fmt.Sprintf("%.2f", l.Discount),
+			fmt.Sprintf("%.2f", l.Total), fmt.Sprintf("%v%%", l.Rate)})
+	}
+	rows = append(rows, []string{})
+
+	return b.print(receipt, append(rows, taxRows(receipt)...))
+}
+
+// taxRows has the tax per rate and the totals of the receipt
+func taxRows(receipt *responses.ReceiptResponse) [][]string {
+	rows := [][]string{{"RATE", "NET", "TAX"}}
+	for _, t := range receipt.Taxes {
+		rows = append(rows, []string{fmt.Sprintf("%v%%", t.Rate), fmt.Sprintf("%.2f", t.Net), fmt.Sprintf("%.2f", t.Tax)})
+	}
+	return append(rows, []string{}, []string{"REGION", "NET", "TAX", "GROSS"},
+		[]string{receipt.Region, fmt.Sprintf("%.2f", receipt.Net), fmt.Sprintf("%.2f", receipt.Tax), fmt.Sprintf("%.2f", receipt.Gross)})
+}
+
+func (b *basketCommand) checkout(basketId string) error {
+	order, err := b.client.Checkout(context.Background(), basketId)
+	if err != nil {
+		return err
+	}
+
+	return b.printOrder(order)
+}
+
+func (b *basketCommand) order(orderId string) error {
+	order, err := b.client.GetOrder(context.Background(), orderId)
+	if err != nil {
+		return err
+	}
+
+	return b.printOrder(order)
+}
+
+func (b *basketCommand) pay(orderId string) error {
+	order, err := b.client.PayOrder(context.Background(), orderId)
+	if err != nil {
+		return err
+	}
+
+	return b.printOrder(order)
+}
+
+func (b *basketCommand) refund(orderId string) error {
+	order, err := b.client.RefundOrder(context.Background(), orderId)
+	if err != nil {
+		return err
+	}
+
+	return b.printOrder(order)
+}
+
+func (b *basketCommand) printOrder(order *responses.OrderResponse) error {
+	rows := [][]string{{"ORDER", "BASKET", "TOTAL", "PAYMENT"},
+		{order.Id, order.BasketId, fmt.Sprintf("%.2f", order.Total), string(order.Payment.Status)}}
+	if order.Payment.FailureReason != "" {
+		rows = append(rows, []string{"", "", "", order.Payment.FailureReason})
+	}
+	rows = append(rows, []string{}, []string{"CODE", "NAME", "PRICE", "AMOUNT"})
+	for _, l := range order.Lines {
+		rows = append(rows, []string{string(l.Code), l.Name, fmt.Sprintf("%.2f", float64(l.Price)/100), strconv.Itoa(l.Amount)})
+	}
+	if order.Receipt != nil {
+		rows = append(rows, []string{})
+		rows = append(rows, taxRows(order.Receipt)...)
+	}
+
+	return b.print(order, rows)
+}
+
+// print writes the payload as json or the rows as a table depending on the output format
+func (b *basketCommand) print(payload interface{}, rows [][]string) error {
+	if b.output == outputJson {
+		encoder := json.NewEncoder(b.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(payload)
+	}
+
+	w := tabwriter.NewWriter(b.stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		for i, cell := range row {
+			if i > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, cell)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+// exitCodeByError maps an error to the exit code of its class
+func exitCodeByError(err error) int {
+	if err == cli.ErrInvalidRequest {
+		return exitValidation
+	}
+
+	switch e := err.(type) {
+	case *usageError:
+		return exitUsage
+	case *cli.ResponseError:
+		switch {
+		case e.IsNotFound():
+			return exitNotFound
+		case e.IsConflict():
+			return exitConflict
+		case e.IsValidation():
+			return exitValidation
+		case e.IsServerError():
+			return exitServerError
+		}
+	}
+
+	return exitError
+}
+
+// printError prints the error with the message and the request id sent by the server
+func printError(out io.Writer, err error) {
+	responseError, ok := err.(*cli.ResponseError)
+	if !ok {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return
+	}
+
+	if responseError.Message != "" {
+		fmt.Fprintf(out, "error: %v: %s\n", responseError, responseError.Message)
+	} else {
+		fmt.Fprintf(out, "error: %v\n", responseError)
+	}
+	if responseError.RequestId != "" {
+		fmt.Fprintf(out, "request id: %s\n", responseError.RequestId)
+	}
+}
+
+// parseInterspersed parses flags placed before, between or after the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/cli"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"testing"
+)
+
+type BasketCommandTestSuite struct {
+	suite.Suite
+
+	client *cli.CheckoutClient
+	server *mocks.CheckoutServerStub
+}
+
+func TestBasketCommandSuite(t *testing.T) {
+	suite.Run(t, new(BasketCommandTestSuite))
+}
+
+func (suite *BasketCommandTestSuite) SetupSuite() {
+	suite.server = mocks.NewCheckServerStub("/api/v1")
+	suite.client = cli.NewCheckoutClient(suite.server.GetUrl(), 1)
+}
+
+func (suite *BasketCommandTestSuite) TearDownSuite() {
+	suite.server.Close()
+}
+
+func (suite *BasketCommandTestSuite) TearDownTest() {
+	suite.server.StubResponse(0, nil)
+}
+
+func (suite *BasketCommandTestSuite) run(args ...string) (int, string) {
+	stdout := new(bytes.Buffer)
+	code := runBasketCommand(suite.client, args, stdout, new(bytes.Buffer))
+	return code, stdout.String()
+}
+
+func (suite *BasketCommandTestSuite) TestCreateJsonOutput() {
+	// Given
+	basketId := uuid.New().String()
+	suite.server.StubResponse(http.StatusCreated, responses.NewBasketResponse{Id: basketId})
+
+	// When
+	code, out := suite.run("create", "--output", "json")
+
+	// Then
+	suite.Equal(exitOk, code)
+
+	var payload map[string]interface{}
+	suite.Nil(json.Unmarshal([]byte(out), &payload))
+	suite.Equal(basketId, payload["id"])
+}
+
+func (suite *BasketCommandTestSuite) TestPriceTableOutput() {
+	// Given
+	basketId := uuid.New().String()
+	suite.server.StubResponse(http.StatusOK, responses.PriceBasketResponse{Total: 32.5})
+
+	// When
+	code, out := suite.run("price", basketId)
+
+	// Then
+	suite.Equal(exitOk, code)
+	suite.Contains(out, "TOTAL")
+	suite.Contains(out, "32.50")
+}
+
+func (suite *BasketCommandTestSuite) TestAddWithQuantityAfterArguments() {
+	// Given
+	suite.server.StubResponse(http.StatusCreated, nil)
+
+	// When
+	code, out := suite.run("add", uuid.New().String(), "MUG", "--qty", "3")
+
+	// Then
+	suite.Equal(exitOk, code)
+	suite.Contains(out, "3")
+}
+
+func (suite *BasketCommandTestSuite) TestRemoveWithQuantity() {
+	// Given
+	suite.server.StubResponse(http.StatusNoContent, nil)
+
+	// When
+	code, out := suite.run("remove", uuid.New().String(), "MUG", "--qty", "2")
+
+	// Then
+	suite.Equal(exitOk, code)
+	suite.Contains(out, "REMOVED")
+	suite.Contains(out, "2")
+}
+
+func (suite *BasketCommandTestSuite) TestReceiptTableOutput() {
+	// Given
+	suite.server.StubResponse(http.StatusOK, responses.ReceiptResponse{Region: "pt", Net: 10, Tax: 2.3, Gross: 12.3,
+		Lines: []responses.ReceiptLineResponse{{Code: "MUG", Name: "Mug", Price: 1000, Amount: 1, Total: 10, Rate: 23}},
+		Taxes: []responses.TaxLineResponse{{Rate: 23, Net: 10, Tax: 2.3}}})
+
+	// When
+	code, out := suite.run("receipt", uuid.New().String(), "--region", "pt")
+
+	// Then
+	suite.Equal(exitOk, code)
+	suite.Contains(out, "GROSS")
+	suite.Contains(out, "23%")
+	suite.Contains(out, "12.30")
+}
+
+func (suite *BasketCommandTestSuite) TestExitCodes() {
+	var cases = []struct {
+		status int
+		args   []string
+		code   int
+	}{
+		{http.StatusNotFound, []string{"show", uuid.New().String()}, exitNotFound},
+		{http.StatusUnprocessableEntity, []string{"add", uuid.New().String(), "MUG"}, exitValidation},
+		{http.StatusInternalServerError, []string{"create"}, exitServerError},
+		{http.StatusUnprocessableEntity, []string{"create", "--currency", "JPY"}, exitValidation},
+		{http.StatusConflict, []string{"checkout", uuid.New().String()}, exitConflict},
+		{http.StatusConflict, []string{"add", uuid.New().String(), "MUG"}, exitConflict},
+		{http.StatusNotFound, []string{"remove", uuid.New().String(), "MUG"}, exitNotFound},
+		{http.StatusConflict, []string{"refund", uuid.New().String()}, exitConflict},
+		{0, []string{"add", uuid.New().String(), "MUG", "--qty", "0"}, exitValidation},
+		{0, []string{"price"}, exitUsage},
+		{0, []string{"unknown"}, exitUsage},
+		{0, []string{"create", "--output", "xml"}, exitUsage},
+	}
+
+	for _, tc := range cases {
+		// Given
+		suite.server.StubResponse(tc.status, nil)
+
+		// When
+		code, _ := suite.run(tc.args...)
+
+		// Then
+		suite.Equal(tc.code, code, "args: %v", tc.args)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/alfcope/checkouttest/cli"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/model"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runLoadCommand runs concurrent virtual shoppers against the server and prints the results
+func runLoadCommand(client *cli.CheckoutClient, productsPath string, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	shoppers := fs.Int("shoppers", 10, "number of concurrent virtual shoppers")
+	shoppersPerBasket := fs.Int("shoppers-per-basket", 1, "shoppers working on the same basket at the same time")
+	baskets := fs.Int("baskets", 10, "baskets processed by every group of shoppers")
+	operations := fs.Int("ops", 10, "operations run by every shopper on each basket")
+	mix := fs.String("mix", "add=70,price=20,show=10", "relative weight of the add, price and show operations")
+	weights := fs.String("weights", "", "relative weight of every product, e.g. TSHIRT=3,MUG=1 (uniform by default)")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed")
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	loadConfig := cli.LoadTestConfig{
+		Shoppers:            *shoppers,
+		ShoppersPerBasket:   *shoppersPerBasket,
+		Baskets:             *baskets,
+		OperationsPerBasket: *operations,
+		Seed:                *seed,
+	}
+
+	var err error
+	loadConfig.Mix, err = parseMix(*mix)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	loadConfig.Products, loadConfig.Promotions, err = loadCatalogue(productsPath, *weights)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	report, err := client.LoadTest(context.Background(), loadConfig)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	printLoadReport(stdout, report)
+
+	if report.PriceMismatches > 0 {
+		return exitError
+	}
+
+	return exitOk
+}
+
+// loadCatalogue reads the products and promotions the server is expected to be running with
+func loadCatalogue(path, weights string) ([]cli.WeightedProduct, []model.Promotion, error) {
+	productsFile := fmt.Sprintf("%s%sproducts.json", path, string(os.PathSeparator))
+
+	ds, err := datasource.InitInMemoryDatasource(config.DataConfig{
+		Products:   productsFile,
+		Promotions: fmt.Sprintf("%s%spromotions.json", path, string(os.PathSeparator)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := ioutil.ReadFile(productsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var products []model.Product
+	if err = json.Unmarshal(file, &products); err != nil {
+		return nil, nil, err
+	}
+
+	productWeights := make(map[model.ProductCode]int)
+	if weights != "" {
+		for _, pair := range strings.Split(weights, ",") {
+			code, weight, err := parseWeight(pair)
+			if err != nil {
+				return nil, nil, err
+			}
+			productWeights[model.ProductCode(code)] = weight
+		}
+	}
+
+	var weighted []cli.WeightedProduct
+	for _, p := range products {
+		// Invalid products are discarded by the datasource
+		product, err := ds.GetProduct(context.Background(), p.Code)
+		if err != nil {
+			continue
+		}
+
+		weight := 1
+		if weights != "" {
+			weight = productWeights[p.Code]
+		}
+		weighted = append(weighted, cli.WeightedProduct{Product: product, Weight: weight})
+	}
+
+	return weighted, ds.GetPromotions(context.Background()), nil
+}
+
+func parseMix(mix string) (cli.OperationMix, error) {
+	var operationMix cli.OperationMix
+
+	for _, pair := range strings.Split(mix, ",") {
+		operation, weight, err := parseWeight(pair)
+		if err != nil {
+			return operationMix, err
+		}
+
+		switch operation {
+		case cli.EndpointAdd:
+			operationMix.Add = weight
+		case cli.EndpointPrice:
+			operationMix.Price = weight
+		case cli.EndpointShow:
+			operationMix.Show = weight
+		default:
+			return operationMix, fmt.Errorf("unknown operation %q", operation)
+		}
+	}
+
+	return operationMix, nil
+}
+
+func parseWeight(pair string) (string, int, error) {
+	parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("invalid weight %q, expected name=weight", pair)
+	}
+
+	weight, err := strconv.Atoi(parts[1])
+	if err != nil || weight < 0 {
+		return "", 0, fmt.Errorf("invalid weight %q", pair)
+	}
+
+	return parts[0], weight, nil
+}
+
+func printLoadReport(out io.Writer, report *cli.LoadTestReport) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "ENDPOINT\tREQUESTS\tERRORS\tERROR RATE\tP50\tP90\tP99\tMAX")
+	for _, name := range report.EndpointNames() {
+		e := report.Endpoints[name]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\t%v\t%v\t%v\t%v\n", name, e.Requests, e.Errors, e.ErrorRate()*100,
+			e.P50, e.P90, e.P99, e.Max)
+	}
+	_ = w.Flush()
+
+	fmt.Fprintf(out, "\n%d requests in %v (%.1f req/s)\n", report.Requests(), report.Elapsed, report.Throughput())
+	fmt.Fprintf(out, "%d baskets, %d price mismatches\n", report.Baskets, report.PriceMismatches)
+}
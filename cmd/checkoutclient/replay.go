@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/alfcope/checkouttest/cli"
+	"io"
+	"os"
+)
+
+// runReplayCommand replays a jsonl session file and prints a pass/fail summary
+func runReplayCommand(client *cli.CheckoutClient, args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "replay expects a session file")
+		return exitUsage
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitUsage
+	}
+	defer file.Close()
+
+	report, err := client.Replay(context.Background(), file)
+
+	for _, result := range report.Results {
+		if result.Passed {
+			fmt.Fprintf(stdout, "PASS line %d: %s %s\n", result.Line, result.Operation.Op, result.Operation.Basket)
+		} else {
+			fmt.Fprintf(stdout, "FAIL line %d: %s %s: %v\n", result.Line, result.Operation.Op, result.Operation.Basket, result.Err)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	fmt.Fprintf(stdout, "%d passed, %d failed\n", report.Passed, report.Failed)
+
+	if !report.Success() {
+		return exitError
+	}
+
+	return exitOk
+}
@@ -2,30 +2,64 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/pkg/logging"
 	"github.com/alfcope/checkouttest/server"
+	"os"
 )
 
 func main() {
-	configPath := flag.String("config", "", "path to configuration")
+	configPath := flag.String("config", "./config", "path to the optional configuration.yml file")
+	validateConfig := flag.Bool("validate-config", false, "check the configuration and exit")
+	// Every configuration key can be overridden, -server.port 8080 or CHECKOUT_SERVER_PORT=8080
+	config.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	if *configPath == "" {
-		*configPath = "./config"
-	}
-
-	configuration, err := config.LoadConfiguration(*configPath, "configuration")
+	configuration, err := config.Load(config.Sources{
+		Paths:    []string{*configPath},
+		FileName: "configuration",
+		Flags:    flag.CommandLine,
+	})
 	if err != nil {
 		logging.Logger.Error("Shutting down. Error loading configuration: ", err.Error())
+		os.Exit(1)
+	}
+
+	if err := configuration.Validate(); err != nil {
+		if *validateConfig {
+			printProblems(err)
+			os.Exit(1)
+		}
+		logging.Logger.Error("Shutting down. Invalid configuration: ", err.Error())
+		os.Exit(1)
+	}
+
+	if *validateConfig {
+		fmt.Println("Configuration is valid")
 		return
 	}
 
 	api, err := server.NewCheckoutApi(configuration)
 	if err != nil {
 		logging.Logger.Error("Shutting down. Error initialing api: ", err.Error())
+		os.Exit(1)
+	}
+
+	api.RunServer()
+}
+
+// printProblems lists a problem per line
+func printProblems(err error) {
+	validationError, ok := err.(*errors.ValidationError)
+	if !ok {
+		fmt.Fprintln(os.Stderr, err.Error())
 		return
 	}
 
-	api.RunServer(configuration.Server.Port)
+	fmt.Fprintf(os.Stderr, "Configuration has %d problems:\n", len(validationError.Errors))
+	for _, problem := range validationError.Errors {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", problem.Field, problem.Message)
+	}
 }
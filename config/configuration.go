@@ -2,11 +2,23 @@ package config
 
 import (
 	"github.com/spf13/viper"
+	"time"
 )
 
 type Configuration struct {
-	Server ServerConfig
-	Data   DataConfig
+	Server   ServerConfig
+	Data     DataConfig
+	Tracing  TracingConfig
+	Logging  LoggingConfig
+	Auth     AuthConfig
+	Limits   LimitsConfig
+	Webhooks WebhooksConfig
+	Payments PaymentsConfig
+	Tax      TaxConfig
+	Currency CurrencyConfig
+
+	// Keys of the file that do not match any setting
+	unknownKeys []string
 }
 
 type DataConfig struct {
@@ -15,22 +27,218 @@ type DataConfig struct {
 }
 
 type ServerConfig struct {
+	Port           int
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+	// Time the server keeps serving with a failing readiness before shutting down
+	DrainPeriod time.Duration
+	// Deadline for the in-flight requests to finish once the shutdown starts
+	ShutdownTimeout time.Duration
+	TLS             TLSConfig
+	CORS            CORSConfig
+	GRPC            GRPCConfig
+}
+
+type GRPCConfig struct {
+	// Port of the gRPC api, zero disables it
 	Port int
 }
 
-func LoadConfiguration(configPath, configFileName string) (Configuration, error) {
-	var configuration Configuration
+// CORSConfig is the policy for browser cross-origin requests, disabled when no origin is allowed
+type CORSConfig struct {
+	// Exact origins, "*" for any, or wildcard subdomains like https://*.example.com
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// Response headers the browsers let the scripts read
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// Time the browsers cache the preflight responses, at most 10 minutes
+	MaxAge time.Duration
+}
+
+// TLSConfig enables https when the certificate and key files are set
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// CA certificates used to verify the client certificates
+	ClientCAFile string
+	// Client certificate verification: none, optional or require
+	ClientAuth string
+	// Time between checks of the files, they are reloaded when they change
+	ReloadInterval time.Duration
+}
+
+// LimitsConfig bounds the use a client can make of the api, zero values disable a limit
+type LimitsConfig struct {
+	MaxBodyBytes    int64
+	MaxBasketLines  int
+	MaxLineQuantity int
+	// Time a basket is kept without changes, its reserved stock is released when it expires. The
+	// baskets do not expire when zero, the default.
+	BasketTTL  time.Duration
+	RateLimits RateLimitsConfig
+}
+
+// RateLimitsConfig has the rate limit of every route group
+type RateLimitsConfig struct {
+	Baskets RateLimitConfig
+	Admin   RateLimitConfig
+}
+
+type RateLimitConfig struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// AuthConfig enables the authentication of the api when any api key or jwt key is set
+type AuthConfig struct {
+	APIKeys []APIKeyConfig
+	JWT     JWTConfig
+}
+
+type APIKeyConfig struct {
+	Key     string
+	Subject string
+	// Store owning the baskets created with the key
+	Store  string
+	Scopes []string
+}
+
+type JWTConfig struct {
+	HS256Secret        string
+	RS256PublicKeyFile string
+	// Expected iss and aud claims, not checked when empty
+	Issuer   string
+	Audience string
+	// Claims holding the store and the space separated scopes
+	StoreClaim string
+	ScopeClaim string
+}
+
+// WebhooksConfig has the urls notified of the basket events and how the deliveries are retried
+type WebhooksConfig struct {
+	Subscriptions []WebhookConfig
+	// Attempts per event before it is kept as a dead letter
+	MaxAttempts int
+	// Wait after the first failed attempt, doubled after every attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Time allowed to every attempt
+	Timeout time.Duration
+	// Events waiting per subscription
+	QueueSize int
+}
+
+type WebhookConfig struct {
+	URL string
+	// Events sent, all of them when empty
+	Events []string
+	// Key of the HMAC-SHA256 signature of the deliveries
+	Secret string
+}
+
+// PaymentsConfig sets the gateway taking the payment of the orders
+type PaymentsConfig struct {
+	// Gateway: none, the default, leaves the orders pending; fake is the in-process gateway for
+	// tests and demos
+	Gateway string
+	// Time allowed to every call to the gateway
+	Timeout time.Duration
+	Fake    FakeGatewayConfig
+}
+
+type FakeGatewayConfig struct {
+	// Outcome of every call: approve, decline or timeout
+	Outcome string
+}
 
-	viper.AddConfigPath(configPath)
-	viper.SetConfigName(configFileName)
+// TaxConfig has the tax rates of the receipts, the taxes are not calculated without rates
+type TaxConfig struct {
+	// Pricing: inclusive when the catalogue prices include the tax, exclusive when it is added to them
+	Pricing string
+	// Region taxed when none is asked
+	Region string
+	// Rates, in percent, of every tax category by region. The products without category are standard.
+	Rates map[string]map[string]float64
+}
+
+// CurrencyConfig has the currencies the baskets can be priced in, the catalogue prices are in the
+// base one
+type CurrencyConfig struct {
+	Base string
+	// Accepted currencies priced with the price lists of the catalogue only
+	Accepted []string
+	// Rates from the base currency of the currencies opted in to the conversion, all their prices
+	// are converted, 0.85 when 1 of the base currency is 0.85 of the currency
+	Rates map[string]float64
+}
+
+type LoggingConfig struct {
+	// Minimum level logged: trace, debug, info, warn or error
+	Level string
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return Configuration{}, err
-	}
-	err := viper.Unmarshal(&configuration)
-	if err != nil {
-		return Configuration{}, err
-	}
+type TracingConfig struct {
+	// Span exporter: none or stdout
+	Exporter    string
+	ServiceName string
+	// Fraction of the new traces that are sampled, from 0 to 1
+	SampleRatio float64
+}
+
+// LoadConfiguration reads the configuration file configFileName in configPath, which must
+// exist, with the environment overrides and the built-in defaults
+func LoadConfiguration(configPath, configFileName string) (Configuration, error) {
+	return Load(Sources{
+		Paths:        []string{configPath},
+		FileName:     configFileName,
+		FileRequired: true,
+	})
+}
 
-	return configuration, nil
+// setDefaults sets the built-in defaults, enough to run the service without a configuration file
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.port", 7070)
+	v.SetDefault("server.grpc.port", 7071)
+	v.SetDefault("server.readTimeout", 5*time.Second)
+	v.SetDefault("server.writeTimeout", 5*time.Second)
+	v.SetDefault("server.idleTimeout", 60*time.Second)
+	v.SetDefault("server.maxHeaderBytes", 1<<20)
+	v.SetDefault("server.drainPeriod", 5*time.Second)
+	v.SetDefault("server.shutdownTimeout", 10*time.Second)
+	v.SetDefault("server.tls.clientAuth", "none")
+	v.SetDefault("server.tls.reloadInterval", 30*time.Second)
+	v.SetDefault("server.cors.allowedMethods", []string{"GET", "POST", "PUT", "DELETE"})
+	v.SetDefault("server.cors.allowedHeaders", []string{"Content-Type", "Authorization", "X-API-Key",
+		"X-Request-ID", "traceparent"})
+	v.SetDefault("server.cors.exposedHeaders", []string{"ETag", "Retry-After", "X-Request-ID"})
+	v.SetDefault("server.cors.maxAge", 10*time.Minute)
+	v.SetDefault("data.products", "./config/products.json")
+	v.SetDefault("data.promotions", "./config/promotions.json")
+	v.SetDefault("auth.jwt.storeClaim", "store")
+	v.SetDefault("auth.jwt.scopeClaim", "scope")
+	v.SetDefault("limits.maxBodyBytes", 16<<10)
+	v.SetDefault("limits.maxBasketLines", 100)
+	v.SetDefault("limits.maxLineQuantity", 1000)
+	v.SetDefault("limits.rateLimits.baskets.requestsPerSecond", 20)
+	v.SetDefault("limits.rateLimits.baskets.burst", 40)
+	v.SetDefault("limits.rateLimits.admin.requestsPerSecond", 1)
+	v.SetDefault("limits.rateLimits.admin.burst", 5)
+	v.SetDefault("webhooks.maxAttempts", 5)
+	v.SetDefault("webhooks.backoff", time.Second)
+	v.SetDefault("webhooks.maxBackoff", time.Minute)
+	v.SetDefault("webhooks.timeout", 5*time.Second)
+	v.SetDefault("webhooks.queueSize", 1000)
+	v.SetDefault("payments.gateway", "none")
+	v.SetDefault("payments.timeout", 5*time.Second)
+	v.SetDefault("payments.fake.outcome", "approve")
+	v.SetDefault("tax.pricing", "inclusive")
+	v.SetDefault("currency.base", "EUR")
+	v.SetDefault("logging.level", "info")
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.serviceName", "checkout")
+	v.SetDefault("tracing.sampleRatio", 1)
 }
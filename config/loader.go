@@ -0,0 +1,179 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Prefix of the environment variables overriding the configuration, CHECKOUT_SERVER_PORT
+// overrides server.port
+const EnvPrefix = "CHECKOUT"
+
+// Sources tells where the configuration is read from. Every key takes the value of the first
+// source setting it, in order: command line flags, environment variables, configuration file
+// and built-in defaults.
+type Sources struct {
+	// Directories searched for the configuration file
+	Paths []string
+	// Name of the configuration file without extension, no file is read when empty
+	FileName string
+	// Fail when the configuration file is not found, otherwise the defaults are used
+	FileRequired bool
+	// Looks up the environment variables, os.LookupEnv when nil
+	LookupEnv func(string) (string, bool)
+	// Flags registered by BindFlags, only the ones set on the command line are applied
+	Flags *flag.FlagSet
+}
+
+// Load reads the configuration from the sources. Every call uses its own viper instance, so
+// configurations can be loaded concurrently.
+func Load(sources Sources) (Configuration, error) {
+	var configuration Configuration
+
+	v := viper.New()
+	setDefaults(v)
+
+	if sources.FileName != "" {
+		for _, path := range sources.Paths {
+			v.AddConfigPath(path)
+		}
+		v.SetConfigName(sources.FileName)
+
+		if err := v.ReadInConfig(); err != nil {
+			if _, notFound := err.(viper.ConfigFileNotFoundError); !notFound || sources.FileRequired {
+				return Configuration{}, err
+			}
+		}
+	}
+
+	lookupEnv := sources.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	for _, key := range Keys() {
+		if value, ok := lookupEnv(EnvName(key)); ok {
+			v.Set(key, value)
+		}
+	}
+
+	// Applied after the environment so flags take precedence
+	if sources.Flags != nil {
+		keys := make(map[string]bool)
+		for _, key := range Keys() {
+			keys[key] = true
+		}
+
+		sources.Flags.Visit(func(f *flag.Flag) {
+			if keys[f.Name] {
+				v.Set(f.Name, f.Value.String())
+			}
+		})
+	}
+
+	// Keys not matching any field are kept to be reported by Validate, they are usually typos
+	var metadata mapstructure.Metadata
+	if err := v.Unmarshal(&configuration, func(c *mapstructure.DecoderConfig) { c.Metadata = &metadata }); err != nil {
+		return Configuration{}, err
+	}
+	for _, key := range metadata.Unused {
+		configuration.unknownKeys = append(configuration.unknownKeys, fieldPathToKey(key))
+	}
+
+	return configuration, nil
+}
+
+// BindFlags registers a flag per configuration key, named after it like -server.port. Slices
+// take comma separated values.
+func BindFlags(fs *flag.FlagSet) {
+	for _, key := range Keys() {
+		fs.String(key, "", fmt.Sprintf("overrides %s, also set by %s", key, EnvName(key)))
+	}
+}
+
+// EnvName returns the environment variable overriding a key, CHECKOUT_SERVER_READ_TIMEOUT for
+// server.readTimeout
+func EnvName(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(splitCamelCase(part))
+	}
+	return EnvPrefix + "_" + strings.Join(parts, "_")
+}
+
+// Keys lists the configuration keys that can be overridden: every field of Configuration
+// holding a string, a number, a boolean, a duration or a list of strings
+func Keys() []string {
+	return structKeys(reflect.TypeOf(Configuration{}), "")
+}
+
+func structKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + lowerFirst(field.Name)
+
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, structKeys(field.Type, key+".")...)
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+			keys = append(keys, key)
+		case reflect.Slice:
+			if field.Type.Elem().Kind() == reflect.String {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// fieldPathToKey turns the path of the decoder, Server.prot, into a key, server.prot
+func fieldPathToKey(path string) string {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		parts[i] = lowerFirst(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// lowerFirst turns a field name into its key: Port is port, TLS is tls, APIKeys is apiKeys
+func lowerFirst(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		// Keep the first letter of the next word, the K of APIKeys
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// splitCamelCase separates the words of a key with underscores, readTimeout is read_Timeout
+func splitCamelCase(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(previous) || nextIsLower {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "configuration.yml"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir, cleanup := writeConfig(t, `
+server:
+  port: 7071
+  readTimeout: "2s"
+data:
+  products: "file-products.json"
+  promotions: "file-promotions.json"
+`)
+	defer cleanup()
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	BindFlags(flags)
+	if err := flags.Parse([]string{"-server.port", "9090"}); err != nil {
+		t.Fatal(err)
+	}
+
+	configuration, err := Load(Sources{
+		Paths:    []string{dir},
+		FileName: "configuration",
+		LookupEnv: env(map[string]string{
+			"CHECKOUT_SERVER_PORT":                 "8080",
+			"CHECKOUT_DATA_PRODUCTS":               "env-products.json",
+			"CHECKOUT_SERVER_CORS_ALLOWED_ORIGINS": "https://a.example.com,https://b.example.com",
+		}),
+		Flags: flags,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Flag over env over file
+	if configuration.Server.Port != 9090 {
+		t.Errorf("Expected the flag port, got %d", configuration.Server.Port)
+	}
+	// Env over file
+	if configuration.Data.Products != "env-products.json" {
+		t.Errorf("Expected the env products, got %s", configuration.Data.Products)
+	}
+	// File over default
+	if configuration.Data.Promotions != "file-promotions.json" || configuration.Server.ReadTimeout != 2*time.Second {
+		t.Errorf("Expected the file values, got %+v", configuration)
+	}
+	// Default
+	if configuration.Server.WriteTimeout != 5*time.Second {
+		t.Errorf("Expected the default write timeout, got %v", configuration.Server.WriteTimeout)
+	}
+	// Lists from comma separated values
+	if !reflect.DeepEqual(configuration.Server.CORS.AllowedOrigins, []string{"https://a.example.com", "https://b.example.com"}) {
+		t.Errorf("Unexpected origins %v", configuration.Server.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	configuration, err := Load(Sources{
+		Paths:     []string{"./missing"},
+		FileName:  "configuration",
+		LookupEnv: env(nil),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if configuration.Server.Port != 7070 || configuration.Data.Products != "./config/products.json" {
+		t.Errorf("Expected the defaults, got %+v", configuration)
+	}
+	if configuration.Limits.BasketTTL != 0 {
+		t.Errorf("The baskets should not expire by default, got a ttl of %v", configuration.Limits.BasketTTL)
+	}
+	if configuration.Payments.Gateway != "none" {
+		t.Errorf("The payments should not be taken by default, got the %v gateway", configuration.Payments.Gateway)
+	}
+
+	_, err = Load(Sources{Paths: []string{"./missing"}, FileName: "configuration", FileRequired: true, LookupEnv: env(nil)})
+	if err == nil {
+		t.Errorf("Expected an error for the missing required file")
+	}
+}
+
+func TestLoadConcurrently(t *testing.T) {
+	for _, port := range []string{"7001", "7002", "7003"} {
+		port := port
+		t.Run(port, func(t *testing.T) {
+			t.Parallel()
+
+			for i := 0; i < 20; i++ {
+				configuration, err := Load(Sources{LookupEnv: env(map[string]string{"CHECKOUT_SERVER_PORT": port})})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if got := strconv.Itoa(configuration.Server.Port); got != port {
+					t.Fatalf("Expected port %s, got %s", port, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	names := map[string]string{
+		"server.port":                                 "CHECKOUT_SERVER_PORT",
+		"server.readTimeout":                          "CHECKOUT_SERVER_READ_TIMEOUT",
+		"server.tls.clientCAFile":                     "CHECKOUT_SERVER_TLS_CLIENT_CA_FILE",
+		"auth.jwt.hs256Secret":                        "CHECKOUT_AUTH_JWT_HS256_SECRET",
+		"limits.rateLimits.baskets.requestsPerSecond": "CHECKOUT_LIMITS_RATE_LIMITS_BASKETS_REQUESTS_PER_SECOND",
+	}
+
+	for key, name := range names {
+		if got := EnvName(key); got != name {
+			t.Errorf("Expected %s for %s, got %s", name, key, got)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	keys := make(map[string]bool)
+	for _, key := range Keys() {
+		keys[key] = true
+	}
+
+	for _, key := range []string{"server.port", "server.tls.clientCAFile", "server.cors.allowedOrigins",
+		"data.products", "auth.jwt.hs256Secret", "logging.level"} {
+		if !keys[key] {
+			t.Errorf("Expected key %s", key)
+		}
+	}
+
+	// Lists of structs can only be set in the file
+	if keys["auth.apiKeys"] {
+		t.Errorf("Unexpected key auth.apiKeys")
+	}
+}
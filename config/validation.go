@@ -0,0 +1,344 @@
+package config
+
+import (
+	"fmt"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/pkg/webhooks"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Shortest HS256 secret accepted, the key should be as long as the hash
+const minHS256SecretLength = 32
+
+// validator collects the problems found in a configuration
+type validator struct {
+	problems []*errors.ValidationErrorDescription
+}
+
+func (v *validator) add(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, errors.NewValidationErrorDescription(key, fmt.Sprintf(format, args...)))
+}
+
+// readable checks the file can be opened, an empty path is reported as missing
+func (v *validator) readable(key, path string) {
+	if path == "" {
+		v.add(key, "file not set")
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		v.add(key, "%v", err)
+		return
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		v.add(key, "%s is a directory", path)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(key, "%q is not one of %s", value, strings.Join(allowed, ", "))
+}
+
+// Validate checks the settings of the configuration and of every enabled feature. The returned
+// *errors.ValidationError lists every problem found, with the key of the setting as field.
+func (c Configuration) Validate() error {
+	v := &validator{}
+
+	for _, key := range c.unknownKeys {
+		v.add(key, "unknown setting")
+	}
+
+	c.Server.validate(v)
+	c.Data.validate(v)
+	c.Auth.validate(v)
+	c.Limits.validate(v)
+	c.Webhooks.validate(v)
+	c.Payments.validate(v)
+	c.Tax.validate(v)
+	c.Currency.validate(v)
+	c.Logging.validate(v)
+	c.Tracing.validate(v)
+
+	if len(v.problems) > 0 {
+		return errors.NewValidationError(v.problems)
+	}
+	return nil
+}
+
+func (s ServerConfig) validate(v *validator) {
+	if s.Port < 1 || s.Port > 65535 {
+		v.add("server.port", "%d is not between 1 and 65535", s.Port)
+	}
+
+	if s.GRPC.Port < 0 || s.GRPC.Port > 65535 {
+		v.add("server.grpc.port", "%d is not between 0 and 65535", s.GRPC.Port)
+	} else if s.GRPC.Port != 0 && s.GRPC.Port == s.Port {
+		v.add("server.grpc.port", "%d is already used by server.port", s.GRPC.Port)
+	}
+
+	if s.ReadTimeout <= 0 {
+		v.add("server.readTimeout", "must be positive")
+	}
+	if s.WriteTimeout <= 0 {
+		v.add("server.writeTimeout", "must be positive")
+	}
+	if s.IdleTimeout < 0 {
+		v.add("server.idleTimeout", "can't be negative")
+	}
+	if s.MaxHeaderBytes <= 0 {
+		v.add("server.maxHeaderBytes", "must be positive")
+	}
+	if s.DrainPeriod < 0 {
+		v.add("server.drainPeriod", "can't be negative")
+	}
+	if s.ShutdownTimeout <= 0 {
+		v.add("server.shutdownTimeout", "must be positive")
+	}
+
+	s.TLS.validate(v)
+	s.CORS.validate(v)
+}
+
+func (t TLSConfig) validate(v *validator) {
+	v.oneOf("server.tls.clientAuth", t.ClientAuth, "none", "optional", "require")
+	if t.ReloadInterval < 0 {
+		v.add("server.tls.reloadInterval", "can't be negative")
+	}
+
+	if t.CertFile == "" && t.KeyFile == "" {
+		if t.ClientAuth != "" && t.ClientAuth != "none" {
+			v.add("server.tls.clientAuth", "client certificates need tls, set the certificate and key files")
+		}
+		return
+	}
+
+	v.readable("server.tls.certFile", t.CertFile)
+	v.readable("server.tls.keyFile", t.KeyFile)
+	if t.ClientAuth == "optional" || t.ClientAuth == "require" {
+		v.readable("server.tls.clientCAFile", t.ClientCAFile)
+	}
+}
+
+func (c CORSConfig) validate(v *validator) {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" && c.AllowCredentials {
+			v.add("server.cors.allowCredentials", "credentials can't be allowed for any origin")
+			break
+		}
+	}
+	if c.MaxAge < 0 {
+		v.add("server.cors.maxAge", "can't be negative")
+	}
+}
+
+func (d DataConfig) validate(v *validator) {
+	v.readable("data.products", d.Products)
+	v.readable("data.promotions", d.Promotions)
+}
+
+func (a AuthConfig) validate(v *validator) {
+	keys := make(map[string]bool)
+	for i, key := range a.APIKeys {
+		prefix := fmt.Sprintf("auth.apiKeys[%d]", i)
+		if key.Key == "" {
+			v.add(prefix+".key", "empty key")
+		} else if keys[key.Key] {
+			v.add(prefix+".key", "duplicated key")
+		}
+		keys[key.Key] = true
+
+		if key.Subject == "" {
+			v.add(prefix+".subject", "empty subject")
+		}
+	}
+
+	if a.JWT.HS256Secret != "" && len(a.JWT.HS256Secret) < minHS256SecretLength {
+		v.add("auth.jwt.hs256Secret", "shorter than %d bytes", minHS256SecretLength)
+	}
+	if a.JWT.RS256PublicKeyFile != "" {
+		v.readable("auth.jwt.rs256PublicKeyFile", a.JWT.RS256PublicKeyFile)
+	}
+	if a.JWT.HS256Secret != "" || a.JWT.RS256PublicKeyFile != "" {
+		if a.JWT.StoreClaim == "" {
+			v.add("auth.jwt.storeClaim", "empty claim")
+		}
+		if a.JWT.ScopeClaim == "" {
+			v.add("auth.jwt.scopeClaim", "empty claim")
+		}
+	}
+}
+
+func (l LimitsConfig) validate(v *validator) {
+	if l.MaxBodyBytes < 0 {
+		v.add("limits.maxBodyBytes", "can't be negative")
+	}
+	if l.MaxBasketLines < 0 {
+		v.add("limits.maxBasketLines", "can't be negative")
+	}
+	if l.MaxLineQuantity < 0 {
+		v.add("limits.maxLineQuantity", "can't be negative")
+	}
+	if l.BasketTTL < 0 {
+		v.add("limits.basketTTL", "can't be negative")
+	}
+
+	l.RateLimits.Baskets.validate(v, "limits.rateLimits.baskets")
+	l.RateLimits.Admin.validate(v, "limits.rateLimits.admin")
+}
+
+func (r RateLimitConfig) validate(v *validator, key string) {
+	if r.RequestsPerSecond < 0 {
+		v.add(key+".requestsPerSecond", "can't be negative")
+	}
+	if r.Burst < 0 {
+		v.add(key+".burst", "can't be negative")
+	}
+}
+
+func (w WebhooksConfig) validate(v *validator) {
+	for i, subscription := range w.Subscriptions {
+		prefix := fmt.Sprintf("webhooks.subscriptions[%d]", i)
+
+		if u, err := url.Parse(subscription.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(prefix+".url", "%q is not an http or https url", subscription.URL)
+		}
+		for _, event := range subscription.Events {
+			v.oneOf(prefix+".events", event, webhooks.EventTypes...)
+		}
+		if subscription.Secret == "" {
+			v.add(prefix+".secret", "empty secret")
+		}
+	}
+
+	if w.MaxAttempts < 1 {
+		v.add("webhooks.maxAttempts", "must be positive")
+	}
+	if w.Backoff <= 0 {
+		v.add("webhooks.backoff", "must be positive")
+	}
+	if w.MaxBackoff < w.Backoff {
+		v.add("webhooks.maxBackoff", "shorter than the backoff")
+	}
+	if w.Timeout <= 0 {
+		v.add("webhooks.timeout", "must be positive")
+	}
+	if w.QueueSize < 1 {
+		v.add("webhooks.queueSize", "must be positive")
+	}
+}
+
+func (p PaymentsConfig) validate(v *validator) {
+	v.oneOf("payments.gateway", p.Gateway, "none", "fake")
+	if p.Gateway == "none" {
+		return
+	}
+	if p.Timeout <= 0 {
+		v.add("payments.timeout", "must be positive")
+	}
+	if p.Gateway == "fake" {
+		v.oneOf("payments.fake.outcome", p.Fake.Outcome, "approve", "decline", "timeout")
+	}
+}
+
+func (t TaxConfig) validate(v *validator) {
+	v.oneOf("tax.pricing", t.Pricing, "inclusive", "exclusive")
+	if len(t.Rates) == 0 {
+		return
+	}
+
+	if _, ok := t.Rates[strings.ToLower(t.Region)]; !ok {
+		v.add("tax.region", "%q has no rates", t.Region)
+	}
+
+	regions := make([]string, 0, len(t.Rates))
+	for region := range t.Rates {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	for _, region := range regions {
+		rates := t.Rates[region]
+		if _, ok := rates["standard"]; !ok {
+			v.add("tax.rates."+region, "missing the standard rate")
+		}
+
+		categories := make([]string, 0, len(rates))
+		for category := range rates {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+
+		for _, category := range categories {
+			if rate := rates[category]; rate < 0 || rate > 100 {
+				v.add("tax.rates."+region+"."+category, "%v is not between 0 and 100", rate)
+			}
+		}
+	}
+}
+
+func (c CurrencyConfig) validate(v *validator) {
+	if !isCurrencyCode(c.Base) {
+		v.add("currency.base", "%q is not a currency code", c.Base)
+	}
+	for _, accepted := range c.Accepted {
+		if !isCurrencyCode(accepted) {
+			v.add("currency.accepted", "%q is not a currency code", accepted)
+		}
+		if _, ok := c.Rates[strings.ToLower(accepted)]; ok {
+			v.add("currency.accepted", "%q is priced with the price lists, it can't have a rate", accepted)
+		}
+	}
+
+	currencies := make([]string, 0, len(c.Rates))
+	for currency := range c.Rates {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	for _, currency := range currencies {
+		if !isCurrencyCode(currency) {
+			v.add("currency.rates."+currency, "%q is not a currency code", currency)
+		}
+		if rate := c.Rates[currency]; rate <= 0 {
+			v.add("currency.rates."+currency, "%v is not positive", rate)
+		}
+	}
+}
+
+// isCurrencyCode reports whether the code is made of three letters, as the ISO 4217 codes
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (l LoggingConfig) validate(v *validator) {
+	if _, err := logrus.ParseLevel(l.Level); err != nil {
+		v.add("logging.level", "%q is not a log level", l.Level)
+	}
+}
+
+func (t TracingConfig) validate(v *validator) {
+	v.oneOf("tracing.exporter", t.Exporter, "none", "stdout")
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		v.add("tracing.sampleRatio", "%v is not between 0 and 1", t.SampleRatio)
+	}
+}
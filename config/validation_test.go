@@ -0,0 +1,278 @@
+package config
+
+import (
+	"github.com/alfcope/checkouttest/errors"
+	"testing"
+	"time"
+)
+
+func problems(t *testing.T, err error) map[string]string {
+	if err == nil {
+		return nil
+	}
+
+	validationError, ok := err.(*errors.ValidationError)
+	if !ok {
+		t.Fatalf("Expected a validation error, got %T", err)
+	}
+
+	result := make(map[string]string)
+	for _, problem := range validationError.Errors {
+		result[problem.Field] = problem.Message
+	}
+	return result
+}
+
+func TestValidateTestConfiguration(t *testing.T) {
+	configuration, err := LoadConfiguration("../internal/tests/config", "service_config_test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := configuration.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	dir, cleanup := writeConfig(t, `
+server:
+  prot: 8080
+  port: 0
+  readTimeout: "-1s"
+  tls:
+    clientAuth: "always"
+  cors:
+    allowedOrigins: ["*"]
+    allowCredentials: true
+data:
+  products: "./missing.json"
+  promotions: ""
+auth:
+  apiKeys:
+    - key: "key-1"
+    - key: "key-1"
+      subject: "till-2"
+  jwt:
+    hs256Secret: "short"
+limits:
+  maxBasketLines: -1
+  rateLimits:
+    admin:
+      burst: -5
+logging:
+  level: "verbose"
+tracing:
+  exporter: "jaeger"
+  sampleRatio: 2
+`)
+	defer cleanup()
+
+	configuration, err := Load(Sources{Paths: []string{dir}, FileName: "configuration", LookupEnv: env(nil)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := problems(t, configuration.Validate())
+
+	for _, key := range []string{
+		"server.prot",
+		"server.port",
+		"server.readTimeout",
+		"server.tls.clientAuth",
+		"server.cors.allowCredentials",
+		"data.products",
+		"data.promotions",
+		"auth.apiKeys[0].subject",
+		"auth.apiKeys[1].key",
+		"auth.jwt.hs256Secret",
+		"limits.maxBasketLines",
+		"limits.rateLimits.admin.burst",
+		"logging.level",
+		"tracing.exporter",
+		"tracing.sampleRatio",
+	} {
+		if _, ok := found[key]; !ok {
+			t.Errorf("Expected a problem with %s", key)
+		}
+	}
+
+	if len(found) != 15 {
+		t.Errorf("Expected 15 problems, got %d: %v", len(found), found)
+	}
+}
+
+func TestValidateTLSFiles(t *testing.T) {
+	configuration, err := Load(Sources{LookupEnv: env(map[string]string{
+		"CHECKOUT_DATA_PRODUCTS":                  "../internal/tests/config/products.json",
+		"CHECKOUT_DATA_PROMOTIONS":                "../internal/tests/config/promotions.json",
+		"CHECKOUT_SERVER_TLS_CERT_FILE":           "./missing.crt",
+		"CHECKOUT_SERVER_TLS_CLIENT_AUTH":         "require",
+		"CHECKOUT_AUTH_JWT_RS256_PUBLIC_KEY_FILE": "./missing.pem",
+	})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := problems(t, configuration.Validate())
+
+	for _, key := range []string{"server.tls.certFile", "server.tls.keyFile", "server.tls.clientCAFile",
+		"auth.jwt.rs256PublicKeyFile"} {
+		if _, ok := found[key]; !ok {
+			t.Errorf("Expected a problem with %s", key)
+		}
+	}
+	if len(found) != 4 {
+		t.Errorf("Expected 4 problems, got %d: %v", len(found), found)
+	}
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	dir, cleanup := writeConfig(t, `
+data:
+  products: "../internal/tests/config/products.json"
+  promotions: "../internal/tests/config/promotions.json"
+webhooks:
+  subscriptions:
+    - url: "https://loyalty.example.com/checkout"
+      events: ["basket.priced"]
+      secret: "secret"
+    - url: "ftp://analytics.example.com"
+      events: ["basket.paid"]
+  maxAttempts: 0
+  backoff: "10s"
+  maxBackoff: "1s"
+`)
+	defer cleanup()
+
+	configuration, err := Load(Sources{Paths: []string{dir}, FileName: "configuration", LookupEnv: env(nil)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := problems(t, configuration.Validate())
+
+	for _, key := range []string{
+		"webhooks.subscriptions[1].url",
+		"webhooks.subscriptions[1].events",
+		"webhooks.subscriptions[1].secret",
+		"webhooks.maxAttempts",
+		"webhooks.maxBackoff",
+	} {
+		if _, ok := found[key]; !ok {
+			t.Errorf("Expected a problem with %s", key)
+		}
+	}
+	if len(found) != 5 {
+		t.Errorf("Expected 5 problems, got %d: %v", len(found), found)
+	}
+}
+
+func TestValidatePayments(t *testing.T) {
+	dir, cleanup := writeConfig(t, `
+data:
+  products: "../internal/tests/config/products.json"
+  promotions: "../internal/tests/config/promotions.json"
+payments:
+  gateway: "stripe"
+  timeout: "0s"
+`)
+	defer cleanup()
+
+	configuration, err := Load(Sources{Paths: []string{dir}, FileName: "configuration", LookupEnv: env(nil)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := problems(t, configuration.Validate())
+	if len(found) != 2 || found["payments.gateway"] == "" || found["payments.timeout"] == "" {
+		t.Errorf("Expected problems with the gateway and the timeout, got %v", found)
+	}
+
+	configuration.Payments = PaymentsConfig{Gateway: "fake", Timeout: time.Second, Fake: FakeGatewayConfig{Outcome: "maybe"}}
+	found = problems(t, configuration.Validate())
+	if len(found) != 1 || found["payments.fake.outcome"] == "" {
+		t.Errorf("Expected a problem with the outcome, got %v", found)
+	}
+
+	configuration.Payments = PaymentsConfig{Gateway: "none"}
+	if found = problems(t, configuration.Validate()); len(found) != 0 {
+		t.Errorf("Payments not taken should be valid, got %v", found)
+	}
+}
+
+func TestValidateTax(t *testing.T) {
+	dir, cleanup := writeConfig(t, `
+data:
+  products: "../internal/tests/config/products.json"
+  promotions: "../internal/tests/config/promotions.json"
+tax:
+  pricing: "gross"
+  region: "FR"
+  rates:
+    es:
+      standard: 21
+      reduced: -10
+    pt:
+      reduced: 13
+`)
+	defer cleanup()
+
+	configuration, err := Load(Sources{Paths: []string{dir}, FileName: "configuration", LookupEnv: env(nil)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rate := configuration.Tax.Rates["es"]["standard"]; rate != 21 {
+		t.Errorf("Wanted the standard rate 21, got %v", rate)
+	}
+
+	found := problems(t, configuration.Validate())
+	if len(found) != 4 || found["tax.pricing"] == "" || found["tax.region"] == "" ||
+		found["tax.rates.es.reduced"] == "" || found["tax.rates.pt"] == "" {
+		t.Errorf("Expected problems with the pricing, the region and the rates, got %v", found)
+	}
+
+	configuration.Tax = TaxConfig{Pricing: "exclusive"}
+	if found = problems(t, configuration.Validate()); len(found) != 0 {
+		t.Errorf("Taxes without rates should be valid, got %v", found)
+	}
+}
+
+func TestValidateCurrency(t *testing.T) {
+	dir, cleanup := writeConfig(t, `
+data:
+  products: "../internal/tests/config/products.json"
+  promotions: "../internal/tests/config/promotions.json"
+currency:
+  base: "EURO"
+  accepted: ["GBP", "£"]
+  rates:
+    usd: 1.08
+    chf: 0
+`)
+	defer cleanup()
+
+	configuration, err := Load(Sources{Paths: []string{dir}, FileName: "configuration", LookupEnv: env(nil)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rate := configuration.Currency.Rates["usd"]; rate != 1.08 {
+		t.Errorf("Wanted the rate 1.08, got %v", rate)
+	}
+
+	found := problems(t, configuration.Validate())
+	if len(found) != 3 || found["currency.base"] == "" || found["currency.accepted"] == "" ||
+		found["currency.rates.chf"] == "" {
+		t.Errorf("Expected problems with the base, the accepted and the rates, got %v", found)
+	}
+
+	configuration.Currency = CurrencyConfig{Base: "EUR", Accepted: []string{"GBP"}, Rates: map[string]float64{"gbp": 0.85}}
+	if found = problems(t, configuration.Validate()); len(found) != 1 || found["currency.accepted"] == "" {
+		t.Errorf("An accepted currency should not have a rate, got %v", found)
+	}
+
+	configuration.Currency = CurrencyConfig{}
+	if found = problems(t, configuration.Validate()); found["currency.base"] == "" {
+		t.Errorf("A base currency should be required, got %v", found)
+	}
+}
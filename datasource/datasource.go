@@ -1,31 +1,76 @@
 package datasource
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/alfcope/checkouttest/config"
 	"github.com/alfcope/checkouttest/datasource/parser"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"io"
 	"io/ioutil"
+	"sort"
 	"sync"
+	"time"
 )
 
 type Datasource interface {
-	GetProduct(model.ProductCode) (model.Product, error)
-	GetPromotions() []model.Promotion
-	GetBasket(string) (*model.Basket, error)
-	AddBasket(*model.Basket) error
-	DeleteBasket(string)
+	GetProduct(context.Context, model.ProductCode) (model.Product, error)
+	GetPromotions(context.Context) []model.Promotion
+	GetBasket(context.Context, string) (*model.Basket, error)
+	AddBasket(context.Context, *model.Basket) error
+	// DeleteBasket deletes the basket and releases the stock it reserved
+	DeleteBasket(context.Context, string)
+	// GetExpiredBaskets returns the ids of the baskets not changed since the time
+	GetExpiredBaskets(context.Context, time.Time) []string
+	// ReserveStock reserves a unit of the product for the basket, it fails with OutOfStock when
+	// none is available
+	ReserveStock(ctx context.Context, basketId string, code model.ProductCode) error
+	ReleaseStock(ctx context.Context, basketId string, code model.ProductCode)
+	// AddOrder stores the order and commits the stock reserved by the basket for its lines
+	AddOrder(context.Context, *model.Order) error
+	GetOrder(context.Context, string) (*model.Order, error)
+	// UpdateOrderPayment moves the payment of the order from a status to another, it fails when
+	// the payment is no longer in the from status
+	UpdateOrderPayment(ctx context.Context, orderId string, from model.PaymentStatus, payment model.Payment) error
+}
+
+// Catalogue is implemented by the datasources that can report the catalogue they serve
+type Catalogue interface {
+	CatalogueInfo() CatalogueInfo
+}
+
+type CatalogueInfo struct {
+	// Digest of the catalogue sources, it changes whenever products or promotions change
+	Version    string
+	Products   int
+	Promotions int
+}
+
+// Pinger is implemented by the datasources backed by an external storage
+type Pinger interface {
+	Ping(context.Context) error
 }
 
 type InMemoryDatasource struct {
 	// products and promotions do not need mutex as they do not
 	// change its state. Just once at startup
-	products   map[model.ProductCode]model.Product
-	promotions []model.Promotion
+	products         map[model.ProductCode]model.Product
+	promotions       []model.Promotion
+	catalogueVersion string
+	// inventory has its own lock
+	inventory *model.Inventory
 
 	baskets    map[string]*model.Basket
 	basketsMux sync.RWMutex
+
+	orders    map[string]*model.Order
+	ordersMux sync.RWMutex
 }
 
 func InitInMemoryDatasource(config config.DataConfig) (*InMemoryDatasource, error) {
@@ -34,88 +79,291 @@ func InitInMemoryDatasource(config config.DataConfig) (*InMemoryDatasource, erro
 		promotions: make([]model.Promotion, 0),
 		baskets:    make(map[string]*model.Basket),
 		basketsMux: sync.RWMutex{},
+		orders:     make(map[string]*model.Order),
 	}
 
-	err := ds.loadProducts(config.Products)
+	digest := sha256.New()
+
+	err := ds.loadProducts(config.Products, digest)
 	if err != nil {
 		return nil, err
 	}
 
-	err = ds.loadPromotions(config.Promotions)
+	err = ds.loadPromotions(config.Promotions, digest)
 	if err != nil {
 		return nil, err
 	}
 
+	ds.catalogueVersion = hex.EncodeToString(digest.Sum(nil))[:12]
+
 	return &ds, nil
 }
 
-func (d *InMemoryDatasource) GetProduct(code model.ProductCode) (model.Product, error) {
+func (d *InMemoryDatasource) GetProduct(ctx context.Context, code model.ProductCode) (model.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return *new(model.Product), err
+	}
+
 	if product, ok := d.products[code]; ok {
 		return product, nil
 	}
 
+	logging.GetLoggerWithContext(ctx).WithField("productCode", code).Debug("Product not found")
 	return *new(model.Product), errors.NewProductNotFound(string(code))
 }
 
-func (d *InMemoryDatasource) GetPromotions() []model.Promotion {
+func (d *InMemoryDatasource) GetPromotions(ctx context.Context) []model.Promotion {
 	return d.promotions[:]
 }
 
-func (d *InMemoryDatasource) GetBasket(id string) (*model.Basket, error) {
+func (d *InMemoryDatasource) GetBasket(ctx context.Context, id string) (*model.Basket, error) {
+	if err := ctx.Err(); err != nil {
+		return new(model.Basket), err
+	}
+
+	d.basketsMux.RLock()
+	defer d.basketsMux.RUnlock()
+
 	if basket, ok := d.baskets[id]; ok {
 		return basket, nil
 	}
 
+	logging.GetLoggerWithContext(ctx).WithField("basketId", id).Debug("Basket not found")
 	return new(model.Basket), errors.NewBasketNotFound(id)
 }
 
-func (d *InMemoryDatasource) AddBasket(basket *model.Basket) error {
+func (d *InMemoryDatasource) AddBasket(ctx context.Context, basket *model.Basket) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	d.basketsMux.Lock()
 	defer d.basketsMux.Unlock()
 
 	if _, ok := d.baskets[basket.Id]; !ok {
 		d.baskets[basket.Id] = basket
+		metrics.OpenBaskets(len(d.baskets))
 		return nil
 	}
 
+	logging.GetLoggerWithContext(ctx).WithField("basketId", basket.Id).Warn("Basket id already in use")
 	return errors.NewPrimaryKeyError(basket.Id)
 }
 
-func (d *InMemoryDatasource) DeleteBasket(basketId string) {
+func (d *InMemoryDatasource) DeleteBasket(ctx context.Context, basketId string) {
 	d.basketsMux.Lock()
 	defer d.basketsMux.Unlock()
 
 	delete(d.baskets, basketId)
+	metrics.OpenBaskets(len(d.baskets))
+	d.inventory.ReleaseBasket(basketId)
+
+	logging.GetLoggerWithContext(ctx).WithField("basketId", basketId).Debug("Basket deleted")
 }
 
-func (d *InMemoryDatasource) loadProducts(filePath string) error {
-	var products []model.Product
+func (d *InMemoryDatasource) GetExpiredBaskets(ctx context.Context, updatedBefore time.Time) []string {
+	d.basketsMux.RLock()
+	defer d.basketsMux.RUnlock()
+
+	var expired []string
+	for id, basket := range d.baskets {
+		if basket.UpdatedAt().Before(updatedBefore) {
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
+
+func (d *InMemoryDatasource) ReserveStock(ctx context.Context, basketId string, code model.ProductCode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The basket is kept while reserving, so a basket deleted meanwhile can't keep a reservation
+	d.basketsMux.RLock()
+	defer d.basketsMux.RUnlock()
+
+	if _, ok := d.baskets[basketId]; !ok {
+		return errors.NewBasketNotFound(basketId)
+	}
+
+	if err := d.inventory.Reserve(basketId, code); err != nil {
+		logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+			"basketId":    basketId,
+			"productCode": code,
+		}).Info("Product out of stock")
+		return err
+	}
+	return nil
+}
+
+func (d *InMemoryDatasource) ReleaseStock(ctx context.Context, basketId string, code model.ProductCode) {
+	d.inventory.Release(basketId, code)
+}
+
+func (d *InMemoryDatasource) AddOrder(ctx context.Context, order *model.Order) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	d.ordersMux.Lock()
+	defer d.ordersMux.Unlock()
+
+	if _, ok := d.orders[order.Id]; ok {
+		logging.GetLoggerWithContext(ctx).WithField("orderId", order.Id).Warn("Order id already in use")
+		return errors.NewPrimaryKeyError(order.Id)
+	}
+
+	// A copy is kept so the payment is only changed through the datasource
+	stored := *order
+	d.orders[order.Id] = &stored
+
+	units := make(map[model.ProductCode]int, len(order.Lines))
+	for _, l := range order.Lines {
+		units[l.Code] += l.Amount
+	}
+	d.inventory.Commit(order.BasketId, units)
+	return nil
+}
+
+func (d *InMemoryDatasource) GetOrder(ctx context.Context, id string) (*model.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	d.ordersMux.RLock()
+	defer d.ordersMux.RUnlock()
+
+	if order, ok := d.orders[id]; ok {
+		copied := *order
+		return &copied, nil
+	}
+
+	logging.GetLoggerWithContext(ctx).WithField("orderId", id).Debug("Order not found")
+	return nil, errors.NewOrderNotFound(id)
+}
+
+func (d *InMemoryDatasource) UpdateOrderPayment(ctx context.Context, orderId string, from model.PaymentStatus, payment model.Payment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	d.ordersMux.Lock()
+	defer d.ordersMux.Unlock()
+
+	order, ok := d.orders[orderId]
+	if !ok {
+		return errors.NewOrderNotFound(orderId)
+	}
+
+	current := order.Payment
+	if current.Status != from || !current.CanMoveTo(payment.Status) {
+		logging.GetLoggerWithContext(ctx).WithFields(logrus.Fields{
+			"orderId": orderId,
+			"from":    from,
+			"status":  current.Status,
+			"to":      payment.Status,
+		}).Info("Payment status changed meanwhile")
+		return errors.NewPaymentStateError(orderId, string(current.Status), string(payment.Status))
+	}
+
+	order.Payment = payment
+	return nil
+}
+
+func (d *InMemoryDatasource) CatalogueInfo() CatalogueInfo {
+	return CatalogueInfo{
+		Version:    d.catalogueVersion,
+		Products:   len(d.products),
+		Promotions: len(d.promotions),
+	}
+}
+
+// Products returns the products of the catalogue sorted by code
+func (d *InMemoryDatasource) Products() []model.Product {
+	products := make([]model.Product, 0, len(d.products))
+	for _, p := range d.products {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].Code < products[j].Code
+	})
+	return products
+}
+
+// Close discards the baskets and orders, they are not persisted, and the stock they reserved
+func (d *InMemoryDatasource) Close() error {
+	d.basketsMux.Lock()
+	defer d.basketsMux.Unlock()
+
+	if len(d.baskets) > 0 {
+		logging.Logger.WithField("baskets", len(d.baskets)).Warn("Discarding in memory baskets")
+	}
+
+	d.baskets = make(map[string]*model.Basket)
+	d.inventory.ReleaseAll()
+	metrics.OpenBaskets(0)
+
+	d.ordersMux.Lock()
+	defer d.ordersMux.Unlock()
+
+	if len(d.orders) > 0 {
+		logging.Logger.WithField("orders", len(d.orders)).Warn("Discarding in memory orders")
+	}
+
+	d.orders = make(map[string]*model.Order)
+
+	return nil
+}
+
+// catalogueProduct is a product of the products file with its units in stock, unlimited when
+// not set
+type catalogueProduct struct {
+	model.Product
+	Stock *int `json:"stock,omitempty"`
+}
+
+func (d *InMemoryDatasource) loadProducts(filePath string, digest io.Writer) error {
+	var products []catalogueProduct
 
 	file, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
+	_, _ = digest.Write(file)
 
 	err = json.Unmarshal(file, &products)
 	if err != nil {
 		return err
 	}
 
+	stock := make(map[model.ProductCode]int)
 	for _, p := range products {
 		err := p.Validate()
-		if err == nil {
-			d.products[p.Code] = p
+		if err != nil {
+			continue
+		}
+		if p.Stock != nil && *p.Stock < 0 {
+			logging.Logger.WithField("productCode", p.Code).Warn("Product with negative stock ignored")
+			continue
+		}
+
+		d.products[p.Code] = p.Product
+		if p.Stock != nil {
+			stock[p.Code] = *p.Stock
 		}
 	}
+	d.inventory = model.NewInventory(stock)
 
 	return nil
 }
 
-func (d *InMemoryDatasource) loadPromotions(filePath string) error {
+func (d *InMemoryDatasource) loadPromotions(filePath string, digest io.Writer) error {
 	file, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
+	_, _ = digest.Write(file)
 
 	var nodes []map[string]interface{}
 	err = json.Unmarshal(file, &nodes)
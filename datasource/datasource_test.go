@@ -1,12 +1,14 @@
 package datasource
 
 import (
+	"context"
 	"github.com/alfcope/checkouttest/config"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
 	"testing"
+	"time"
 )
 
 type DatasourceTestSuite struct {
@@ -43,7 +45,7 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetNonExistingProduct()
 	var fakeProductCode model.ProductCode = "FAKE"
 
 	// When
-	_, err := suite.inMemoryDatasource.GetProduct(fakeProductCode)
+	_, err := suite.inMemoryDatasource.GetProduct(context.Background(), fakeProductCode)
 
 	// Then
 	suite.NotNil(err)
@@ -59,12 +61,13 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetProduct() {
 	var fakeProductCode model.ProductCode = "TSHIRT"
 
 	// When
-	p, err := suite.inMemoryDatasource.GetProduct(fakeProductCode)
+	p, err := suite.inMemoryDatasource.GetProduct(context.Background(), fakeProductCode)
 
 	// Then
 	suite.Nil(err)
 	suite.Equal(fakeProductCode, model.ProductCode(p.Code))
 	suite.Equal(2000, p.Price)
+	suite.Equal(map[model.Currency]int{"GBP": 1700}, p.Prices)
 	suite.Equal("Cabify T-Shirt", p.Name)
 }
 
@@ -72,7 +75,7 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetPromotions() {
 	// Given
 
 	// When
-	p := suite.inMemoryDatasource.GetPromotions()
+	p := suite.inMemoryDatasource.GetPromotions(context.Background())
 
 	// Then
 	suite.Equal(2, len(p))
@@ -85,7 +88,7 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetNonExistingBasket()
 	basketId := uuid.New().String()
 
 	// When
-	_, err := suite.inMemoryDatasource.GetBasket(basketId)
+	_, err := suite.inMemoryDatasource.GetBasket(context.Background(), basketId)
 
 	// Then
 	suite.NotNil(err)
@@ -104,7 +107,7 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetBasket() {
 	inMemoryDatasource.baskets = map[string]*model.Basket{basket.Id: basket}
 
 	// When
-	b, err := inMemoryDatasource.GetBasket(basket.Id)
+	b, err := inMemoryDatasource.GetBasket(context.Background(), basket.Id)
 
 	// Then
 	suite.Nil(err)
@@ -119,7 +122,7 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_AddBasketDuplicated() {
 	inMemoryDatasource.baskets = map[string]*model.Basket{basket.Id: basket}
 
 	// When
-	err := inMemoryDatasource.AddBasket(basket)
+	err := inMemoryDatasource.AddBasket(context.Background(), basket)
 
 	// Then
 	suite.NotNil(err)
@@ -138,7 +141,7 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_AddBasket() {
 	basket := model.NewBasket(uuid.New().String())
 
 	// When
-	err := inMemoryDatasource.AddBasket(basket)
+	err := inMemoryDatasource.AddBasket(context.Background(), basket)
 
 	// Then
 	suite.Nil(err)
@@ -150,10 +153,10 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_DeleteNonExistingBasket
 	// Not using the in-memory datasource from the suite to avoid concurrency errors
 	inMemoryDatasource := suite.initializeDataSource()
 	basket := model.NewBasket(uuid.New().String())
-	inMemoryDatasource.AddBasket(basket)
+	inMemoryDatasource.AddBasket(context.Background(), basket)
 
 	// When
-	inMemoryDatasource.DeleteBasket(uuid.New().String())
+	inMemoryDatasource.DeleteBasket(context.Background(), uuid.New().String())
 
 	// Then
 	suite.Equal(1, len(inMemoryDatasource.baskets))
@@ -166,8 +169,248 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_DeleteBasket() {
 	basket := model.NewBasket(uuid.New().String())
 
 	// When
-	inMemoryDatasource.DeleteBasket(basket.Id)
+	inMemoryDatasource.DeleteBasket(context.Background(), basket.Id)
 
 	// Then
 	suite.Equal(0, len(inMemoryDatasource.baskets))
 }
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetBasketCancelledContext() {
+	// Given
+	inMemoryDatasource := suite.initializeDataSource()
+	basket := model.NewBasket(uuid.New().String())
+	inMemoryDatasource.baskets = map[string]*model.Basket{basket.Id: basket}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// When
+	_, err := inMemoryDatasource.GetBasket(ctx, basket.Id)
+
+	// Then
+	suite.Equal(context.Canceled, err)
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_CatalogueInfo() {
+	// When
+	info := suite.inMemoryDatasource.CatalogueInfo()
+
+	// Then
+	suite.Equal(3, info.Products)
+	suite.Equal(2, info.Promotions)
+	suite.Len(info.Version, 12)
+	suite.Equal(info.Version, suite.initializeDataSource().CatalogueInfo().Version)
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetNonExistingOrder() {
+	// Given
+	orderId := uuid.New().String()
+
+	// When
+	_, err := suite.inMemoryDatasource.GetOrder(context.Background(), orderId)
+
+	// Then
+	suite.NotNil(err)
+	if onf, ok := err.(*errors.OrderNotFound); ok {
+		suite.Equal(orderId, onf.Id)
+	} else {
+		suite.T().Errorf("Wanted order not found error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_AddOrder() {
+	// Given
+	// Not using the in-memory datasource from the suite to avoid concurrency errors
+	inMemoryDatasource := suite.initializeDataSource()
+	order := &model.Order{Id: uuid.New().String(), BasketId: uuid.New().String()}
+
+	// When
+	err := inMemoryDatasource.AddOrder(context.Background(), order)
+
+	// Then
+	suite.Nil(err)
+
+	o, err := inMemoryDatasource.GetOrder(context.Background(), order.Id)
+	suite.Nil(err)
+	suite.Equal(order, o)
+
+	// When
+	err = inMemoryDatasource.AddOrder(context.Background(), order)
+
+	// Then
+	if duplicatedPrimaryKey, ok := err.(*errors.PrimaryKeyError); ok {
+		suite.Equal(order.Id, duplicatedPrimaryKey.Id)
+	} else {
+		suite.T().Errorf("Wanted primary key error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_UpdateOrderPayment() {
+	// Given
+	// Not using the in-memory datasource from the suite to avoid concurrency errors
+	inMemoryDatasource := suite.initializeDataSource()
+	order := &model.Order{Id: uuid.New().String(), Payment: model.Payment{Status: model.PaymentPending}}
+	suite.Require().Nil(inMemoryDatasource.AddOrder(context.Background(), order))
+
+	// When
+	err := inMemoryDatasource.UpdateOrderPayment(context.Background(), order.Id, model.PaymentPending,
+		model.Payment{Status: model.PaymentAuthorized, AuthorizationId: "auth-1"})
+
+	// Then
+	suite.Nil(err)
+	o, _ := inMemoryDatasource.GetOrder(context.Background(), order.Id)
+	suite.Equal(model.PaymentAuthorized, o.Payment.Status)
+	suite.Equal("auth-1", o.Payment.AuthorizationId)
+	suite.Equal(model.PaymentPending, order.Payment.Status, "The order added should not change")
+
+	// When the payment is no longer in the from status
+	err = inMemoryDatasource.UpdateOrderPayment(context.Background(), order.Id, model.PaymentPending,
+		model.Payment{Status: model.PaymentFailed})
+
+	// Then
+	if _, ok := err.(*errors.PaymentStateError); !ok {
+		suite.T().Errorf("Wanted payment state error, got %T", err)
+	}
+
+	// When the transition is not allowed
+	err = inMemoryDatasource.UpdateOrderPayment(context.Background(), order.Id, model.PaymentAuthorized,
+		model.Payment{Status: model.PaymentRefunded})
+
+	// Then
+	if _, ok := err.(*errors.PaymentStateError); !ok {
+		suite.T().Errorf("Wanted payment state error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_LoadStock() {
+	// When
+	level, limited := suite.inMemoryDatasource.inventory.Level("MUG")
+
+	// Then
+	suite.True(limited)
+	suite.Equal(model.StockLevel{OnHand: 1000}, level)
+	_, limited = suite.inMemoryDatasource.inventory.Level("VOUCHER")
+	suite.False(limited, "Products without stock are unlimited")
+	_, err := suite.inMemoryDatasource.GetProduct(context.Background(), "NEGATIVE")
+	suite.NotNil(err, "Products with a negative stock are discarded")
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_ReserveStock() {
+	// Given
+	// Not using the in-memory datasource from the suite to avoid concurrency errors
+	inMemoryDatasource := suite.initializeDataSource()
+	inMemoryDatasource.inventory = model.NewInventory(map[model.ProductCode]int{"MUG": 2})
+	basket := model.NewBasket(uuid.New().String())
+	suite.Require().Nil(inMemoryDatasource.AddBasket(context.Background(), basket))
+
+	// When
+	for i := 0; i < 2; i++ {
+		suite.Nil(inMemoryDatasource.ReserveStock(context.Background(), basket.Id, "MUG"))
+	}
+	err := inMemoryDatasource.ReserveStock(context.Background(), basket.Id, "MUG")
+
+	// Then
+	if outOfStock, ok := err.(*errors.OutOfStock); ok {
+		suite.Equal("MUG", outOfStock.Code)
+	} else {
+		suite.T().Errorf("Wanted out of stock error, got %T", err)
+	}
+	suite.Nil(inMemoryDatasource.ReserveStock(context.Background(), basket.Id, "VOUCHER"), "Voucher has no stock limit")
+
+	// When
+	inMemoryDatasource.ReleaseStock(context.Background(), basket.Id, "MUG")
+
+	// Then
+	suite.Nil(inMemoryDatasource.ReserveStock(context.Background(), basket.Id, "MUG"))
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_CloseReleasesStock() {
+	// Given
+	// Not using the in-memory datasource from the suite to avoid concurrency errors
+	inMemoryDatasource := suite.initializeDataSource()
+	inMemoryDatasource.inventory = model.NewInventory(map[model.ProductCode]int{"MUG": 2})
+	basket := model.NewBasket(uuid.New().String())
+	suite.Require().Nil(inMemoryDatasource.AddBasket(context.Background(), basket))
+	suite.Require().Nil(inMemoryDatasource.ReserveStock(context.Background(), basket.Id, "MUG"))
+
+	// When
+	suite.Nil(inMemoryDatasource.Close())
+
+	// Then
+	level, _ := inMemoryDatasource.inventory.Level("MUG")
+	suite.Equal(0, level.Reserved)
+	suite.Equal(2, level.Available())
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_ReserveStockNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	// When
+	err := suite.inMemoryDatasource.ReserveStock(context.Background(), basketId, "MUG")
+
+	// Then
+	if _, ok := err.(*errors.BasketNotFound); !ok {
+		suite.T().Errorf("Wanted basket not found error, got %T", err)
+	}
+	level, _ := suite.inMemoryDatasource.inventory.Level("MUG")
+	suite.Equal(0, level.Reserved)
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_DeleteBasketReleasesStock() {
+	// Given
+	// Not using the in-memory datasource from the suite to avoid concurrency errors
+	inMemoryDatasource := suite.initializeDataSource()
+	inMemoryDatasource.inventory = model.NewInventory(map[model.ProductCode]int{"MUG": 2})
+	basket := model.NewBasket(uuid.New().String())
+	suite.Require().Nil(inMemoryDatasource.AddBasket(context.Background(), basket))
+	suite.Require().Nil(inMemoryDatasource.ReserveStock(context.Background(), basket.Id, "MUG"))
+
+	// When
+	inMemoryDatasource.DeleteBasket(context.Background(), basket.Id)
+
+	// Then
+	level, _ := inMemoryDatasource.inventory.Level("MUG")
+	suite.Equal(model.StockLevel{OnHand: 2}, level)
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_AddOrderCommitsStock() {
+	// Given
+	// Not using the in-memory datasource from the suite to avoid concurrency errors
+	inMemoryDatasource := suite.initializeDataSource()
+	inMemoryDatasource.inventory = model.NewInventory(map[model.ProductCode]int{"MUG": 2})
+	basket := model.NewBasket(uuid.New().String())
+	suite.Require().Nil(inMemoryDatasource.AddBasket(context.Background(), basket))
+	suite.Require().Nil(inMemoryDatasource.ReserveStock(context.Background(), basket.Id, "MUG"))
+	order := &model.Order{Id: uuid.New().String(), BasketId: basket.Id,
+		Lines: []model.OrderLine{{Code: "MUG", Amount: 1}, {Code: "VOUCHER", Amount: 3}}}
+
+	// When
+	err := inMemoryDatasource.AddOrder(context.Background(), order)
+
+	// Then
+	suite.Nil(err)
+	level, _ := inMemoryDatasource.inventory.Level("MUG")
+	suite.Equal(model.StockLevel{OnHand: 1}, level)
+
+	// The stock sold is not released with the basket
+	inMemoryDatasource.DeleteBasket(context.Background(), basket.Id)
+	level, _ = inMemoryDatasource.inventory.Level("MUG")
+	suite.Equal(model.StockLevel{OnHand: 1}, level)
+}
+
+func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetExpiredBaskets() {
+	// Given
+	// Not using the in-memory datasource from the suite to avoid concurrency errors
+	inMemoryDatasource := suite.initializeDataSource()
+	old := model.NewBasket(uuid.New().String())
+	suite.Require().Nil(inMemoryDatasource.AddBasket(context.Background(), old))
+	updatedBefore := time.Now()
+	suite.Require().Nil(inMemoryDatasource.AddBasket(context.Background(), model.NewBasket(uuid.New().String())))
+
+	// When
+	expired := inMemoryDatasource.GetExpiredBaskets(context.Background(), updatedBefore)
+
+	// Then
+	suite.Equal([]string{old.Id}, expired)
+}
@@ -0,0 +1,14 @@
+package parser
+
+import (
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// logger receives the warnings about the entries discarded while parsing
+var logger logrus.FieldLogger = logging.Logger
+
+// SetLogger replaces the logger used by the parser
+func SetLogger(l logrus.FieldLogger) {
+	logger = l
+}
@@ -1,9 +1,9 @@
 package parser
 
 import (
-	"fmt"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/sirupsen/logrus"
 )
 
 func ParsePromotion(nodes map[string]interface{}) (model.Promotion, error) {
@@ -32,40 +32,41 @@ func parseBulkPromotion(nodes map[string]interface{}) (*model.BulkPromotion, err
 
 	for _, rawPromo := range rawPromos {
 		if _, ok := rawPromo.(map[string]interface{}); !ok {
-			fmt.Printf("Invalid map: %v", rawPromo)
+			logger.WithField("promo", rawPromo).Warn("Invalid promotion entry, discarded")
 			continue
 		}
 		promo := rawPromo.(map[string]interface{})
 
 		if _, ok := promo["product"].(string); !ok {
-			fmt.Printf("Invalid product code: %v %T\n", promo["product"], promo["product"])
+			logger.WithField("product", promo["product"]).Warn("Invalid product code, promotion entry discarded")
 			continue
 		}
 
 		if _, ok := promo["rules"].([]interface{}); !ok {
-			fmt.Printf("Invalid offer conditions: %v %T\n", promo["rules"], promo["rules"])
+			logger.WithField("rules", promo["rules"]).Warn("Invalid offer conditions, promotion entry discarded")
 			continue
 		}
 
 		for _, rawRules := range promo["rules"].([]interface{}) {
 			if _, ok := rawRules.(map[string]interface{}); !ok {
-				fmt.Printf("Invalid map: %v", rawRules)
+				logger.WithField("rule", rawRules).Warn("Invalid offer rule, discarded")
 				continue
 			}
 			rule := rawRules.(map[string]interface{})
 
 			if _, ok := rule["buy"].(float64); !ok {
-				fmt.Printf("Invalid amount to buy: %v\n", rule["buy"])
+				logger.WithField("buy", rule["buy"]).Warn("Invalid amount to buy, offer rule discarded")
 				continue
 			}
 			if _, ok := rule["price"].(float64); !ok {
-				fmt.Printf("Invalid price: %v\n", rule["price"])
+				logger.WithField("price", rule["price"]).Warn("Invalid price, offer rule discarded")
 				continue
 			}
 
 			promoRule := model.BulkOfferRule{
-				Buy:   int(rule["buy"].(float64)),
-				Price: int(rule["price"].(float64)),
+				Buy:    int(rule["buy"].(float64)),
+				Price:  int(rule["price"].(float64)),
+				Prices: parseRulePrices(rule["prices"]),
 			}
 
 			if promosProduct, ok := promos[model.ProductCode(promo["product"].(string))]; ok {
@@ -83,6 +84,31 @@ func parseBulkPromotion(nodes map[string]interface{}) (*model.BulkPromotion, err
 	return model.NewBulkPromotion(promos), nil
 }
 
+// parseRulePrices parses the prices of a rule in other currencies, nil when it has none
+func parseRulePrices(rawPrices interface{}) map[model.Currency]int {
+	if rawPrices == nil {
+		return nil
+	}
+	if _, ok := rawPrices.(map[string]interface{}); !ok {
+		logger.WithField("prices", rawPrices).Warn("Invalid currency prices, discarded")
+		return nil
+	}
+
+	prices := make(map[model.Currency]int)
+	for currency, rawPrice := range rawPrices.(map[string]interface{}) {
+		if price, ok := rawPrice.(float64); !ok || price <= 0 {
+			logger.WithFields(logrus.Fields{"currency": currency, "price": rawPrice}).Warn("Invalid currency price, discarded")
+			continue
+		}
+		prices[model.Currency(currency)] = int(rawPrice.(float64))
+	}
+
+	if len(prices) == 0 {
+		return nil
+	}
+	return prices
+}
+
 func parseFreeItemsPromotion(nodes map[string]interface{}) (*model.FreeItemsPromotion, error) {
 	var promos map[model.ProductCode][]model.FreeItemsOfferRule
 
@@ -91,34 +117,34 @@ func parseFreeItemsPromotion(nodes map[string]interface{}) (*model.FreeItemsProm
 
 	for _, rawPromo := range rawPromos {
 		if _, ok := rawPromo.(map[string]interface{}); !ok {
-			fmt.Printf("Invalid map: %v", rawPromo)
+			logger.WithField("promo", rawPromo).Warn("Invalid promotion entry, discarded")
 			continue
 		}
 		promo := rawPromo.(map[string]interface{})
 
 		if _, ok := promo["product"].(string); !ok {
-			fmt.Printf("Invalid product code: %v %T\n", promo["product"], promo["product"])
+			logger.WithField("product", promo["product"]).Warn("Invalid product code, promotion entry discarded")
 			continue
 		}
 
 		if _, ok := promo["rules"].([]interface{}); !ok {
-			fmt.Printf("Invalid offer conditions: %v %T\n", promo["rules"], promo["rules"])
+			logger.WithField("rules", promo["rules"]).Warn("Invalid offer conditions, promotion entry discarded")
 			continue
 		}
 
 		for _, rawRules := range promo["rules"].([]interface{}) {
 			if _, ok := rawRules.(map[string]interface{}); !ok {
-				fmt.Printf("Invalid map: %v", rawRules)
+				logger.WithField("rule", rawRules).Warn("Invalid offer rule, discarded")
 				continue
 			}
 			rule := rawRules.(map[string]interface{})
 
 			if _, ok := rule["buy"].(float64); !ok {
-				fmt.Printf("Invalid amount to buy: %v\n", rule["buy"])
+				logger.WithField("buy", rule["buy"]).Warn("Invalid amount to buy, offer rule discarded")
 				continue
 			}
 			if _, ok := rule["free"].(float64); !ok {
-				fmt.Printf("Invalid amount: %v\n", rule["free"])
+				logger.WithField("free", rule["free"]).Warn("Invalid amount of free items, offer rule discarded")
 				continue
 			}
 
@@ -3,6 +3,9 @@ package parser
 import (
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"log"
 	"reflect"
 	"testing"
@@ -83,6 +86,18 @@ var promotionsParsersCases = []struct {
 			"PR2": {{Buy: 3, Price: 500}},
 		}),
 		nil,
+	}, { // Promotion with prices in other currencies
+		map[string]interface{}{"code": "BULK", "promos": []interface{}{
+			map[string]interface{}{"product": "PR1", "rules": []interface{}{
+				map[string]interface{}{"buy": float64(3), "price": float64(1000),
+					"prices": map[string]interface{}{"GBP": float64(850), "USD": "aaaa", "CHF": float64(-1)}},
+				map[string]interface{}{"buy": float64(5), "price": float64(850), "prices": "aaaa"}},
+			},
+		}},
+		model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{
+			"PR1": {{Buy: 3, Price: 1000, Prices: map[model.Currency]int{"GBP": 850}}, {Buy: 5, Price: 850}},
+		}),
+		nil,
 	}, // ---- FREE ITEMS PROMOTION CASES
 	{ // Empty promotion
 		map[string]interface{}{},
@@ -175,3 +190,24 @@ func TestBasketPrices(t *testing.T) {
 		}
 	}
 }
+
+func TestDiscardedEntriesAreLogged(t *testing.T) {
+	testLogger, hook := test.NewNullLogger()
+	SetLogger(testLogger)
+	defer SetLogger(logging.Logger)
+
+	_, err := ParsePromotion(map[string]interface{}{"code": "BULK", "promos": []interface{}{
+		map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(3), "price": "aaaa"}}},
+		map[string]interface{}{"product": "PR2", "rules": []interface{}{map[string]interface{}{"buy": float64(3), "price": float64(900)}}},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(hook.Entries) != 1 {
+		t.Fatalf("Expected 1 log entry but got %d", len(hook.Entries))
+	}
+	if hook.LastEntry().Level != logrus.WarnLevel || hook.LastEntry().Data["price"] != "aaaa" {
+		t.Errorf("Unexpected log entry %v", hook.LastEntry())
+	}
+}
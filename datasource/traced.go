@@ -0,0 +1,110 @@
+package datasource
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/tracing"
+	"time"
+)
+
+// tracedDatasource creates a span for every call to the wrapped datasource
+type tracedDatasource struct {
+	ds Datasource
+}
+
+func WithTracing(ds Datasource) Datasource {
+	return &tracedDatasource{ds: ds}
+}
+
+func (t *tracedDatasource) GetProduct(ctx context.Context, code model.ProductCode) (model.Product, error) {
+	ctx, span := tracing.Start(ctx, "Datasource.GetProduct", tracing.ProductCodeKey.String(string(code)))
+
+	product, err := t.ds.GetProduct(ctx, code)
+	tracing.End(span, err)
+
+	return product, err
+}
+
+func (t *tracedDatasource) GetPromotions(ctx context.Context) []model.Promotion {
+	ctx, span := tracing.Start(ctx, "Datasource.GetPromotions")
+	defer span.End()
+
+	return t.ds.GetPromotions(ctx)
+}
+
+func (t *tracedDatasource) GetBasket(ctx context.Context, id string) (*model.Basket, error) {
+	ctx, span := tracing.Start(ctx, "Datasource.GetBasket", tracing.BasketIdKey.String(id))
+
+	basket, err := t.ds.GetBasket(ctx, id)
+	tracing.End(span, err)
+
+	return basket, err
+}
+
+func (t *tracedDatasource) AddBasket(ctx context.Context, basket *model.Basket) error {
+	ctx, span := tracing.Start(ctx, "Datasource.AddBasket", tracing.BasketIdKey.String(basket.Id))
+
+	err := t.ds.AddBasket(ctx, basket)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (t *tracedDatasource) DeleteBasket(ctx context.Context, id string) {
+	ctx, span := tracing.Start(ctx, "Datasource.DeleteBasket", tracing.BasketIdKey.String(id))
+	defer span.End()
+
+	t.ds.DeleteBasket(ctx, id)
+}
+
+func (t *tracedDatasource) AddOrder(ctx context.Context, order *model.Order) error {
+	ctx, span := tracing.Start(ctx, "Datasource.AddOrder", tracing.OrderIdKey.String(order.Id))
+
+	err := t.ds.AddOrder(ctx, order)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (t *tracedDatasource) GetOrder(ctx context.Context, id string) (*model.Order, error) {
+	ctx, span := tracing.Start(ctx, "Datasource.GetOrder", tracing.OrderIdKey.String(id))
+
+	order, err := t.ds.GetOrder(ctx, id)
+	tracing.End(span, err)
+
+	return order, err
+}
+
+func (t *tracedDatasource) UpdateOrderPayment(ctx context.Context, orderId string, from model.PaymentStatus, payment model.Payment) error {
+	ctx, span := tracing.Start(ctx, "Datasource.UpdateOrderPayment", tracing.OrderIdKey.String(orderId))
+
+	err := t.ds.UpdateOrderPayment(ctx, orderId, from, payment)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (t *tracedDatasource) GetExpiredBaskets(ctx context.Context, updatedBefore time.Time) []string {
+	ctx, span := tracing.Start(ctx, "Datasource.GetExpiredBaskets")
+	defer span.End()
+
+	return t.ds.GetExpiredBaskets(ctx, updatedBefore)
+}
+
+func (t *tracedDatasource) ReserveStock(ctx context.Context, basketId string, code model.ProductCode) error {
+	ctx, span := tracing.Start(ctx, "Datasource.ReserveStock",
+		tracing.BasketIdKey.String(basketId), tracing.ProductCodeKey.String(string(code)))
+
+	err := t.ds.ReserveStock(ctx, basketId, code)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (t *tracedDatasource) ReleaseStock(ctx context.Context, basketId string, code model.ProductCode) {
+	ctx, span := tracing.Start(ctx, "Datasource.ReleaseStock",
+		tracing.BasketIdKey.String(basketId), tracing.ProductCodeKey.String(string(code)))
+	defer span.End()
+
+	t.ds.ReleaseStock(ctx, basketId, code)
+}
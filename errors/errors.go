@@ -2,6 +2,7 @@ package errors
 
 import (
 	"fmt"
+	"strings"
 )
 
 type ProductNotFound struct {
@@ -21,6 +22,45 @@ type BasketNotFound struct {
 	Id string
 }
 
+// BasketClosed is returned when changing a basket already checked out
+type BasketClosed struct {
+	Id string
+}
+
+// OutOfStock is returned when no unit of a product is available to add to a basket
+type OutOfStock struct {
+	Code string
+}
+
+// PriceNotFound is returned when a product has no price in the currency of a basket
+type PriceNotFound struct {
+	Code     string
+	Currency string
+}
+
+// TaxRateNotFound is returned when the tax category of a product has no rate in a region
+type TaxRateNotFound struct {
+	Category string
+	Region   string
+}
+
+type OrderNotFound struct {
+	Id string
+}
+
+// PaymentStateError is returned when the payment of an order can't move to another status, like
+// refunding a payment not captured
+type PaymentStateError struct {
+	OrderId string
+	From    string
+	To      string
+}
+
+// FeatureDisabled is returned when using a feature not enabled in the configuration, like the taxes
+type FeatureDisabled struct {
+	Feature string
+}
+
 type PrimaryKeyError struct {
 	Id string
 }
@@ -55,6 +95,34 @@ func NewBasketNotFound(id string) *BasketNotFound {
 	return &BasketNotFound{Id: id}
 }
 
+func NewBasketClosed(id string) *BasketClosed {
+	return &BasketClosed{Id: id}
+}
+
+func NewOutOfStock(code string) *OutOfStock {
+	return &OutOfStock{Code: code}
+}
+
+func NewPriceNotFound(code, currency string) *PriceNotFound {
+	return &PriceNotFound{Code: code, Currency: currency}
+}
+
+func NewTaxRateNotFound(category, region string) *TaxRateNotFound {
+	return &TaxRateNotFound{Category: category, Region: region}
+}
+
+func NewOrderNotFound(id string) *OrderNotFound {
+	return &OrderNotFound{Id: id}
+}
+
+func NewPaymentStateError(orderId, from, to string) *PaymentStateError {
+	return &PaymentStateError{OrderId: orderId, From: from, To: to}
+}
+
+func NewFeatureDisabled(feature string) *FeatureDisabled {
+	return &FeatureDisabled{Feature: feature}
+}
+
 func NewPrimaryKeyError(id string) *PrimaryKeyError {
 	return &PrimaryKeyError{Id: id}
 }
@@ -85,6 +153,34 @@ func (b *BasketNotFound) Error() string {
 	return fmt.Sprintf("Basket %v not found", b.Id)
 }
 
+func (b *BasketClosed) Error() string {
+	return fmt.Sprintf("Basket %v is closed, it has already been checked out", b.Id)
+}
+
+func (o *OutOfStock) Error() string {
+	return fmt.Sprintf("Product %v out of stock", o.Code)
+}
+
+func (p *PriceNotFound) Error() string {
+	return fmt.Sprintf("Product %v has no price in %v", p.Code, p.Currency)
+}
+
+func (t *TaxRateNotFound) Error() string {
+	return fmt.Sprintf("No tax rate for category %v in region %v", t.Category, t.Region)
+}
+
+func (o *OrderNotFound) Error() string {
+	return fmt.Sprintf("Order %v not found", o.Id)
+}
+
+func (p *PaymentStateError) Error() string {
+	return fmt.Sprintf("Payment of order %v is %v, it can't be %v", p.OrderId, p.From, p.To)
+}
+
+func (f *FeatureDisabled) Error() string {
+	return fmt.Sprintf("%v not enabled", f.Feature)
+}
+
 func (p *PromotionInvalid) Error() string {
 	return fmt.Sprintf("Promotion %v invalid: %v", p.Code, p.Msg)
 }
@@ -94,5 +190,13 @@ func (p *PrimaryKeyError) Error() string {
 }
 
 func (e *ValidationError) Error() string {
-	return fmt.Sprint("There has been a validation error")
+	if len(e.Errors) == 0 {
+		return fmt.Sprint("There has been a validation error")
+	}
+
+	messages := make([]string, 0, len(e.Errors))
+	for _, description := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%v: %v", description.Field, description.Message))
+	}
+	return fmt.Sprintf("There has been a validation error: %v", strings.Join(messages, ", "))
 }
@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"fmt"
 	"github.com/alfcope/checkouttest/cli"
 	"github.com/stretchr/testify/suite"
@@ -32,31 +33,31 @@ func (suite *CheckoutServiceClientITSuite) SetupSuite() {
 }
 
 func (suite *CheckoutServiceClientITSuite) TestAddBasket() {
-	id, err := suite.client.AddBasket()
+	id, err := suite.client.AddBasket(context.Background())
 
 	suite.Nil(err)
 	suite.True(isUUID(id))
 }
 
 func (suite *CheckoutServiceClientITSuite) TestAddNonExistingProduct() {
-	id, err := suite.client.AddBasket()
+	id, err := suite.client.AddBasket(context.Background())
 	if err != nil {
 		suite.T().Errorf("error creating basket: %v", err.Error())
 	}
 
-	err = suite.client.AddItem(id, "FAKE")
+	err = suite.client.AddItem(context.Background(), id, "FAKE")
 
 	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
 }
 
 func (suite *CheckoutServiceClientITSuite) TestAddProductMultipleTimes() {
-	id, err := suite.client.AddBasket()
+	id, err := suite.client.AddBasket(context.Background())
 	if err != nil {
 		suite.T().Errorf("error creating basket: %v", err.Error())
 	}
 
 	for i := 0; i < 5; i++ {
-		err = suite.client.AddItem(id, "VOUCHER")
+		err = suite.client.AddItem(context.Background(), id, "VOUCHER")
 		if err != nil {
 			suite.T().Errorf("error adding product: %v", err.Error())
 		}
@@ -64,7 +65,7 @@ func (suite *CheckoutServiceClientITSuite) TestAddProductMultipleTimes() {
 }
 
 func (suite *CheckoutServiceClientITSuite) TestGetPrice() {
-	id, err := suite.client.AddBasket()
+	id, err := suite.client.AddBasket(context.Background())
 	if err != nil {
 		suite.T().Errorf("error creating basket: %v", err.Error())
 	}
@@ -72,13 +73,13 @@ func (suite *CheckoutServiceClientITSuite) TestGetPrice() {
 	products := []string{"VOUCHER", "TSHIRT", "MUG"}
 
 	for _, product := range products {
-		err = suite.client.AddItem(id, product)
+		err = suite.client.AddItem(context.Background(), id, product)
 		if err != nil {
 			suite.T().Errorf("error adding product: %v", err.Error())
 		}
 	}
 
-	price, err := suite.client.GetPrice(id)
+	price, err := suite.client.GetPrice(context.Background(), id)
 
 	suite.Nil(err)
 	suite.True(float64(3250)/100 == price)
@@ -87,28 +88,28 @@ func (suite *CheckoutServiceClientITSuite) TestGetPrice() {
 	products = []string{"VOUCHER", "VOUCHER", "TSHIRT", "TSHIRT"}
 
 	for _, product := range products {
-		err = suite.client.AddItem(id, product)
+		err = suite.client.AddItem(context.Background(), id, product)
 		if err != nil {
 			suite.T().Errorf("error adding product: %v", err.Error())
 		}
 	}
 
-	price, err = suite.client.GetPrice(id)
+	price, err = suite.client.GetPrice(context.Background(), id)
 
 	suite.Nil(err)
 	suite.True(float64(7450)/100 == price)
 }
 
 func (suite *CheckoutServiceClientITSuite) TestDeleteBasket() {
-	id, err := suite.client.AddBasket()
+	id, err := suite.client.AddBasket(context.Background())
 	if err != nil {
 		suite.T().Errorf("error creating basket: %v", err.Error())
 	}
 
-	err = suite.client.DeleteBasket(id)
+	err = suite.client.DeleteBasket(context.Background(), id)
 
 	suite.Nil(err)
 
-	err = suite.client.AddItem(id, "VOUCHER")
+	err = suite.client.AddItem(context.Background(), id, "VOUCHER")
 	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
 }
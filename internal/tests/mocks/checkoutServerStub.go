@@ -6,17 +6,21 @@ import (
 	"github.com/gorilla/mux"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"time"
 )
 
 type CheckoutServerStub struct {
 	url        string
 	httpServer *httptest.Server
 	context    StubContext
+	contextMux sync.RWMutex
 }
 
 type StubContext struct {
 	responseStatusCode int
 	payload            interface{}
+	delay              time.Duration
 }
 
 func NewCheckServerStub(path string) *CheckoutServerStub {
@@ -43,8 +47,15 @@ func (c *CheckoutServerStub) initializeRoutes(urlPath string) *mux.Router {
 	fmt.Printf("%v/baskets/\n", urlPath)
 	r.HandleFunc(fmt.Sprintf("%v/baskets/", urlPath), c.returnStub()).Methods("POST").Headers("Accept", "application/json")
 	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/items/", urlPath), c.returnStub()).Methods("POST").Headers("Content-Type", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/items/{code}", urlPath), c.returnStub()).Methods("DELETE")
 	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}", urlPath), c.returnStub()).Methods("GET").Queries("price", "").Headers("Accept", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}", urlPath), c.returnStub()).Methods("GET").Headers("Accept", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/receipt", urlPath), c.returnStub()).Methods("GET").Headers("Accept", "application/json")
 	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}", urlPath), c.returnStub()).Methods("DELETE")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/checkout", urlPath), c.returnStub()).Methods("POST")
+	r.HandleFunc(fmt.Sprintf("%v/orders/{id}", urlPath), c.returnStub()).Methods("GET").Headers("Accept", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/orders/{id}/payment", urlPath), c.returnStub()).Methods("POST")
+	r.HandleFunc(fmt.Sprintf("%v/orders/{id}/refund", urlPath), c.returnStub()).Methods("POST")
 
 	return r
 }
@@ -58,18 +69,41 @@ func (c *CheckoutServerStub) GetUrl() string {
 }
 
 func (c *CheckoutServerStub) StubResponse(statusCode int, payload interface{}) {
+	c.contextMux.Lock()
+	defer c.contextMux.Unlock()
+
 	c.context.responseStatusCode = statusCode
 	c.context.payload = payload
 }
 
+// StubDelay makes the stub wait before answering, or until the request is cancelled
+func (c *CheckoutServerStub) StubDelay(delay time.Duration) {
+	c.contextMux.Lock()
+	defer c.contextMux.Unlock()
+
+	c.context.delay = delay
+}
+
 func (c *CheckoutServerStub) returnStub() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(c.context.responseStatusCode)
+		c.contextMux.RLock()
+		stub := c.context
+		c.contextMux.RUnlock()
+
+		if stub.delay > 0 {
+			select {
+			case <-time.After(stub.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		w.WriteHeader(stub.responseStatusCode)
 
-		if c.context.payload != nil {
+		if stub.payload != nil {
 			w.Header().Set("Content-Type", "application/json")
 
-			jsonEncoded, err := json.Marshal(c.context.payload)
+			jsonEncoded, err := json.Marshal(stub.payload)
 
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
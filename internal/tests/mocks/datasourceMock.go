@@ -1,10 +1,13 @@
 package mocks
 
 import (
+	"context"
 	"github.com/alfcope/checkouttest/model"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
+// DatasourceMock does not record the context, expectations are set on the remaining arguments
 type DatasourceMock struct {
 	mock.Mock
 }
@@ -13,7 +16,7 @@ func NewDatasourceMock() *DatasourceMock {
 	return &DatasourceMock{}
 }
 
-func (d *DatasourceMock) GetProduct(code model.ProductCode) (model.Product, error) {
+func (d *DatasourceMock) GetProduct(ctx context.Context, code model.ProductCode) (model.Product, error) {
 	args := d.Called(code)
 
 	var err error
@@ -26,13 +29,13 @@ func (d *DatasourceMock) GetProduct(code model.ProductCode) (model.Product, erro
 	return args.Get(0).(model.Product), err
 }
 
-func (d *DatasourceMock) GetPromotions() []model.Promotion {
+func (d *DatasourceMock) GetPromotions(ctx context.Context) []model.Promotion {
 	args := d.Called()
 
 	return args.Get(0).([]model.Promotion)
 }
 
-func (d *DatasourceMock) GetBasket(id string) (*model.Basket, error) {
+func (d *DatasourceMock) GetBasket(ctx context.Context, id string) (*model.Basket, error) {
 	args := d.Called(id)
 
 	var err error
@@ -45,7 +48,7 @@ func (d *DatasourceMock) GetBasket(id string) (*model.Basket, error) {
 	return args.Get(0).(*model.Basket), err
 }
 
-func (d *DatasourceMock) AddBasket(basket *model.Basket) error {
+func (d *DatasourceMock) AddBasket(ctx context.Context, basket *model.Basket) error {
 	args := d.Called(basket)
 
 	var err error
@@ -58,6 +61,68 @@ func (d *DatasourceMock) AddBasket(basket *model.Basket) error {
 	return err
 }
 
-func (d *DatasourceMock) DeleteBasket(basketId string) {
+func (d *DatasourceMock) DeleteBasket(ctx context.Context, basketId string) {
 	d.Called(basketId)
 }
+
+func (d *DatasourceMock) GetExpiredBaskets(ctx context.Context, updatedBefore time.Time) []string {
+	args := d.Called(updatedBefore)
+
+	return args.Get(0).([]string)
+}
+
+func (d *DatasourceMock) ReserveStock(ctx context.Context, basketId string, code model.ProductCode) error {
+	args := d.Called(basketId, code)
+
+	var err error
+	if args.Get(0) == nil {
+		err = nil
+	} else {
+		err = args.Get(0).(error)
+	}
+
+	return err
+}
+
+func (d *DatasourceMock) ReleaseStock(ctx context.Context, basketId string, code model.ProductCode) {
+	d.Called(basketId, code)
+}
+
+func (d *DatasourceMock) AddOrder(ctx context.Context, order *model.Order) error {
+	args := d.Called(order)
+
+	var err error
+	if args.Get(0) == nil {
+		err = nil
+	} else {
+		err = args.Get(0).(error)
+	}
+
+	return err
+}
+
+func (d *DatasourceMock) UpdateOrderPayment(ctx context.Context, orderId string, from model.PaymentStatus, payment model.Payment) error {
+	args := d.Called(orderId, from, payment)
+
+	var err error
+	if args.Get(0) == nil {
+		err = nil
+	} else {
+		err = args.Get(0).(error)
+	}
+
+	return err
+}
+
+func (d *DatasourceMock) GetOrder(ctx context.Context, id string) (*model.Order, error) {
+	args := d.Called(id)
+
+	var err error
+	if args.Get(1) == nil {
+		err = nil
+	} else {
+		err = args.Get(1).(error)
+	}
+
+	return args.Get(0).(*model.Order), err
+}
@@ -1,26 +1,53 @@
 package model
 
 import (
+	"context"
+	"fmt"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"sort"
 	"sync"
+	"time"
 )
 
 type Basket struct {
-	Id    string
-	lines map[ProductCode]Line
+	Id string
+	// Owner of the basket, empty when it was created without authentication
+	Owner  string
+	Limits BasketLimits
+	// Currency the basket is priced in, chosen when it is created. Empty is the base currency.
+	Currency Currency
+	lines    map[ProductCode]Line
+	// closed once checked out, the lines can't change anymore
+	closed bool
+	// updatedAt is the time of the last change of the lines, baskets left unchanged expire
+	updatedAt time.Time
 
 	rwMux sync.RWMutex
 }
 
+// BasketLimits bounds the content of a basket, a zero value disables the limit
+type BasketLimits struct {
+	MaxLines        int
+	MaxLineQuantity int
+}
+
 type Line struct {
 	Product
 	amount int
 }
 
+func (l Line) GetAmount() int {
+	return l.amount
+}
+
 func NewBasket(id string) *Basket {
 	return &Basket{
-		Id:    id,
-		lines: make(map[ProductCode]Line),
-		rwMux: sync.RWMutex{},
+		Id:        id,
+		lines:     make(map[ProductCode]Line),
+		updatedAt: time.Now(),
+		rwMux:     sync.RWMutex{},
 	}
 }
 
@@ -28,51 +55,240 @@ func (b *Basket) AddProduct(p Product) error {
 	b.rwMux.Lock()
 	defer b.rwMux.Unlock()
 
+	if b.closed {
+		return errors.NewBasketClosed(b.Id)
+	}
+
 	err := p.Validate()
 	if err != nil {
 		return err
 	}
 
 	if l, ok := b.lines[p.Code]; ok {
+		if b.Limits.MaxLineQuantity > 0 && l.amount >= b.Limits.MaxLineQuantity {
+			return errors.NewValidationError([]*errors.ValidationErrorDescription{errors.NewValidationErrorDescription("code",
+				fmt.Sprintf("Quantity of product %v limited to %d", p.Code, b.Limits.MaxLineQuantity))})
+		}
 		l.amount++
 		b.lines[p.Code] = l
+		b.updatedAt = time.Now()
 		return nil
 	}
 
+	if b.Limits.MaxLines > 0 && len(b.lines) >= b.Limits.MaxLines {
+		return errors.NewValidationError([]*errors.ValidationErrorDescription{errors.NewValidationErrorDescription("code",
+			fmt.Sprintf("Basket limited to %d lines", b.Limits.MaxLines))})
+	}
+
 	b.lines[p.Code] = Line{
 		Product: p,
 		amount:  1,
 	}
+	b.updatedAt = time.Now()
 
 	return nil
 }
 
-func (b *Basket) CalculatePrice(offers []Promotion) float64 {
-	var productInOffer = make(map[ProductCode]*[]int)
-	var price = 0
+// RemoveProduct removes a unit of the product, the line is removed with its last unit
+func (b *Basket) RemoveProduct(code ProductCode) error {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	if b.closed {
+		return errors.NewBasketClosed(b.Id)
+	}
+
+	l, ok := b.lines[code]
+	if !ok {
+		return errors.NewProductNotFound(string(code))
+	}
+
+	if l.amount > 1 {
+		l.amount--
+		b.lines[code] = l
+	} else {
+		delete(b.lines, code)
+	}
+	b.updatedAt = time.Now()
+
+	return nil
+}
+
+// UpdatedAt returns the time of the last change of the lines, or the creation time
+func (b *Basket) UpdatedAt() time.Time {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.updatedAt
+}
+
+// GetLines returns a snapshot of the basket lines sorted by product code
+func (b *Basket) GetLines() []Line {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.sortedLines()
+}
+
+func (b *Basket) sortedLines() []Line {
+	lines := make([]Line, 0, len(b.lines))
+	for _, l := range b.lines {
+		lines = append(lines, l)
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].Code < lines[j].Code
+	})
+
+	return lines
+}
+
+// BasketPrice is the result of pricing a basket
+type BasketPrice struct {
+	// Lines priced, sorted by product code
+	Lines      []Line
+	Total      float64
+	Currency   Currency
+	Promotions []AppliedPromotion
+	// Charged has the amount charged for every product in cents, its discounts taken off
+	Charged map[ProductCode]int
+}
+
+// AppliedPromotion is a promotion that discounted some items of the basket
+type AppliedPromotion struct {
+	Type     PromotionType
+	Discount float64
+}
+
+func (b *Basket) CalculatePrice(ctx context.Context, offers []Promotion) float64 {
+	return b.Price(ctx, offers).Total
+}
+
+// Price prices the basket and reports the promotions applied. The lines are taken along with the
+// total so both match.
+func (b *Basket) Price(ctx context.Context, offers []Promotion) BasketPrice {
+	ctx, span := tracing.Start(ctx, "Basket.CalculatePrice", tracing.BasketIdKey.String(b.Id))
+	defer span.End()
 
+	_, lockSpan := tracing.Start(ctx, "Basket.Lock")
 	b.rwMux.Lock()
+	lockSpan.End()
 	defer b.rwMux.Unlock()
 
+	return b.price(ctx, offers)
+}
+
+// Checkout prices the basket and closes it at once, so the price is the one of the lines frozen.
+// A basket can only be checked out once.
+func (b *Basket) Checkout(ctx context.Context, offers []Promotion) (BasketPrice, error) {
+	ctx, span := tracing.Start(ctx, "Basket.Checkout", tracing.BasketIdKey.String(b.Id))
+	defer span.End()
+
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	if b.closed {
+		return BasketPrice{}, errors.NewBasketClosed(b.Id)
+	}
+
+	price := b.price(ctx, offers)
+	b.closed = true
+
+	return price, nil
+}
+
+// Reopen undoes a checkout whose order could not be stored
+func (b *Basket) Reopen() {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	b.closed = false
+}
+
+// IsClosed reports whether the basket has been checked out
+func (b *Basket) IsClosed() bool {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.closed
+}
+
+// price prices the basket, the caller holds the lock
+func (b *Basket) price(ctx context.Context, offers []Promotion) BasketPrice {
+	var productInOffer = make(map[ProductCode]*[]int)
+	var price = 0
+	var applied []AppliedPromotion
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.BasketLinesKey.Int(len(b.lines)))
+
 	if offers != nil && len(offers) > 0 {
 		for _, p := range offers {
+			alreadyInOffer := countInOffer(productInOffer)
+
+			_, resolveSpan := tracing.Start(ctx, "Promotion.Resolve",
+				tracing.PromotionTypeKey.String(string(p.GetType())), tracing.BasketLinesKey.Int(len(b.lines)))
 			p.Resolve(b.lines, productInOffer)
+			resolveSpan.End()
+
+			if discount, ok := b.promotionDiscount(productInOffer, alreadyInOffer); ok {
+				applied = append(applied, AppliedPromotion{Type: p.GetType(), Discount: float64(discount) / 100})
+			}
 		}
 	}
 
+	charged := make(map[ProductCode]int, len(b.lines))
 	for pcode, line := range b.lines {
+		linePrice := 0
 		inOfferCounter := 0
 		if inOffer, ok := productInOffer[pcode]; ok {
 			if inOffer != nil && len(*inOffer) > 0 {
 				inOfferCounter = len(*inOffer)
 				for _, offerPrice := range *inOffer {
-					price += offerPrice
+					linePrice += offerPrice
 				}
 			}
 		}
 
-		price += (line.amount - inOfferCounter) * line.Price
+		linePrice += (line.amount - inOfferCounter) * line.Price
+		charged[pcode] = linePrice
+		price += linePrice
+	}
+
+	return BasketPrice{
+		Lines:      b.sortedLines(),
+		Total:      float64(price) / 100,
+		Currency:   b.Currency,
+		Promotions: applied,
+		Charged:    charged,
+	}
+}
+
+func countInOffer(productInOffer map[ProductCode]*[]int) map[ProductCode]int {
+	counters := make(map[ProductCode]int, len(productInOffer))
+	for pcode, inOffer := range productInOffer {
+		if inOffer != nil {
+			counters[pcode] = len(*inOffer)
+		}
+	}
+	return counters
+}
+
+// promotionDiscount adds up the discount of the items put in offer since the counters were taken
+func (b *Basket) promotionDiscount(productInOffer map[ProductCode]*[]int, alreadyInOffer map[ProductCode]int) (int, bool) {
+	discount := 0
+	applied := false
+
+	for pcode, inOffer := range productInOffer {
+		if inOffer == nil || len(*inOffer) <= alreadyInOffer[pcode] {
+			continue
+		}
+
+		applied = true
+		for _, offerPrice := range (*inOffer)[alreadyInOffer[pcode]:] {
+			discount += b.lines[pcode].Price - offerPrice
+		}
 	}
 
-	return float64(price) / 100
+	return discount, applied
 }
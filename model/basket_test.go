@@ -1,17 +1,19 @@
 package model
 
 import (
+	"context"
 	"fmt"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/google/uuid"
 	"testing"
+	"time"
 )
 
 // Adding invalid product
 func TestAddFirstProduct(t *testing.T) {
 	basket := NewBasket(uuid.New().String())
 
-	err := basket.AddProduct(Product{"P1", "Product 1", -10})
+	err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: -10})
 	if err != nil {
 		if _, ok := err.(*errors.ValidationError); !ok {
 			t.Errorf("Expected validation error but got %T", err)
@@ -29,7 +31,7 @@ func TestAddFirstProduct(t *testing.T) {
 func TestAddProduct(t *testing.T) {
 	basket := NewBasket(uuid.New().String())
 
-	err := basket.AddProduct(Product{"P1", "Product 1", 800})
+	err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: 800})
 	if err != nil {
 		t.Error("Unexpected error ", err.Error())
 	}
@@ -53,7 +55,7 @@ func TestAddProductMultipleTimes(t *testing.T) {
 	var times = 3
 
 	for i := 0; i < times; i++ {
-		err := basket.AddProduct(Product{"P1", "Product 1", 800})
+		err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: 800})
 		if err != nil {
 			t.Error("Unexpected error ", err.Error())
 		}
@@ -72,13 +74,36 @@ func TestAddProductMultipleTimes(t *testing.T) {
 	}
 }
 
+// Adding over the basket limits
+func TestAddProductOverLimits(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.Limits = BasketLimits{MaxLines: 2, MaxLineQuantity: 2}
+
+	for _, code := range []ProductCode{"P1", "P1", "P2"} {
+		if err := basket.AddProduct(Product{Code: code, Name: "Product", Price: 800}); err != nil {
+			t.Fatal("Unexpected error ", err.Error())
+		}
+	}
+
+	if _, ok := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: 800}).(*errors.ValidationError); !ok {
+		t.Errorf("Expected validation error adding over the line quantity")
+	}
+	if _, ok := basket.AddProduct(Product{Code: "P3", Name: "Product 3", Price: 800}).(*errors.ValidationError); !ok {
+		t.Errorf("Expected validation error adding over the lines")
+	}
+
+	if len(basket.lines) != 2 || basket.lines["P1"].amount != 2 {
+		t.Errorf("Basket should not change over the limits")
+	}
+}
+
 // Adding multiple products
 func TestAddMultipleProducts(t *testing.T) {
 	basket := NewBasket(uuid.New().String())
 
 	for i := 1; i < 4; i++ {
-		err := basket.AddProduct(Product{ProductCode(fmt.Sprintf("P%d", i)),
-			fmt.Sprintf("Product %d", i), 100 * i})
+		err := basket.AddProduct(Product{Code: ProductCode(fmt.Sprintf("P%d", i)),
+			Name: fmt.Sprintf("Product %d", i), Price: 100 * i})
 		if err != nil {
 			t.Error("Unexpected error ", err.Error())
 		}
@@ -101,49 +126,49 @@ var basketPriceCases = []struct {
 	price  float64
 }{
 	{ // No active offers
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 3}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1000}, 3}},
 		[]Promotion{},
 		float64(1000*3) / 100,
 	}, { // Empty basket
 		map[ProductCode]Line{},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 820}}})},
 		float64(0),
 	}, { // Basket without any products in offer
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 3}},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{3, 820}}})},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1000}, 3}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{Buy: 3, Price: 820}}})},
 		float64(1000*3) / 100,
 	}, { // Basket with all products matching an offer
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 3}},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1000}, 3}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 820}}})},
 		float64(820*3) / 100,
 	}, { // Basket with products matching an offer several times
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 9}},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1000}, 9}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 820}}})},
 		float64(820*9) / 100,
 	}, { // Basket with products matching an offer several times plus extra number
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 7}},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1000}, 7}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 820}}})},
 		float64(820*7) / 100,
 	}, { // Basket with same products matching different offers
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 5}},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}, {2, 930}}})},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1000}, 5}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 820}, {Buy: 2, Price: 930}}})},
 		float64(820*5) / 100,
 	}, { // Basket with different products matching different offers
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1030}, 3},
-			"P2": {Product{"P2", "Prod name 2", 1545}, 3}},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 900}}}),
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1030}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: 1545}, 3}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
 			NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P2": {{3, 1}}})},
 		float64(900*3+1545*2) / 100,
 	}, { // Basket with different products matching same offer with rules for that products
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1030}, 3},
-			"P2": {Product{"P2", "Prod name 2", 1545}, 4}},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 900}}, "P2": {{3, 1210}}})},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1030}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: 1545}, 4}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 900}}, "P2": {{Buy: 3, Price: 1210}}})},
 		float64(900*3+1210*4) / 100,
 	}, { // Basket with different products matching same offer with rules for that products
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 500}, 3},
-			"P2": {Product{"P2", "Prod name 2", 2000}, 3},
-			"P3": {Product{"P3", "Prod name 3", 750}, 1}},
-		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{3, 1900}}}),
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 500}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: 2000}, 3},
+			"P3": {Product{Code: "P3", Name: "Prod name 3", Price: 750}, 1}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{Buy: 3, Price: 1900}}}),
 			NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}})},
 		float64(500*2+1900*3+750) / 100,
 	},
@@ -155,10 +180,176 @@ func TestBasketPrices(t *testing.T) {
 		basket := NewBasket(uuid.New().String())
 		basket.lines = tb.lines
 
-		p := basket.CalculatePrice(tb.offers)
+		p := basket.CalculatePrice(context.Background(), tb.offers)
 		fmt.Printf(" ------------ Price: %v\n", p)
 		if p != tb.price {
 			t.Errorf("Wanted %v but got %v", tb.price, p)
 		}
 	}
 }
+
+// Getting lines sorted by product code
+func TestGetLines(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P2": {Product{Code: "P2", Name: "Prod name 2", Price: 1545}, 2},
+		"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1030}, 3}}
+
+	lines := basket.GetLines()
+
+	if len(lines) != 2 {
+		t.Fatalf("Wanted 2 lines but got %v", len(lines))
+	}
+	if lines[0].Code != "P1" || lines[1].Code != "P2" {
+		t.Errorf("Lines not sorted by product code: %v", lines)
+	}
+	if lines[0].GetAmount() != 3 {
+		t.Errorf("Got amount %v when wanted 3", lines[0].GetAmount())
+	}
+}
+
+// Getting the promotions applied along with the total
+func TestBasketPriceDetails(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 500}, 3},
+		"P2": {Product{Code: "P2", Name: "Prod name 2", Price: 2000}, 1}}
+
+	price := basket.Price(context.Background(), []Promotion{
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{Buy: 3, Price: 1900}}}),
+		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}})})
+
+	if price.Total != float64(500*2+2000)/100 {
+		t.Errorf("Wanted %v but got %v", float64(500*2+2000)/100, price.Total)
+	}
+	if len(price.Lines) != 2 || price.Lines[0].Code != "P1" {
+		t.Errorf("Lines not sorted by product code: %v", price.Lines)
+	}
+	if len(price.Promotions) != 1 {
+		t.Fatalf("Wanted 1 promotion applied but got %v", price.Promotions)
+	}
+	if price.Promotions[0].Type != "FREE_ITEMS" || price.Promotions[0].Discount != 5 {
+		t.Errorf("Wanted a FREE_ITEMS discount of 5 but got %v", price.Promotions[0])
+	}
+}
+
+// Checking out freezes the basket
+func TestCheckout(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 500}, 3}}
+
+	price, err := basket.Checkout(context.Background(), []Promotion{
+		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if price.Total != 10 {
+		t.Errorf("Wanted 10 but got %v", price.Total)
+	}
+	if !basket.IsClosed() {
+		t.Errorf("Basket should be closed")
+	}
+
+	if err := basket.AddProduct(Product{Code: "P2", Name: "Prod name 2", Price: 100}); err == nil {
+		t.Errorf("Closed basket should not take products")
+	} else if _, ok := err.(*errors.BasketClosed); !ok {
+		t.Errorf("Wanted a basket closed error, got %T", err)
+	}
+	if _, err := basket.Checkout(context.Background(), nil); err == nil {
+		t.Errorf("Basket should not be checked out twice")
+	}
+
+	basket.Reopen()
+	if err := basket.AddProduct(Product{Code: "P2", Name: "Prod name 2", Price: 100}); err != nil {
+		t.Errorf("Reopened basket should take products: %v", err)
+	}
+}
+
+// Removing units of a product, the line goes with the last one
+func TestRemoveProduct(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 500}, 2}}
+	createdAt := basket.UpdatedAt()
+
+	if err := basket.RemoveProduct("P1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if basket.lines["P1"].amount != 1 {
+		t.Errorf("Wanted amount 1 but got %v", basket.lines["P1"].amount)
+	}
+	if basket.UpdatedAt().Before(createdAt) {
+		t.Errorf("Removing should update the basket")
+	}
+
+	if err := basket.RemoveProduct("P1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(basket.lines) != 0 {
+		t.Errorf("There should not be any line")
+	}
+
+	if err := basket.RemoveProduct("P1"); err == nil {
+		t.Errorf("Removing a product not in the basket should fail")
+	} else if _, ok := err.(*errors.ProductNotFound); !ok {
+		t.Errorf("Wanted a product not found error, got %T", err)
+	}
+
+	basket.closed = true
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 500}, 1}}
+	if err := basket.RemoveProduct("P1"); err == nil {
+		t.Errorf("Closed basket should not change")
+	} else if _, ok := err.(*errors.BasketClosed); !ok {
+		t.Errorf("Wanted a basket closed error, got %T", err)
+	}
+}
+
+func TestNewOrder(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.Owner = "store:store-1"
+	basket.lines = map[ProductCode]Line{"P2": {Product{Code: "P2", Name: "Prod name 2", Price: 1545}, 2},
+		"P1": {Product{Code: "P1", Name: "Prod name 1", Price: 1030}, 3}}
+
+	createdAt := time.Now()
+	order := NewOrder("order-1", basket, basket.Price(context.Background(), nil), createdAt)
+
+	if order.Id != "order-1" || order.BasketId != basket.Id || order.Owner != basket.Owner || order.CreatedAt != createdAt {
+		t.Errorf("Unexpected order %+v", order)
+	}
+	if order.Total != float64(1030*3+1545*2)/100 {
+		t.Errorf("Wanted %v but got %v", float64(1030*3+1545*2)/100, order.Total)
+	}
+	if len(order.Lines) != 2 || order.Lines[0].Code != "P1" || order.Lines[0].Amount != 3 || order.Lines[1].Price != 1545 {
+		t.Errorf("Unexpected lines %+v", order.Lines)
+	}
+	if order.Payment.Status != PaymentPending {
+		t.Errorf("New orders should be pending payment, got %v", order.Payment.Status)
+	}
+
+	// Later changes of the basket do not change the order
+	_ = basket.AddProduct(Product{Code: "P3", Name: "Prod name 3", Price: 100})
+	if len(order.Lines) != 2 {
+		t.Errorf("Order should not change with the basket")
+	}
+}
+
+func TestPaymentTransitions(t *testing.T) {
+	allowed := map[PaymentStatus][]PaymentStatus{
+		PaymentPending:    {PaymentAuthorized, PaymentFailed},
+		PaymentAuthorized: {PaymentCaptured, PaymentFailed, PaymentNeedsReconciliation},
+		PaymentCaptured:   {PaymentRefunded},
+		PaymentFailed:     {PaymentPending},
+	}
+	statuses := []PaymentStatus{PaymentPending, PaymentAuthorized, PaymentCaptured, PaymentFailed, PaymentRefunded,
+		PaymentNeedsReconciliation}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			expected := false
+			for _, s := range allowed[from] {
+				expected = expected || s == to
+			}
+
+			if got := (Payment{Status: from}).CanMoveTo(to); got != expected {
+				t.Errorf("From %v to %v: wanted %v but got %v", from, to, expected, got)
+			}
+		}
+	}
+}
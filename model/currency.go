@@ -0,0 +1,115 @@
+package model
+
+import (
+	"fmt"
+	"github.com/alfcope/checkouttest/errors"
+	"math"
+	"sort"
+)
+
+// Currency is the ISO 4217 code of a currency, EUR
+type Currency string
+
+// Currencies has the currencies the baskets can be priced in. The catalogue prices are in the
+// base currency. The accepted currencies are priced with the price lists of the products and
+// promotions, an amount without a price in one of them is not priced. The currencies with a rate
+// are opted in to the conversion, all their amounts are converted from the base ones so a basket
+// never mixes listed and converted prices.
+type Currencies struct {
+	Base Currency
+	// Accepted currencies priced with the price lists only, besides the base one
+	Accepted []Currency
+	// Rates from the base currency of the converted currencies, 0.85 when 1 EUR is 0.85 GBP
+	Rates map[Currency]float64
+}
+
+// Accepts reports whether the baskets can be priced in the currency
+func (c Currencies) Accepts(currency Currency) bool {
+	if currency == c.Base {
+		return true
+	}
+	if _, ok := c.Rates[currency]; ok {
+		return true
+	}
+	for _, accepted := range c.Accepted {
+		if accepted == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// Amount returns the amount in the currency of a base amount with its price list, false when the
+// currency is priced with the price lists and it has no price in it. An empty currency is the
+// base one.
+func (c Currencies) Amount(base int, prices map[Currency]int, currency Currency) (int, bool) {
+	if currency == "" || currency == c.Base {
+		return base, true
+	}
+	if rate, ok := c.Rates[currency]; ok {
+		return int(math.Round(float64(base) * rate)), true
+	}
+	price, ok := prices[currency]
+	return price, ok
+}
+
+// CheckCatalogue reports the prices of the products and bulk promotions in the converted
+// currencies, they would not be used, and the bulk rules without a price in an accepted currency,
+// the baskets in that currency would miss them
+func (c Currencies) CheckCatalogue(products []Product, promotions []Promotion) error {
+	var descriptions []*errors.ValidationErrorDescription
+	for _, p := range products {
+		for _, currency := range c.converted(p.Prices) {
+			descriptions = append(descriptions, errors.NewValidationErrorDescription(string(p.Code),
+				fmt.Sprintf("price in %v, converted with its rate", currency)))
+		}
+	}
+
+	for _, promotion := range promotions {
+		bulk, ok := promotion.(*BulkPromotion)
+		if !ok {
+			continue
+		}
+
+		codes := make([]string, 0, len(bulk.offers))
+		for pCode := range bulk.offers {
+			codes = append(codes, string(pCode))
+		}
+		sort.Strings(codes)
+
+		for _, code := range codes {
+			for _, rule := range bulk.offers[ProductCode(code)] {
+				field := fmt.Sprintf("%v.%v.buy%d", bulk.GetType(), code, rule.Buy)
+				for _, currency := range c.converted(rule.Prices) {
+					descriptions = append(descriptions, errors.NewValidationErrorDescription(field,
+						fmt.Sprintf("price in %v, converted with its rate", currency)))
+				}
+				for _, currency := range c.Accepted {
+					if _, ok := rule.Prices[currency]; !ok && currency != c.Base {
+						descriptions = append(descriptions, errors.NewValidationErrorDescription(field,
+							fmt.Sprintf("missing the price in %v", currency)))
+					}
+				}
+			}
+		}
+	}
+
+	if len(descriptions) > 0 {
+		return errors.NewValidationError(descriptions)
+	}
+	return nil
+}
+
+// converted returns the currencies of the price list converted with their rates, sorted
+func (c Currencies) converted(prices map[Currency]int) []Currency {
+	var currencies []Currency
+	for currency := range prices {
+		if _, ok := c.Rates[currency]; ok {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i] < currencies[j]
+	})
+	return currencies
+}
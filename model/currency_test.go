@@ -0,0 +1,139 @@
+package model
+
+import (
+	"github.com/alfcope/checkouttest/errors"
+	"reflect"
+	"testing"
+)
+
+var testCurrencies = Currencies{
+	Base:     "EUR",
+	Accepted: []Currency{"GBP"},
+	Rates:    map[Currency]float64{"USD": 1.085},
+}
+
+func TestAcceptedCurrencies(t *testing.T) {
+	for currency, accepted := range map[Currency]bool{"EUR": true, "GBP": true, "USD": true, "JPY": false} {
+		if testCurrencies.Accepts(currency) != accepted {
+			t.Errorf("Currency %v accepted should be %v", currency, accepted)
+		}
+	}
+}
+
+var amountCases = []struct {
+	currency Currency
+	prices   map[Currency]int
+	amount   int
+	ok       bool
+}{
+	{"", nil, 1000, true},
+	{"EUR", map[Currency]int{"EUR": 1, "GBP": 850}, 1000, true},
+	{"GBP", map[Currency]int{"GBP": 850}, 850, true},
+	// Accepted without rate, only priced with the price list
+	{"GBP", nil, 0, false},
+	// Converted and rounded to the cent, the price lists are not used
+	{"USD", nil, 1085, true},
+	{"USD", map[Currency]int{"USD": 1100}, 1085, true},
+	{"JPY", nil, 0, false},
+}
+
+func TestCurrencyAmounts(t *testing.T) {
+	for _, tc := range amountCases {
+		amount, ok := testCurrencies.Amount(1000, tc.prices, tc.currency)
+		if amount != tc.amount || ok != tc.ok {
+			t.Errorf("%v %v: got %v %v, wanted %v %v", tc.currency, tc.prices, amount, ok, tc.amount, tc.ok)
+		}
+	}
+}
+
+func TestProductPricedIn(t *testing.T) {
+	product := Product{Code: "P1", Name: "aaaa", Price: 1000, Prices: map[Currency]int{"GBP": 850}}
+
+	priced, err := product.PricedIn("GBP", testCurrencies)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if priced.Price != 850 || product.Price != 1000 {
+		t.Errorf("Wanted the price 850 leaving the product untouched, got %v and %v", priced.Price, product.Price)
+	}
+
+	_, err = Product{Code: "P2", Price: 1000}.PricedIn("GBP", testCurrencies)
+	if _, ok := err.(*errors.PriceNotFound); !ok {
+		t.Errorf("Wanted a price not found error, got %v", err)
+	}
+}
+
+func TestProductCurrencyPriceValidation(t *testing.T) {
+	product := Product{Code: "P1", Price: 1000, Prices: map[Currency]int{"GBP": 0}}
+
+	err := product.Validate()
+	validationError, ok := err.(*errors.ValidationError)
+	if !ok || len(validationError.Errors) != 1 || validationError.Errors[0].Field != "prices.GBP" {
+		t.Errorf("Wanted an invalid GBP price, got %v", err)
+	}
+}
+
+func TestPromotionsInCurrency(t *testing.T) {
+	free := NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P2": {{Buy: 2, Free: 1}}})
+	promotions := []Promotion{
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{
+			"P1": {{Buy: 3, Price: 900, Prices: map[Currency]int{"GBP": 760}}, {Buy: 5, Price: 800}},
+			"P2": {{Buy: 3, Price: 1000}},
+		}),
+		free,
+	}
+
+	if converted := PromotionsIn(promotions, "EUR", testCurrencies); !reflect.DeepEqual(converted, promotions) {
+		t.Errorf("The promotions should not change in the base currency, got %v", converted)
+	}
+
+	// The rules without a price in pounds are left out
+	converted := PromotionsIn(promotions, "GBP", testCurrencies)
+	expected := []Promotion{
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 760}}}),
+		free,
+	}
+	if !reflect.DeepEqual(converted, expected) {
+		t.Errorf("Got promotions %v, wanted %v", converted, expected)
+	}
+
+	converted = PromotionsIn(promotions, "USD", testCurrencies)
+	expected = []Promotion{
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{
+			"P1": {{Buy: 3, Price: 977}, {Buy: 5, Price: 868}},
+			"P2": {{Buy: 3, Price: 1085}},
+		}),
+		free,
+	}
+	if !reflect.DeepEqual(converted, expected) {
+		t.Errorf("Got promotions %v, wanted %v", converted, expected)
+	}
+}
+
+func TestCurrenciesCheckCatalogue(t *testing.T) {
+	products := []Product{
+		{Code: "P1", Price: 1000, Prices: map[Currency]int{"GBP": 850}},
+		{Code: "P2", Price: 1000},
+	}
+	promotions := []Promotion{
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 900, Prices: map[Currency]int{"GBP": 760}}}}),
+		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P2": {{Buy: 2, Free: 1}}}),
+	}
+
+	// A product without price in an accepted currency is refused when added to a basket
+	if err := testCurrencies.CheckCatalogue(products, promotions); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	products = append(products, Product{Code: "P3", Price: 1000, Prices: map[Currency]int{"USD": 1100}})
+	promotions = append(promotions, NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{Buy: 3, Price: 900}}}))
+
+	err := testCurrencies.CheckCatalogue(products, promotions)
+	validationError, ok := err.(*errors.ValidationError)
+	if !ok || len(validationError.Errors) != 2 {
+		t.Fatalf("Wanted a price in a converted currency and a bulk rule without price, got %v", err)
+	}
+	if validationError.Errors[0].Field != "P3" || validationError.Errors[1].Field != "BULK.P2.buy3" {
+		t.Errorf("Unexpected errors %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"github.com/alfcope/checkouttest/errors"
+	"sync"
+)
+
+// Inventory keeps the stock of the products with a limited stock and the units reserved by the
+// baskets. A unit is reserved when added to a basket, released when removed or the basket is
+// deleted, and committed, taken from the stock, when the basket is checked out.
+type Inventory struct {
+	mux    sync.Mutex
+	levels map[ProductCode]*StockLevel
+	// reservations has the units reserved by every basket of every product
+	reservations map[string]map[ProductCode]int
+}
+
+// StockLevel is the stock of a product, the units available are the ones on hand not reserved
+type StockLevel struct {
+	OnHand   int
+	Reserved int
+}
+
+func (s StockLevel) Available() int {
+	return s.OnHand - s.Reserved
+}
+
+// NewInventory creates the inventory with the units in stock of the products, the products not
+// in stock are unlimited
+func NewInventory(stock map[ProductCode]int) *Inventory {
+	inventory := &Inventory{
+		levels:       make(map[ProductCode]*StockLevel, len(stock)),
+		reservations: make(map[string]map[ProductCode]int),
+	}
+	for code, units := range stock {
+		inventory.levels[code] = &StockLevel{OnHand: units}
+	}
+	return inventory
+}
+
+// Reserve reserves a unit of the product for the basket, it fails with OutOfStock when none is
+// available
+func (i *Inventory) Reserve(basketId string, code ProductCode) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	level, limited := i.levels[code]
+	if !limited {
+		return nil
+	}
+	if level.Available() <= 0 {
+		return errors.NewOutOfStock(string(code))
+	}
+
+	level.Reserved++
+	reserved, ok := i.reservations[basketId]
+	if !ok {
+		reserved = make(map[ProductCode]int)
+		i.reservations[basketId] = reserved
+	}
+	reserved[code]++
+	return nil
+}
+
+// Release releases a unit of the product reserved by the basket
+func (i *Inventory) Release(basketId string, code ProductCode) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	i.take(basketId, code, 1)
+}
+
+// ReleaseBasket releases every unit reserved by the basket
+func (i *Inventory) ReleaseBasket(basketId string) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	for code, units := range i.reservations[basketId] {
+		i.take(basketId, code, units)
+	}
+}
+
+// ReleaseAll releases the units reserved by every basket
+func (i *Inventory) ReleaseAll() {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	for _, level := range i.levels {
+		level.Reserved = 0
+	}
+	i.reservations = make(map[string]map[ProductCode]int)
+}
+
+// Commit takes from the stock the units of the lines reserved by the basket
+func (i *Inventory) Commit(basketId string, lines map[ProductCode]int) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	for code, units := range lines {
+		if level, limited := i.levels[code]; limited {
+			level.OnHand -= units
+			i.take(basketId, code, units)
+		}
+	}
+}
+
+// Level returns the stock of the product, false when it is unlimited
+func (i *Inventory) Level(code ProductCode) (StockLevel, bool) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	level, limited := i.levels[code]
+	if !limited {
+		return StockLevel{}, false
+	}
+	return *level, true
+}
+
+// take removes units reserved by the basket, no more than the ones it has. The caller holds the lock.
+func (i *Inventory) take(basketId string, code ProductCode, units int) {
+	reserved := i.reservations[basketId]
+	if reserved[code] < units {
+		units = reserved[code]
+	}
+	if units <= 0 {
+		return
+	}
+
+	i.levels[code].Reserved -= units
+	reserved[code] -= units
+	if reserved[code] == 0 {
+		delete(reserved, code)
+	}
+	if len(reserved) == 0 {
+		delete(i.reservations, basketId)
+	}
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"github.com/alfcope/checkouttest/errors"
+	"sync"
+	"testing"
+)
+
+func TestReserveStock(t *testing.T) {
+	inventory := NewInventory(map[ProductCode]int{"P1": 2})
+
+	for i := 0; i < 2; i++ {
+		if err := inventory.Reserve("basket-1", "P1"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	err := inventory.Reserve("basket-2", "P1")
+	if _, ok := err.(*errors.OutOfStock); !ok {
+		t.Errorf("Wanted an out of stock error, got %v", err)
+	}
+
+	// Products without stock are unlimited
+	if err := inventory.Reserve("basket-2", "P2"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, limited := inventory.Level("P2"); limited {
+		t.Errorf("P2 should be unlimited")
+	}
+
+	if level, _ := inventory.Level("P1"); level.OnHand != 2 || level.Reserved != 2 || level.Available() != 0 {
+		t.Errorf("Unexpected level %+v", level)
+	}
+}
+
+func TestReleaseStock(t *testing.T) {
+	inventory := NewInventory(map[ProductCode]int{"P1": 3, "P2": 1})
+	_ = inventory.Reserve("basket-1", "P1")
+	_ = inventory.Reserve("basket-1", "P1")
+	_ = inventory.Reserve("basket-1", "P2")
+
+	inventory.Release("basket-1", "P1")
+	if level, _ := inventory.Level("P1"); level.Reserved != 1 {
+		t.Errorf("Wanted 1 unit reserved but got %v", level.Reserved)
+	}
+
+	// Units not reserved by the basket are not released
+	inventory.Release("basket-2", "P2")
+	if level, _ := inventory.Level("P2"); level.Reserved != 1 {
+		t.Errorf("Wanted 1 unit reserved but got %v", level.Reserved)
+	}
+
+	inventory.ReleaseBasket("basket-1")
+	for _, code := range []ProductCode{"P1", "P2"} {
+		if level, _ := inventory.Level(code); level.Reserved != 0 {
+			t.Errorf("%v: wanted no units reserved but got %v", code, level.Reserved)
+		}
+	}
+}
+
+func TestReleaseAllStock(t *testing.T) {
+	inventory := NewInventory(map[ProductCode]int{"P1": 3})
+	_ = inventory.Reserve("basket-1", "P1")
+	_ = inventory.Reserve("basket-2", "P1")
+
+	inventory.ReleaseAll()
+
+	if level, _ := inventory.Level("P1"); level.Reserved != 0 || level.Available() != 3 {
+		t.Errorf("Unexpected level %+v", level)
+	}
+	// The reservations are gone, releasing them again changes nothing
+	inventory.ReleaseBasket("basket-1")
+	if level, _ := inventory.Level("P1"); level.Reserved != 0 {
+		t.Errorf("Unexpected level %+v", level)
+	}
+}
+
+func TestCommitStock(t *testing.T) {
+	inventory := NewInventory(map[ProductCode]int{"P1": 5})
+	_ = inventory.Reserve("basket-1", "P1")
+	_ = inventory.Reserve("basket-1", "P1")
+	_ = inventory.Reserve("basket-2", "P1")
+
+	inventory.Commit("basket-1", map[ProductCode]int{"P1": 2, "P2": 1})
+
+	if level, _ := inventory.Level("P1"); level.OnHand != 3 || level.Reserved != 1 || level.Available() != 2 {
+		t.Errorf("Unexpected level %+v", level)
+	}
+
+	// The basket has nothing left to release
+	inventory.ReleaseBasket("basket-1")
+	if level, _ := inventory.Level("P1"); level.Reserved != 1 {
+		t.Errorf("Wanted the reservation of basket-2 but got %v", level.Reserved)
+	}
+}
+
+// Concurrent baskets never reserve more units than the ones on hand
+func TestReserveStockConcurrently(t *testing.T) {
+	inventory := NewInventory(map[ProductCode]int{"P1": 50})
+
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	reserved := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := inventory.Reserve(string(rune('a'+i%10)), "P1"); err == nil {
+				mux.Lock()
+				reserved++
+				mux.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if reserved != 50 {
+		t.Errorf("Wanted 50 units reserved but got %v", reserved)
+	}
+	if level, _ := inventory.Level("P1"); level.Available() != 0 || level.Reserved != 50 {
+		t.Errorf("Unexpected level %+v", level)
+	}
+}
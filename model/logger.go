@@ -0,0 +1,14 @@
+package model
+
+import (
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// logger receives the traces of the promotions resolution, logged at debug level
+var logger logrus.FieldLogger = logging.Logger
+
+// SetLogger replaces the logger used by the model
+func SetLogger(l logrus.FieldLogger) {
+	logger = l
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"time"
+)
+
+// Order is the purchase of a checked out basket. It keeps the lines, prices and promotions of the
+// basket at the checkout, later changes of the catalogue do not change it.
+type Order struct {
+	Id       string
+	BasketId string
+	// Owner of the basket, who can read the order
+	Owner      string
+	Lines      []OrderLine
+	Promotions []AppliedPromotion
+	Total      float64
+	Currency   Currency
+	// Receipt of the order with its taxes, nil when the taxes are not calculated
+	Receipt   *Receipt
+	CreatedAt time.Time
+	Payment   Payment
+}
+
+type OrderLine struct {
+	Code   ProductCode
+	Name   string
+	Price  int
+	Amount int
+}
+
+// NewOrder creates the order of a basket with the price got at its checkout
+func NewOrder(id string, basket *Basket, price BasketPrice, createdAt time.Time) *Order {
+	order := &Order{
+		Id:         id,
+		BasketId:   basket.Id,
+		Owner:      basket.Owner,
+		Lines:      make([]OrderLine, 0, len(price.Lines)),
+		Promotions: append([]AppliedPromotion{}, price.Promotions...),
+		Total:      price.Total,
+		Currency:   price.Currency,
+		CreatedAt:  createdAt,
+		Payment:    Payment{Status: PaymentPending, UpdatedAt: createdAt},
+	}
+
+	for _, l := range price.Lines {
+		order.Lines = append(order.Lines, OrderLine{
+			Code:   l.Code,
+			Name:   l.Name,
+			Price:  l.Price,
+			Amount: l.GetAmount(),
+		})
+	}
+
+	return order
+}
+
+type PaymentStatus string
+
+const (
+	// PaymentPending is the status of the orders whose payment has not been taken yet
+	PaymentPending    PaymentStatus = "pending"
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	// PaymentFailed is the status of the payments declined, timed out or voided, they can be retried
+	PaymentFailed   PaymentStatus = "failed"
+	PaymentRefunded PaymentStatus = "refunded"
+	// PaymentNeedsReconciliation is the status of the payments whose capture failed without
+	// knowing whether the gateway took it, and whose authorization could not be voided. They
+	// can't be retried, the order is checked against the gateway by hand.
+	PaymentNeedsReconciliation PaymentStatus = "needs_reconciliation"
+)
+
+// paymentTransitions has the statuses a payment can move to from every status
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentPending:             {PaymentAuthorized, PaymentFailed},
+	PaymentAuthorized:          {PaymentCaptured, PaymentFailed, PaymentNeedsReconciliation},
+	PaymentCaptured:            {PaymentRefunded},
+	PaymentFailed:              {PaymentPending},
+	PaymentRefunded:            {},
+	PaymentNeedsReconciliation: {},
+}
+
+// Payment is the state of the payment of an order
+type Payment struct {
+	Status PaymentStatus
+	// Id given by the gateway to the authorization, the capture and refund refer to it
+	AuthorizationId string
+	// Reason of the last failure, empty unless failed or needing reconciliation
+	FailureReason string
+	UpdatedAt     time.Time
+}
+
+// CanMoveTo reports whether the payment can go from its status to the given one
+func (p Payment) CanMoveTo(status PaymentStatus) bool {
+	for _, s := range paymentTransitions[p.Status] {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
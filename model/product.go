@@ -11,6 +11,10 @@ type Product struct {
 	Code  ProductCode `json:"code"`
 	Name  string      `json:"name"`
 	Price int         `json:"price"`
+	// Prices in other currencies than the base one, the price is in the base currency
+	Prices map[Currency]int `json:"prices,omitempty"`
+	// TaxCategory selects the tax rate of the product, the standard one when not set
+	TaxCategory TaxCategory `json:"taxCategory,omitempty"`
 }
 
 func (p *Product) Validate() error {
@@ -25,9 +29,36 @@ func (p *Product) Validate() error {
 		validationErrorDescriptions = append(validationErrorDescriptions, errors.NewValidationErrorDescription("price", "Invalid product price"))
 	}
 
+	for currency, price := range p.Prices {
+		if price <= 0 {
+			validationErrorDescriptions = append(validationErrorDescriptions,
+				errors.NewValidationErrorDescription("prices."+string(currency), "Invalid product price"))
+		}
+	}
+
 	if len(validationErrorDescriptions) > 0 {
 		return errors.NewValidationError(validationErrorDescriptions)
 	}
 
 	return nil
 }
+
+// PricedIn returns the product with its price in the currency, it fails with PriceNotFound when
+// it has no price in the currency
+func (p Product) PricedIn(currency Currency, currencies Currencies) (Product, error) {
+	price, ok := currencies.Amount(p.Price, p.Prices, currency)
+	if !ok {
+		return Product{}, errors.NewPriceNotFound(string(p.Code), string(currency))
+	}
+
+	p.Price = price
+	return p, nil
+}
+
+// taxCategory returns the lower case tax category of the product, the standard one when not set
+func (p Product) taxCategory() TaxCategory {
+	if p.TaxCategory == "" {
+		return StandardTax
+	}
+	return TaxCategory(strings.ToLower(string(p.TaxCategory)))
+}
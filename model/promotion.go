@@ -1,7 +1,7 @@
 package model
 
 import (
-	"log"
+	"github.com/sirupsen/logrus"
 )
 
 type PromotionType string
@@ -9,6 +9,22 @@ type PromotionType string
 type Promotion interface {
 	GetType() PromotionType
 	Resolve(map[ProductCode]Line, map[ProductCode]*[]int)
+	// InCurrency returns the promotion with its amounts in the currency, the rules without an
+	// amount in it are left out. Currencies.CheckCatalogue reports them.
+	InCurrency(Currency, Currencies) Promotion
+}
+
+// PromotionsIn returns the promotions with their amounts in the currency
+func PromotionsIn(promotions []Promotion, currency Currency, currencies Currencies) []Promotion {
+	if currency == "" || currency == currencies.Base {
+		return promotions
+	}
+
+	converted := make([]Promotion, 0, len(promotions))
+	for _, p := range promotions {
+		converted = append(converted, p.InCurrency(currency, currencies))
+	}
+	return converted
 }
 
 type BulkPromotion struct {
@@ -19,8 +35,10 @@ type BulkPromotion struct {
 }
 
 type BulkOfferRule struct {
-	Buy   int
-	Price int
+	Buy int
+	// Price in the base currency, Prices has the ones in other currencies
+	Price  int
+	Prices map[Currency]int
 }
 
 func NewBulkPromotion(offers map[ProductCode][]BulkOfferRule) *BulkPromotion {
@@ -33,14 +51,29 @@ func (b BulkPromotion) GetType() PromotionType {
 	return "BULK"
 }
 
-func (b BulkPromotion) Resolve(lines map[ProductCode]Line, inOffer map[ProductCode]*[]int) {
-	log.Printf("--- Bulk Promotion ---")
+func (b BulkPromotion) InCurrency(currency Currency, currencies Currencies) Promotion {
+	offers := make(map[ProductCode][]BulkOfferRule, len(b.offers))
 	for pCode, rules := range b.offers {
-		log.Println("\tProduct: ", pCode)
+		for _, rule := range rules {
+			price, ok := currencies.Amount(rule.Price, rule.Prices, currency)
+			if !ok {
+				logger.WithFields(logrus.Fields{
+					"promotion": b.GetType(),
+					"product":   pCode,
+					"currency":  currency,
+				}).Warn("Bulk rule without price in the currency left out")
+				continue
+			}
 
-		if line, ok := lines[pCode]; ok {
-			log.Printf("\tFound %v in the basket\n", line.amount)
+			offers[pCode] = append(offers[pCode], BulkOfferRule{Buy: rule.Buy, Price: price})
+		}
+	}
+	return NewBulkPromotion(offers)
+}
 
+func (b BulkPromotion) Resolve(lines map[ProductCode]Line, inOffer map[ProductCode]*[]int) {
+	for pCode, rules := range b.offers {
+		if line, ok := lines[pCode]; ok {
 			for _, rule := range rules {
 				amountAvailable := line.amount
 				alreadyInOffer, ok := inOffer[pCode]
@@ -50,22 +83,26 @@ func (b BulkPromotion) Resolve(lines map[ProductCode]Line, inOffer map[ProductCo
 				}
 
 				//promotions := amountAvailable / rule.Buy
-				//log.Printf("\tEnough items for %v rule %v\n", promotions, rule)
 				if amountAvailable >= rule.Buy {
 					//elements := promotions * rule.Buy
 
 					if !ok || alreadyInOffer == nil {
-						log.Printf("\tCreating offer slice for product: %v\n", pCode)
 						inOffer[pCode] = &[]int{}
 					}
 
 					for i := 0; i < amountAvailable; i++ {
 						*inOffer[pCode] = append(*inOffer[pCode], rule.Price)
-						log.Printf("\tinOffer length: %v\n", len(*inOffer[pCode]))
-
-						log.Printf("\t%v elements remaining\n", amountAvailable-i-1)
 					}
 				}
+
+				logger.WithFields(logrus.Fields{
+					"promotion": b.GetType(),
+					"product":   pCode,
+					"amount":    line.amount,
+					"available": amountAvailable,
+					"buy":       rule.Buy,
+					"applied":   amountAvailable >= rule.Buy,
+				}).Debug("Bulk rule resolved")
 			}
 		}
 	}
@@ -91,14 +128,14 @@ func (f FreeItemsPromotion) GetType() PromotionType {
 	return "FREE_ITEMS"
 }
 
+// InCurrency returns the promotion as it is, it has no amounts
+func (f FreeItemsPromotion) InCurrency(Currency, Currencies) Promotion {
+	return &f
+}
+
 func (f FreeItemsPromotion) Resolve(lines map[ProductCode]Line, inOffer map[ProductCode]*[]int) {
-	log.Printf("--- Free Items Promotion ---")
 	for pCode, rules := range f.offers {
-		log.Println("\tProduct: ", pCode)
-
 		if line, ok := lines[pCode]; ok {
-			log.Printf("\tFound %v in the basket\n", line.amount)
-
 			for _, rule := range rules {
 				amountAvailable := line.amount
 				alreadyInOffer, ok := inOffer[pCode]
@@ -108,12 +145,10 @@ func (f FreeItemsPromotion) Resolve(lines map[ProductCode]Line, inOffer map[Prod
 				}
 
 				promotions := amountAvailable / rule.Buy
-				log.Printf("\tEnough items for %v rule %v\n", promotions, rule)
 				if promotions > 0 {
 					elements := promotions * rule.Buy
 
 					if !ok || alreadyInOffer == nil {
-						log.Printf("\tCreating offer slice for product: %v\n", pCode)
 						inOffer[pCode] = &[]int{}
 					}
 
@@ -123,12 +158,18 @@ func (f FreeItemsPromotion) Resolve(lines map[ProductCode]Line, inOffer map[Prod
 						} else {
 							*inOffer[pCode] = append(*inOffer[pCode], line.Product.Price)
 						}
-
-						log.Printf("\tinOffer length: %v\n", len(*inOffer[pCode]))
-
-						log.Printf("\t%v elements remaining\n", elements-i-1)
 					}
 				}
+
+				logger.WithFields(logrus.Fields{
+					"promotion":  f.GetType(),
+					"product":    pCode,
+					"amount":     line.amount,
+					"available":  amountAvailable,
+					"buy":        rule.Buy,
+					"free":       rule.Free,
+					"promotions": promotions,
+				}).Debug("Free items rule resolved")
 			}
 		}
 	}
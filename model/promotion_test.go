@@ -1,6 +1,9 @@
 package model
 
 import (
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"testing"
 )
 
@@ -151,3 +154,35 @@ func TestPromotions(t *testing.T) {
 
 	}
 }
+
+func TestPromotionsLogAtDebugLevel(t *testing.T) {
+	testLogger, hook := test.NewNullLogger()
+	SetLogger(testLogger)
+	defer SetLogger(logging.Logger)
+
+	lines := map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1500}, amount: 40}}
+	promotions := []Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
+		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{Buy: 3, Free: 1}}})}
+
+	// Info level discards the resolution traces
+	for _, p := range promotions {
+		p.Resolve(lines, make(map[ProductCode]*[]int))
+	}
+	if len(hook.Entries) != 0 {
+		t.Errorf("Expected no entries at info level but got %d", len(hook.Entries))
+	}
+
+	// A single entry per rule, not per unit
+	testLogger.SetLevel(logrus.DebugLevel)
+	for _, p := range promotions {
+		p.Resolve(lines, make(map[ProductCode]*[]int))
+	}
+	if len(hook.Entries) != 2 {
+		t.Fatalf("Expected 2 entries but got %d", len(hook.Entries))
+	}
+	for _, entry := range hook.Entries {
+		if entry.Level != logrus.DebugLevel || entry.Data["product"] != ProductCode("P1") {
+			t.Errorf("Unexpected log entry %v", entry)
+		}
+	}
+}
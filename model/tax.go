@@ -0,0 +1,179 @@
+package model
+
+import (
+	"fmt"
+	"github.com/alfcope/checkouttest/errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+type TaxCategory string
+
+// StandardTax is the category of the products without one
+const StandardTax TaxCategory = "standard"
+
+// PricingMode tells whether the catalogue prices include the tax
+type PricingMode string
+
+const (
+	// TaxInclusive prices are the gross, the tax is taken out of them
+	TaxInclusive PricingMode = "inclusive"
+	// TaxExclusive prices are the net, the tax is added to them
+	TaxExclusive PricingMode = "exclusive"
+)
+
+// TaxRates has the rate, in percent, of every tax category of a region
+type TaxRates map[TaxCategory]float64
+
+// TaxPolicy has the tax rates of the regions sold to and how the catalogue prices are taxed. The
+// regions and categories of the rates are lower case, the ones of the products and the region
+// asked are matched regardless of their case.
+type TaxPolicy struct {
+	Mode PricingMode
+	// Region taxed when none is given
+	DefaultRegion string
+	Rates         map[string]TaxRates
+}
+
+// Receipt is the price of a basket split into its net and its taxes
+type Receipt struct {
+	Region   string
+	Mode     PricingMode
+	Currency Currency
+	// Lines sorted by product code
+	Lines []ReceiptLine
+	// Taxes has a line per rate, sorted by rate
+	Taxes []TaxLine
+	Net   float64
+	Tax   float64
+	Gross float64
+}
+
+// ReceiptLine is a product of the receipt, its total is the amount charged once the discount of
+// the promotions is taken off, with or without the tax as the catalogue prices
+type ReceiptLine struct {
+	Code     ProductCode
+	Name     string
+	Price    int
+	Amount   int
+	Discount float64
+	Total    float64
+	Category TaxCategory
+	Rate     float64
+}
+
+// TaxLine is the tax of the lines taxed at a rate
+type TaxLine struct {
+	Rate float64
+	Net  float64
+	Tax  float64
+}
+
+// Receipt splits the price of a basket into its net and its taxes in the region, the default one
+// when empty. The discounts are taken off the products they were given to before the tax, and the
+// tax is rounded once per rate.
+func (t TaxPolicy) Receipt(price BasketPrice, region string) (Receipt, error) {
+	if region == "" {
+		region = t.DefaultRegion
+	}
+	region = strings.ToLower(region)
+
+	rates, ok := t.Rates[region]
+	if !ok {
+		return Receipt{}, errors.NewValidationError([]*errors.ValidationErrorDescription{
+			errors.NewValidationErrorDescription("region", fmt.Sprintf("Unknown tax region %v", region))})
+	}
+
+	receipt := Receipt{
+		Region:   region,
+		Mode:     t.Mode,
+		Currency: price.Currency,
+		Lines:    make([]ReceiptLine, 0, len(price.Lines)),
+	}
+
+	// Amount charged at every rate, in cents
+	byRate := make(map[float64]int)
+	for _, l := range price.Lines {
+		category := l.taxCategory()
+		rate, ok := rates[category]
+		if !ok {
+			return Receipt{}, errors.NewTaxRateNotFound(string(category), region)
+		}
+
+		charged, ok := price.Charged[l.Code]
+		if !ok {
+			charged = l.Price * l.amount
+		}
+		byRate[rate] += charged
+
+		receipt.Lines = append(receipt.Lines, ReceiptLine{
+			Code:     l.Code,
+			Name:     l.Name,
+			Price:    l.Price,
+			Amount:   l.amount,
+			Discount: float64(l.Price*l.amount-charged) / 100,
+			Total:    float64(charged) / 100,
+			Category: category,
+			Rate:     rate,
+		})
+	}
+
+	var net, tax int
+	for rate, charged := range byRate {
+		rateNet, rateTax := t.split(charged, rate)
+		net += rateNet
+		tax += rateTax
+
+		receipt.Taxes = append(receipt.Taxes, TaxLine{
+			Rate: rate,
+			Net:  float64(rateNet) / 100,
+			Tax:  float64(rateTax) / 100,
+		})
+	}
+	sort.Slice(receipt.Taxes, func(i, j int) bool {
+		return receipt.Taxes[i].Rate < receipt.Taxes[j].Rate
+	})
+
+	receipt.Net = float64(net) / 100
+	receipt.Tax = float64(tax) / 100
+	receipt.Gross = float64(net+tax) / 100
+	return receipt, nil
+}
+
+// CheckCatalogue reports the tax categories of the products without a rate in some region, their
+// receipts could not be made
+func (t TaxPolicy) CheckCatalogue(products []Product) error {
+	regions := make([]string, 0, len(t.Rates))
+	for region := range t.Rates {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	var descriptions []*errors.ValidationErrorDescription
+	for _, region := range regions {
+		for _, p := range products {
+			category := p.taxCategory()
+			if _, ok := t.Rates[region][category]; !ok {
+				descriptions = append(descriptions, errors.NewValidationErrorDescription("tax.rates."+region,
+					fmt.Sprintf("missing the rate of the category %v of product %v", category, p.Code)))
+			}
+		}
+	}
+
+	if len(descriptions) > 0 {
+		return errors.NewValidationError(descriptions)
+	}
+	return nil
+}
+
+// split returns the net and the tax, in cents, of an amount charged at the rate
+func (t TaxPolicy) split(charged int, rate float64) (int, int) {
+	if t.Mode == TaxExclusive {
+		tax := int(math.Round(float64(charged) * rate / 100))
+		return charged, tax
+	}
+
+	net := int(math.Round(float64(charged) * 100 / (100 + rate)))
+	return net, charged - net
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/google/uuid"
+	"testing"
+)
+
+var testTaxes = map[string]TaxRates{
+	"es": {StandardTax: 21, "reduced": 10, "exempt": 0},
+	"pt": {StandardTax: 23, "reduced": 13, "exempt": 0},
+}
+
+func taxedBasket() *Basket {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{
+		"TSHIRT":  {Product{Code: "TSHIRT", Name: "T-Shirt", Price: 2000}, 3},
+		"BOOK":    {Product{Code: "BOOK", Name: "Book", Price: 1500, TaxCategory: "Reduced"}, 1},
+		"VOUCHER": {Product{Code: "VOUCHER", Name: "Voucher", Price: 500, TaxCategory: "exempt"}, 3},
+	}
+	return basket
+}
+
+// Tax inclusive prices, the discounts taken off the products before the tax
+func TestReceiptTaxInclusive(t *testing.T) {
+	basket := taxedBasket()
+	price := basket.Price(context.Background(), []Promotion{
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"TSHIRT": {{Buy: 3, Price: 1900}}}),
+		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"VOUCHER": {{Buy: 2, Free: 1}}}),
+	})
+
+	receipt, err := TaxPolicy{Mode: TaxInclusive, DefaultRegion: "es", Rates: testTaxes}.Receipt(price, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if receipt.Gross != price.Total {
+		t.Errorf("Gross %v should be the basket total %v", receipt.Gross, price.Total)
+	}
+	// 57 at 21%, 15 at 10% and 10 exempt
+	expected := []TaxLine{{Rate: 0, Net: 10, Tax: 0}, {Rate: 10, Net: 13.64, Tax: 1.36}, {Rate: 21, Net: 47.11, Tax: 9.89}}
+	if len(receipt.Taxes) != len(expected) {
+		t.Fatalf("Wanted %v but got %v", expected, receipt.Taxes)
+	}
+	for i := range expected {
+		if receipt.Taxes[i] != expected[i] {
+			t.Errorf("Wanted %v but got %v", expected[i], receipt.Taxes[i])
+		}
+	}
+	if receipt.Net != 70.75 || receipt.Tax != 11.25 || receipt.Gross != 82 {
+		t.Errorf("Unexpected totals net %v tax %v gross %v", receipt.Net, receipt.Tax, receipt.Gross)
+	}
+
+	if len(receipt.Lines) != 3 || receipt.Lines[0].Code != "BOOK" || receipt.Lines[0].Category != "reduced" {
+		t.Fatalf("Unexpected lines %+v", receipt.Lines)
+	}
+	if tshirt := receipt.Lines[1]; tshirt.Discount != 3 || tshirt.Total != 57 || tshirt.Rate != 21 || tshirt.Category != StandardTax {
+		t.Errorf("Unexpected line %+v", tshirt)
+	}
+	if voucher := receipt.Lines[2]; voucher.Discount != 5 || voucher.Total != 10 {
+		t.Errorf("Unexpected line %+v", voucher)
+	}
+}
+
+// Tax exclusive prices, the tax is added to the discounted prices
+func TestReceiptTaxExclusive(t *testing.T) {
+	basket := taxedBasket()
+	price := basket.Price(context.Background(), []Promotion{
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"TSHIRT": {{Buy: 3, Price: 1900}}}),
+	})
+
+	receipt, err := TaxPolicy{Mode: TaxExclusive, DefaultRegion: "es", Rates: testTaxes}.Receipt(price, "PT")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if receipt.Region != "pt" {
+		t.Errorf("Wanted region pt but got %v", receipt.Region)
+	}
+	// 57 at 23%, 15 at 13% and 15 exempt
+	if receipt.Net != price.Total || receipt.Net != 87 {
+		t.Errorf("Net %v should be the basket total %v", receipt.Net, price.Total)
+	}
+	if receipt.Tax != 15.06 || receipt.Gross != 102.06 {
+		t.Errorf("Unexpected tax %v and gross %v", receipt.Tax, receipt.Gross)
+	}
+}
+
+func TestReceiptUnknownTaxes(t *testing.T) {
+	basket := taxedBasket()
+	price := basket.Price(context.Background(), nil)
+
+	_, err := TaxPolicy{Mode: TaxInclusive, DefaultRegion: "es", Rates: testTaxes}.Receipt(price, "fr")
+	if _, ok := err.(*errors.ValidationError); !ok {
+		t.Errorf("Wanted a validation error for an unknown region, got %v", err)
+	}
+
+	_, err = TaxPolicy{Mode: TaxInclusive, DefaultRegion: "es",
+		Rates: map[string]TaxRates{"es": {StandardTax: 21}}}.Receipt(price, "")
+	if notFound, ok := err.(*errors.TaxRateNotFound); !ok || notFound.Region != "es" {
+		t.Errorf("Wanted a tax rate not found error for a category without rate, got %v", err)
+	}
+}
+
+func TestCheckCatalogueTaxes(t *testing.T) {
+	products := []Product{
+		{Code: "BOOK", Price: 1500, TaxCategory: "Reduced"},
+		{Code: "TSHIRT", Price: 2000},
+		{Code: "VOUCHER", Price: 500, TaxCategory: "exempt"},
+	}
+
+	if err := (TaxPolicy{Rates: testTaxes}).CheckCatalogue(products); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	err := TaxPolicy{Rates: map[string]TaxRates{
+		"es": {StandardTax: 21, "reduced": 10},
+		"pt": {StandardTax: 23, "exempt": 0},
+	}}.CheckCatalogue(products)
+	validationError, ok := err.(*errors.ValidationError)
+	if !ok || len(validationError.Errors) != 2 {
+		t.Fatalf("Wanted a rate missing in every region, got %v", err)
+	}
+	if validationError.Errors[0].Field != "tax.rates.es" || validationError.Errors[1].Field != "tax.rates.pt" {
+		t.Errorf("Unexpected errors %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// Outcome is the answer of the fake gateway to a call
+type Outcome string
+
+const (
+	Approve Outcome = "approve"
+	Decline Outcome = "decline"
+	// Timeout does not answer until the context is done, or the timeout of the gateway is over
+	Timeout Outcome = "timeout"
+)
+
+const defaultFakeTimeout = 10 * time.Second
+
+// FakeOption configures the fake gateway
+type FakeOption func(*FakeGateway)
+
+// WithOutcome sets the outcome of the calls not scripted, approve by default
+func WithOutcome(outcome Outcome) FakeOption {
+	return func(g *FakeGateway) {
+		g.outcome = outcome
+	}
+}
+
+// WithTimeoutAfter sets the time the timeout outcome waits before failing when the context has
+// no deadline
+func WithTimeoutAfter(timeout time.Duration) FakeOption {
+	return func(g *FakeGateway) {
+		g.timeout = timeout
+	}
+}
+
+// FakeGateway is an in-process gateway for tests and demos. It keeps the authorizations in memory
+// and answers every call with the next scripted outcome, or the configured one when none is left.
+// Calls approved are still refused when the authorization does not allow them, like capturing a
+// voided authorization.
+type FakeGateway struct {
+	outcome Outcome
+	timeout time.Duration
+
+	mux            sync.Mutex
+	script         []Outcome
+	authorizations map[string]*fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	orderId  string
+	amount   int64
+	currency string
+	captured int64
+	refunded int64
+	voided   bool
+}
+
+func NewFakeGateway(options ...FakeOption) *FakeGateway {
+	g := &FakeGateway{
+		outcome:        Approve,
+		timeout:        defaultFakeTimeout,
+		authorizations: make(map[string]*fakeAuthorization),
+	}
+	for _, option := range options {
+		option(g)
+	}
+	return g
+}
+
+// Script sets the outcomes of the next calls, in order
+func (g *FakeGateway) Script(outcomes ...Outcome) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	g.script = append([]Outcome{}, outcomes...)
+}
+
+func (g *FakeGateway) Authorize(ctx context.Context, orderId string, amount int64, currency string) (string, error) {
+	if err := g.answer(ctx); err != nil {
+		return "", err
+	}
+	if amount <= 0 {
+		return "", &DeclinedError{Reason: fmt.Sprintf("invalid amount %d", amount)}
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	id := "auth_" + uuid.New().String()
+	g.authorizations[id] = &fakeAuthorization{orderId: orderId, amount: amount, currency: currency}
+	return id, nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, authorizationId string, amount int64, currency string) error {
+	if err := g.answer(ctx); err != nil {
+		return err
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	a, err := g.authorization(authorizationId)
+	if err != nil {
+		return err
+	}
+	if currency != a.currency {
+		return &DeclinedError{Reason: fmt.Sprintf("authorization %s is in %s, not in %s", authorizationId, a.currency, currency)}
+	}
+	if a.voided || a.captured > 0 || amount <= 0 || amount > a.amount {
+		return &DeclinedError{Reason: fmt.Sprintf("authorization %s can't capture %d", authorizationId, amount)}
+	}
+
+	a.captured = amount
+	return nil
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, authorizationId string, amount int64, currency string) error {
+	if err := g.answer(ctx); err != nil {
+		return err
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	a, err := g.authorization(authorizationId)
+	if err != nil {
+		return err
+	}
+	if currency != a.currency {
+		return &DeclinedError{Reason: fmt.Sprintf("authorization %s is in %s, not in %s", authorizationId, a.currency, currency)}
+	}
+	if amount <= 0 || a.refunded+amount > a.captured {
+		return &DeclinedError{Reason: fmt.Sprintf("authorization %s can't refund %d", authorizationId, amount)}
+	}
+
+	a.refunded += amount
+	return nil
+}
+
+func (g *FakeGateway) Void(ctx context.Context, authorizationId string) error {
+	if err := g.answer(ctx); err != nil {
+		return err
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	a, err := g.authorization(authorizationId)
+	if err != nil {
+		return err
+	}
+	if a.captured > 0 {
+		return &DeclinedError{Reason: fmt.Sprintf("authorization %s already captured", authorizationId)}
+	}
+
+	a.voided = true
+	return nil
+}
+
+// answer takes the outcome of the call, it returns the error of the outcome
+func (g *FakeGateway) answer(ctx context.Context) error {
+	g.mux.Lock()
+	outcome := g.outcome
+	if len(g.script) > 0 {
+		outcome = g.script[0]
+		g.script = g.script[1:]
+	}
+	g.mux.Unlock()
+
+	switch outcome {
+	case Decline:
+		return &DeclinedError{Reason: "declined by the fake gateway"}
+	case Timeout:
+		timer := time.NewTimer(g.timeout)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		return ErrTimeout
+	}
+
+	return ctx.Err()
+}
+
+// authorization returns the authorization, the caller holds the lock
+func (g *FakeGateway) authorization(id string) (*fakeAuthorization, error) {
+	a, ok := g.authorizations[id]
+	if !ok {
+		return nil, &DeclinedError{Reason: fmt.Sprintf("unknown authorization %s", id)}
+	}
+	return a, nil
+}
@@ -0,0 +1,97 @@
+package payments
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFakeGatewayPaymentLifecycle(t *testing.T) {
+	g := NewFakeGateway()
+	ctx := context.Background()
+
+	id, err := g.Authorize(ctx, "order-1", 2000, "EUR")
+	if err != nil || id == "" {
+		t.Fatalf("Unexpected authorization %q: %v", id, err)
+	}
+	if err := g.Capture(ctx, id, 2500, "EUR"); err == nil {
+		t.Errorf("Capturing more than authorized should be declined")
+	}
+	if err := g.Capture(ctx, id, 2000, "EUR"); err != nil {
+		t.Errorf("Unexpected error capturing: %v", err)
+	}
+	if err := g.Void(ctx, id); err == nil {
+		t.Errorf("Voiding a captured authorization should be declined")
+	}
+	if err := g.Refund(ctx, id, 1500, "EUR"); err != nil {
+		t.Errorf("Unexpected error refunding: %v", err)
+	}
+	if err := g.Refund(ctx, id, 1000, "EUR"); err == nil {
+		t.Errorf("Refunding more than captured should be declined")
+	}
+}
+
+func TestFakeGatewayCurrency(t *testing.T) {
+	g := NewFakeGateway()
+	ctx := context.Background()
+
+	id, _ := g.Authorize(ctx, "order-1", 2000, "GBP")
+	if _, ok := g.Capture(ctx, id, 2000, "EUR").(*DeclinedError); !ok {
+		t.Errorf("Capturing in another currency than authorized should be declined")
+	}
+	if err := g.Capture(ctx, id, 2000, "GBP"); err != nil {
+		t.Errorf("Unexpected error capturing: %v", err)
+	}
+	if _, ok := g.Refund(ctx, id, 2000, "EUR").(*DeclinedError); !ok {
+		t.Errorf("Refunding in another currency than captured should be declined")
+	}
+	if err := g.Refund(ctx, id, 2000, "GBP"); err != nil {
+		t.Errorf("Unexpected error refunding: %v", err)
+	}
+}
+
+func TestFakeGatewayVoid(t *testing.T) {
+	g := NewFakeGateway()
+	ctx := context.Background()
+
+	id, _ := g.Authorize(ctx, "order-1", 2000, "EUR")
+	if err := g.Void(ctx, id); err != nil {
+		t.Errorf("Unexpected error voiding: %v", err)
+	}
+	if _, ok := g.Capture(ctx, id, 2000, "EUR").(*DeclinedError); !ok {
+		t.Errorf("Capturing a voided authorization should be declined")
+	}
+}
+
+func TestFakeGatewayScriptedOutcomes(t *testing.T) {
+	g := NewFakeGateway(WithTimeoutAfter(10 * time.Millisecond))
+	g.Script(Decline, Timeout)
+	ctx := context.Background()
+
+	if _, err := g.Authorize(ctx, "order-1", 2000, "EUR"); err == nil {
+		t.Errorf("First call should be declined")
+	} else if _, ok := err.(*DeclinedError); !ok {
+		t.Errorf("Expected a declined error, got %v", err)
+	}
+	if _, err := g.Authorize(ctx, "order-1", 2000, "EUR"); err != ErrTimeout {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if _, err := g.Authorize(ctx, "order-1", 2000, "EUR"); err != nil {
+		t.Errorf("Calls after the script should be approved, got %v", err)
+	}
+}
+
+func TestFakeGatewayTimeoutHonoursContext(t *testing.T) {
+	g := NewFakeGateway(WithOutcome(Timeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := g.Authorize(ctx, "order-1", 2000, "EUR"); err != ErrTimeout {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("The timeout should end with the context, took %v", elapsed)
+	}
+}
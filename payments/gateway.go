@@ -0,0 +1,33 @@
+// Package payments takes the payment of the orders through a payment provider. The amounts are
+// in cents, as the product prices, of the currency given with them.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// PaymentGateway is a payment provider. An authorization holds the amount, it is charged when
+// captured or released when voided, and a captured amount can be refunded. The currency is the
+// ISO 4217 code of the amount, the one of the authorization when capturing or refunding.
+type PaymentGateway interface {
+	// Authorize holds the amount of the order and returns the id of the authorization
+	Authorize(ctx context.Context, orderId string, amount int64, currency string) (string, error)
+	Capture(ctx context.Context, authorizationId string, amount int64, currency string) error
+	Refund(ctx context.Context, authorizationId string, amount int64, currency string) error
+	Void(ctx context.Context, authorizationId string) error
+}
+
+// ErrTimeout is returned when the provider does not answer in time, the operation may or may
+// not have been done
+var ErrTimeout = errors.New("payment gateway timed out")
+
+// DeclinedError is returned when the provider refuses the operation
+type DeclinedError struct {
+	Reason string
+}
+
+func (d *DeclinedError) Error() string {
+	return fmt.Sprintf("payment declined: %s", d.Reason)
+}
@@ -0,0 +1,57 @@
+package payments
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/pkg/tracing"
+)
+
+// tracedGateway creates a span for every call to the wrapped gateway
+type tracedGateway struct {
+	gateway PaymentGateway
+}
+
+func WithTracing(gateway PaymentGateway) PaymentGateway {
+	return &tracedGateway{gateway: gateway}
+}
+
+func (t *tracedGateway) Authorize(ctx context.Context, orderId string, amount int64, currency string) (string, error) {
+	ctx, span := tracing.Start(ctx, "PaymentGateway.Authorize", tracing.OrderIdKey.String(orderId),
+		tracing.PaymentAmountKey.Int64(amount), tracing.PaymentCurrencyKey.String(currency))
+
+	authorizationId, err := t.gateway.Authorize(ctx, orderId, amount, currency)
+	if err == nil {
+		span.SetAttributes(tracing.PaymentAuthorizationKey.String(authorizationId))
+	}
+	tracing.End(span, err)
+
+	return authorizationId, err
+}
+
+func (t *tracedGateway) Capture(ctx context.Context, authorizationId string, amount int64, currency string) error {
+	ctx, span := tracing.Start(ctx, "PaymentGateway.Capture", tracing.PaymentAuthorizationKey.String(authorizationId),
+		tracing.PaymentAmountKey.Int64(amount), tracing.PaymentCurrencyKey.String(currency))
+
+	err := t.gateway.Capture(ctx, authorizationId, amount, currency)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (t *tracedGateway) Refund(ctx context.Context, authorizationId string, amount int64, currency string) error {
+	ctx, span := tracing.Start(ctx, "PaymentGateway.Refund", tracing.PaymentAuthorizationKey.String(authorizationId),
+		tracing.PaymentAmountKey.Int64(amount), tracing.PaymentCurrencyKey.String(currency))
+
+	err := t.gateway.Refund(ctx, authorizationId, amount, currency)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (t *tracedGateway) Void(ctx context.Context, authorizationId string) error {
+	ctx, span := tracing.Start(ctx, "PaymentGateway.Void", tracing.PaymentAuthorizationKey.String(authorizationId))
+
+	err := t.gateway.Void(ctx, authorizationId)
+	tracing.End(span, err)
+
+	return err
+}
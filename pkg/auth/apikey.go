@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/alfcope/checkouttest/config"
+	"net/http"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator accepts the static keys of the configuration sent in the X-API-Key header
+type APIKeyAuthenticator struct {
+	// Keys are indexed by their digest so the lookup time does not depend on the key sent
+	keys map[[sha256.Size]byte]Principal
+}
+
+func NewAPIKeyAuthenticator(keys []config.APIKeyConfig) (*APIKeyAuthenticator, error) {
+	authenticator := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]Principal, len(keys))}
+
+	for i, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("api key %d: empty key", i)
+		}
+		if key.Subject == "" {
+			return nil, fmt.Errorf("api key %d: empty subject", i)
+		}
+
+		digest := sha256.Sum256([]byte(key.Key))
+		if _, ok := authenticator.keys[digest]; ok {
+			return nil, fmt.Errorf("api key %d: duplicated key", i)
+		}
+
+		authenticator.keys[digest] = Principal{
+			Subject: key.Subject,
+			Store:   key.Store,
+			Scopes:  key.Scopes,
+			Method:  MethodAPIKey,
+		}
+	}
+
+	return authenticator, nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	principal, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &principal, nil
+}
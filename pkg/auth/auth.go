@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/alfcope/checkouttest/config"
+	"net/http"
+)
+
+// Scope required by the admin routes
+const AdminScope = "admin"
+
+// Authentication methods recorded in the principal
+const (
+	MethodAPIKey = "apikey"
+	MethodJWT    = "jwt"
+)
+
+var (
+	// ErrNoCredentials is returned when the request carries no credentials for the authenticator
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned when the credentials are not accepted
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string
+	// Store the caller acts for, empty when it is not bound to a store
+	Store  string
+	Scopes []string
+	Method string
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Owner identifies the owner of the baskets created by the principal: its store, or the
+// subject itself when it is not bound to a store
+func (p *Principal) Owner() string {
+	if p.Store != "" {
+		return "store:" + p.Store
+	}
+	return "subject:" + p.Subject
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the principal of the request, nil when authentication is disabled
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey).(*Principal)
+	return principal
+}
+
+// Authenticator identifies the caller of a request. It returns ErrNoCredentials when the request
+// does not carry the kind of credentials it handles.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries the authenticators in order until one finds credentials in the request
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// New creates the authenticators described by the configuration. It returns nil when no api
+// key nor jwt key is configured, meaning authentication is disabled.
+func New(configuration config.AuthConfig) (Authenticator, error) {
+	var chain Chain
+
+	if len(configuration.APIKeys) > 0 {
+		authenticator, err := NewAPIKeyAuthenticator(configuration.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, authenticator)
+	}
+
+	if configuration.JWT.HS256Secret != "" || configuration.JWT.RS256PublicKeyFile != "" {
+		authenticator, err := NewJWTAuthenticator(configuration.JWT)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, authenticator)
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
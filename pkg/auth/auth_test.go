@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/golang-jwt/jwt/v4"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	authenticator, err := NewAPIKeyAuthenticator([]config.APIKeyConfig{
+		{Key: "key-1", Subject: "till-1", Store: "store-1", Scopes: []string{"baskets"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	principal, err := authenticator.Authenticate(requestWithHeader(APIKeyHeader, "key-1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if principal.Subject != "till-1" || principal.Store != "store-1" || principal.Method != MethodAPIKey {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+	if !principal.HasScope("baskets") || principal.HasScope(AdminScope) {
+		t.Errorf("Unexpected scopes %v", principal.Scopes)
+	}
+	if principal.Owner() != "store:store-1" {
+		t.Errorf("Unexpected owner %s", principal.Owner())
+	}
+
+	if _, err := authenticator.Authenticate(requestWithHeader(APIKeyHeader, "key-2")); err != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials, got %v", err)
+	}
+	if _, err := authenticator.Authenticate(httptest.NewRequest("GET", "/", nil)); err != ErrNoCredentials {
+		t.Errorf("Expected no credentials, got %v", err)
+	}
+}
+
+func TestAPIKeyAuthenticatorInvalidConfig(t *testing.T) {
+	configs := map[string][]config.APIKeyConfig{
+		"empty key":     {{Subject: "till-1"}},
+		"empty subject": {{Key: "key-1"}},
+		"duplicated":    {{Key: "key-1", Subject: "till-1"}, {Key: "key-1", Subject: "till-2"}},
+	}
+
+	for name, keys := range configs {
+		if _, err := NewAPIKeyAuthenticator(keys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestJWTAuthenticatorHS256(t *testing.T) {
+	authenticator, err := NewJWTAuthenticator(config.JWTConfig{
+		HS256Secret: testSecret,
+		Issuer:      "checkout-tests",
+		Audience:    "checkout",
+		StoreClaim:  "store",
+		ScopeClaim:  "scope",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	valid := jwt.MapClaims{
+		"sub":   "till-1",
+		"store": "store-1",
+		"scope": "baskets admin",
+		"iss":   "checkout-tests",
+		"aud":   []string{"other", "checkout"},
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+
+	principal, err := authenticator.Authenticate(bearer(signHS256(t, valid, testSecret)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if principal.Subject != "till-1" || principal.Store != "store-1" || principal.Method != MethodJWT {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+	if !principal.HasScope("baskets") || !principal.HasScope(AdminScope) {
+		t.Errorf("Unexpected scopes %v", principal.Scopes)
+	}
+
+	invalid := map[string]string{
+		"wrong secret":    signHS256(t, valid, "other-secret"),
+		"expired":         signHS256(t, with(valid, "exp", time.Now().Add(-time.Minute).Unix()), testSecret),
+		"wrong issuer":    signHS256(t, with(valid, "iss", "other"), testSecret),
+		"wrong audience":  signHS256(t, with(valid, "aud", "other"), testSecret),
+		"wrong audiences": signHS256(t, with(valid, "aud", []string{"other", "another"}), testSecret),
+		"no audience":     signHS256(t, with(valid, "aud", nil), testSecret),
+		"no subject":      signHS256(t, with(valid, "sub", ""), testSecret),
+		"unsigned":        signNone(t, valid),
+		"malformed":       "not-a-token",
+	}
+
+	for name, token := range invalid {
+		if _, err := authenticator.Authenticate(bearer(token)); err != ErrInvalidCredentials {
+			t.Errorf("%s: expected invalid credentials, got %v", name, err)
+		}
+	}
+
+	if _, err := authenticator.Authenticate(requestWithHeader("Authorization", "Basic dXNlcjpwYXNz")); err != ErrNoCredentials {
+		t.Errorf("Expected no credentials, got %v", err)
+	}
+}
+
+func TestJWTAuthenticatorRS256(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyFile := filepath.Join(dir, "public.pem")
+	if err := ioutil.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := NewJWTAuthenticator(config.JWTConfig{
+		RS256PublicKeyFile: publicKeyFile,
+		StoreClaim:         "store",
+		ScopeClaim:         "scope",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	claims := jwt.MapClaims{"sub": "till-1", "scope": []string{"baskets"}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principal, err := authenticator.Authenticate(bearer(token))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if principal.Owner() != "subject:till-1" || !principal.HasScope("baskets") {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	// Without a configured secret, HS256 tokens are refused
+	if _, err := authenticator.Authenticate(bearer(signHS256(t, claims, testSecret))); err != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	authenticator, err := New(config.AuthConfig{})
+	if err != nil || authenticator != nil {
+		t.Errorf("Expected authentication to be disabled, got %v, %v", authenticator, err)
+	}
+
+	authenticator, err = New(config.AuthConfig{
+		APIKeys: []config.APIKeyConfig{{Key: "key-1", Subject: "till-1"}},
+		JWT:     config.JWTConfig{HS256Secret: testSecret, StoreClaim: "store", ScopeClaim: "scope"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if principal, err := authenticator.Authenticate(requestWithHeader(APIKeyHeader, "key-1")); err != nil || principal.Method != MethodAPIKey {
+		t.Errorf("Expected the api key to be accepted, got %v, %v", principal, err)
+	}
+
+	token := signHS256(t, jwt.MapClaims{"sub": "till-2"}, testSecret)
+	if principal, err := authenticator.Authenticate(bearer(token)); err != nil || principal.Method != MethodJWT {
+		t.Errorf("Expected the token to be accepted, got %v, %v", principal, err)
+	}
+
+	if _, err := authenticator.Authenticate(httptest.NewRequest("GET", "/", nil)); err != ErrNoCredentials {
+		t.Errorf("Expected no credentials, got %v", err)
+	}
+}
+
+func requestWithHeader(header, value string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(header, value)
+	return r
+}
+
+func bearer(token string) *http.Request {
+	return requestWithHeader("Authorization", "Bearer "+token)
+}
+
+func with(claims jwt.MapClaims, claim string, value interface{}) jwt.MapClaims {
+	copied := jwt.MapClaims{}
+	for k, v := range claims {
+		copied[k] = v
+	}
+	copied[claim] = value
+	return copied
+}
+
+func signHS256(t *testing.T, claims jwt.MapClaims, secret string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func signNone(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
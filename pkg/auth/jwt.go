@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/golang-jwt/jwt/v4"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+// JWTAuthenticator accepts HS256 and RS256 bearer tokens. The subject comes from the sub claim,
+// the store and the scopes from the configured claims.
+type JWTAuthenticator struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+	parser    *jwt.Parser
+
+	issuer     string
+	audience   string
+	storeClaim string
+	scopeClaim string
+}
+
+func NewJWTAuthenticator(configuration config.JWTConfig) (*JWTAuthenticator, error) {
+	authenticator := &JWTAuthenticator{
+		issuer:     configuration.Issuer,
+		audience:   configuration.Audience,
+		storeClaim: configuration.StoreClaim,
+		scopeClaim: configuration.ScopeClaim,
+	}
+
+	// Only the algorithms with a configured key are accepted, so a token can't choose how it is verified
+	var methods []string
+
+	if configuration.HS256Secret != "" {
+		authenticator.secret = []byte(configuration.HS256Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if configuration.RS256PublicKeyFile != "" {
+		pem, err := ioutil.ReadFile(configuration.RS256PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if authenticator.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+			return nil, fmt.Errorf("rs256 public key %s: %v", configuration.RS256PublicKeyFile, err)
+		}
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no jwt key configured")
+	}
+	authenticator.parser = jwt.NewParser(jwt.WithValidMethods(methods))
+
+	return authenticator, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(strings.TrimPrefix(header, bearerPrefix), claims, a.key)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, ErrInvalidCredentials
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, ErrInvalidCredentials
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	store, _ := claims[a.storeClaim].(string)
+
+	return &Principal{
+		Subject: subject,
+		Store:   store,
+		Scopes:  scopes(claims[a.scopeClaim]),
+		Method:  MethodJWT,
+	}, nil
+}
+
+func (a *JWTAuthenticator) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method {
+	case jwt.SigningMethodHS256:
+		return a.secret, nil
+	case jwt.SigningMethodRS256:
+		return a.publicKey, nil
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+// scopes reads a space separated string or an array of strings
+func scopes(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, scope := range value {
+			if s, ok := scope.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
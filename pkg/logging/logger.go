@@ -29,14 +29,28 @@ func newLogger() *StandardLogger {
 	return standardLogger
 }
 
+// SetLevel changes the level of the standard logger, e.g. debug, info or warn
+func SetLevel(level string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	Logger.SetLevel(parsed)
+	return nil
+}
+
+// GetLevel returns the name of the current level of the standard logger
+func GetLevel() string {
+	return Logger.GetLevel().String()
+}
+
 // Create a logger entry and add the fields method, traceId and requestId from the http request object
 func GetLoggerWithFields(r *http.Request) *logrus.Entry {
 	logger := Logger.WithFields(logrus.Fields{
 		"method": r.Method,
-		//"traceId":   r.Header.Get("x-trace-id"),
-		//"requestId": r.Header.Get("x-request-id"),
 	})
-	return logger
+	return withContextFields(logger, r.Context())
 }
 
 // accessWriter is a simple wrapper that helps us capture the http response status and content-length
@@ -46,6 +60,11 @@ type accessWriter struct {
 	contentLength  int
 }
 
+// Unwrap gives http.ResponseController the writer to flush the event streams
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // Write status header and capture value
 func (w *accessWriter) WriteHeader(status int) {
 	w.responseStatus = status
@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+const (
+	RequestIdHeader   = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+
+	// Longest request id accepted from the callers, longer ones are replaced
+	maxRequestIdLength = 128
+)
+
+type contextKey int
+
+const (
+	requestIdKey contextKey = iota
+	traceContextKey
+)
+
+// TraceContext holds the W3C trace context of a request, https://www.w3.org/TR/trace-context/
+type TraceContext struct {
+	TraceId string
+	SpanId  string
+	// Span of the caller, empty when the trace started here
+	ParentId string
+	Flags    string
+}
+
+// ParseTraceparent reads a version 00 traceparent header value
+func ParseTraceparent(value string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return TraceContext{}, false
+	}
+
+	if !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return TraceContext{}, false
+	}
+
+	// All zeros ids are invalid
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return TraceContext{}, false
+	}
+
+	return TraceContext{TraceId: parts[1], SpanId: parts[2], Flags: parts[3]}, true
+}
+
+// NewTraceContext starts a new sampled trace
+func NewTraceContext() TraceContext {
+	return TraceContext{TraceId: randomHex(16), SpanId: randomHex(8), Flags: "01"}
+}
+
+// ChildOf returns the trace context of a new span within the same trace
+func (t TraceContext) ChildOf() TraceContext {
+	return TraceContext{TraceId: t.TraceId, SpanId: randomHex(8), ParentId: t.SpanId, Flags: t.Flags}
+}
+
+// Traceparent formats the trace context as a traceparent header value
+func (t TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%s", t.TraceId, t.SpanId, t.Flags)
+}
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+// RequestIdFromContext returns the request id stored in the context, or an empty string
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
+
+func WithTraceContext(ctx context.Context, trace TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey, trace)
+}
+
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	trace, ok := ctx.Value(traceContextKey).(TraceContext)
+	return trace, ok
+}
+
+// GetLoggerWithContext creates a logger entry with the request and trace ids stored in the context
+func GetLoggerWithContext(ctx context.Context) *logrus.Entry {
+	return withContextFields(logrus.NewEntry(Logger.Logger), ctx)
+}
+
+func withContextFields(entry *logrus.Entry, ctx context.Context) *logrus.Entry {
+	fields := logrus.Fields{}
+
+	if requestId := RequestIdFromContext(ctx); requestId != "" {
+		fields["requestId"] = requestId
+	}
+	if trace, ok := TraceContextFromContext(ctx); ok {
+		fields["traceId"] = trace.TraceId
+		fields["spanId"] = trace.SpanId
+		if trace.ParentId != "" {
+			fields["parentId"] = trace.ParentId
+		}
+	}
+
+	if len(fields) == 0 {
+		return entry
+	}
+	return entry.WithFields(fields)
+}
+
+// RequestIdMiddleware accepts the X-Request-ID and traceparent headers sent by the caller, or
+// generates them, and puts them on the request context. The request id is echoed in the response.
+func RequestIdMiddleware(nextHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := RequestIdOrNew(r.Header.Get(RequestIdHeader))
+
+		trace, ok := ParseTraceparent(r.Header.Get(TraceparentHeader))
+		if ok {
+			trace = trace.ChildOf()
+		} else {
+			trace = NewTraceContext()
+		}
+
+		w.Header().Set(RequestIdHeader, requestId)
+
+		ctx := WithTraceContext(WithRequestId(r.Context(), requestId), trace)
+		nextHandler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIdOrNew returns the request id sent by a caller, or a new one when it is missing or invalid
+func RequestIdOrNew(requestId string) string {
+	if !validRequestId(requestId) {
+		return uuid.New().String()
+	}
+	return requestId
+}
+
+// validRequestId rejects ids that could forge log lines or headers
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+
+	for _, c := range requestId {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(value string, length int) bool {
+	if len(value) != length || strings.ToLower(value) != value {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+func randomHex(bytes int) string {
+	b := make([]byte, bytes)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms, fall back to a random uuid
+		id := uuid.New()
+		copy(b, id[:])
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		trace, ok := ParseTraceparent(c.value)
+		if ok != c.valid {
+			t.Errorf("Traceparent %q: expected valid %v but got %v", c.value, c.valid, ok)
+		}
+		if ok && trace.Traceparent() != c.value {
+			t.Errorf("Traceparent %q formatted as %q", c.value, trace.Traceparent())
+		}
+	}
+}
+
+func TestRequestIdMiddlewareAcceptsCallerIds(t *testing.T) {
+	var ctx context.Context
+	handler := RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+
+	req := httptest.NewRequest("GET", "/baskets/b1", nil)
+	req.Header.Set(RequestIdHeader, "req-1")
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get(RequestIdHeader) != "req-1" {
+		t.Errorf("Expected request id echoed but got %q", rr.Header().Get(RequestIdHeader))
+	}
+	if RequestIdFromContext(ctx) != "req-1" {
+		t.Errorf("Expected request id in the context but got %q", RequestIdFromContext(ctx))
+	}
+
+	trace, ok := TraceContextFromContext(ctx)
+	if !ok {
+		t.Fatal("Expected trace context in the context")
+	}
+	if trace.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" || trace.ParentId != "00f067aa0ba902b7" {
+		t.Errorf("Expected the caller trace to be continued but got %+v", trace)
+	}
+	if trace.SpanId == trace.ParentId {
+		t.Errorf("Expected a new span id")
+	}
+}
+
+func TestRequestIdMiddlewareGeneratesIds(t *testing.T) {
+	var ctx context.Context
+	handler := RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+
+	for _, requestId := range []string{"", "forged\nline", strings.Repeat("a", maxRequestIdLength+1)} {
+		req := httptest.NewRequest("GET", "/baskets/b1", nil)
+		req.Header.Set(RequestIdHeader, requestId)
+		req.Header.Set(TraceparentHeader, "invalid")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		generated := RequestIdFromContext(ctx)
+		if generated == "" || generated == requestId {
+			t.Errorf("Expected a new request id replacing %q but got %q", requestId, generated)
+		}
+		if rr.Header().Get(RequestIdHeader) != generated {
+			t.Errorf("Expected generated request id echoed but got %q", rr.Header().Get(RequestIdHeader))
+		}
+		if trace, ok := TraceContextFromContext(ctx); !ok || trace.ParentId != "" {
+			t.Errorf("Expected a new trace but got %+v", trace)
+		}
+	}
+}
+
+func TestLoggerWithContextFields(t *testing.T) {
+	var out bytes.Buffer
+	Logger.SetOutput(&out)
+	defer Logger.SetOutput(os.Stdout)
+
+	trace := NewTraceContext()
+	ctx := WithTraceContext(WithRequestId(context.Background(), "req-1"), trace)
+
+	GetLoggerWithContext(ctx).Info("message")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("Invalid log entry %q: %v", out.String(), err)
+	}
+	if entry["requestId"] != "req-1" || entry["traceId"] != trace.TraceId || entry["spanId"] != trace.SpanId {
+		t.Errorf("Missing context fields in log entry %v", entry)
+	}
+}
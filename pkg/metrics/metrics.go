@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Recorder receives the measures reported by the api, the service and the model.
+// Packages report through the functions below so they do not depend on a metrics backend.
+type Recorder interface {
+	ObserveRequest(route, method string, status int, duration time.Duration)
+	SetOpenBaskets(count int)
+	PromotionApplied(promotionType, currency string, discount int)
+}
+
+var (
+	recorder    Recorder = noopRecorder{}
+	recorderMux sync.RWMutex
+)
+
+// SetRecorder replaces the recorder, by default measures are discarded
+func SetRecorder(r Recorder) {
+	recorderMux.Lock()
+	defer recorderMux.Unlock()
+
+	if r == nil {
+		r = noopRecorder{}
+	}
+	recorder = r
+}
+
+func getRecorder() Recorder {
+	recorderMux.RLock()
+	defer recorderMux.RUnlock()
+
+	return recorder
+}
+
+// OpenBaskets reports the number of baskets currently stored
+func OpenBaskets(count int) {
+	getRecorder().SetOpenBaskets(count)
+}
+
+// PromotionApplied reports a promotion applied while pricing a basket and the discount
+// it gave, in cents of the currency the basket is priced in
+func PromotionApplied(promotionType, currency string, discount int) {
+	getRecorder().PromotionApplied(promotionType, currency, discount)
+}
+
+type noopRecorder struct{}
+
+func (noopRecorder) ObserveRequest(string, string, int, time.Duration) {}
+func (noopRecorder) SetOpenBaskets(int)                                {}
+func (noopRecorder) PromotionApplied(string, string, int)              {}
+
+// statusWriter captures the http response status
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// Unwrap gives http.ResponseController the writer to flush the event streams
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Middleware measures the requests handled by the matched mux route. The route template is used
+// as label so requests for different baskets are aggregated.
+func Middleware(nextHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		responseWriter := &statusWriter{ResponseWriter: w}
+
+		defer func() {
+			route := "unknown"
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			status := responseWriter.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			getRecorder().ObserveRequest(route, r.Method, status, time.Since(start))
+		}()
+
+		nextHandler.ServeHTTP(responseWriter, r)
+	})
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type request struct {
+	route  string
+	method string
+	status int
+}
+
+type fakeRecorder struct {
+	mux       sync.Mutex
+	requests  []request
+	baskets   int
+	discounts map[string]int
+}
+
+func (f *fakeRecorder) ObserveRequest(route, method string, status int, duration time.Duration) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.requests = append(f.requests, request{route, method, status})
+}
+
+func (f *fakeRecorder) SetOpenBaskets(count int) {
+	f.baskets = count
+}
+
+func (f *fakeRecorder) PromotionApplied(promotionType, currency string, discount int) {
+	if f.discounts == nil {
+		f.discounts = make(map[string]int)
+	}
+	f.discounts[promotionType+" "+currency] += discount
+}
+
+func TestMiddlewareUsesRouteTemplate(t *testing.T) {
+	recorder := &fakeRecorder{}
+	SetRecorder(recorder)
+	defer SetRecorder(nil)
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/baskets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	router.HandleFunc("/baskets/{id}/price", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}).Methods("GET")
+
+	for _, path := range []string{"/baskets/b1", "/baskets/b2", "/baskets/b1/price"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	expected := []request{
+		{"/baskets/{id}", "GET", http.StatusNotFound},
+		{"/baskets/{id}", "GET", http.StatusNotFound},
+		{"/baskets/{id}/price", "GET", http.StatusOK},
+	}
+	if len(recorder.requests) != len(expected) {
+		t.Fatalf("Expected %d requests but got %d", len(expected), len(recorder.requests))
+	}
+	for i, r := range expected {
+		if recorder.requests[i] != r {
+			t.Errorf("Expected %v but got %v", r, recorder.requests[i])
+		}
+	}
+}
+
+func TestPackageFunctionsReportToRecorder(t *testing.T) {
+	recorder := &fakeRecorder{}
+	SetRecorder(recorder)
+	defer SetRecorder(nil)
+
+	OpenBaskets(3)
+	PromotionApplied("BULK", "EUR", 300)
+	PromotionApplied("BULK", "EUR", 100)
+	PromotionApplied("BULK", "GBP", 50)
+
+	if recorder.baskets != 3 {
+		t.Errorf("Expected 3 open baskets but got %d", recorder.baskets)
+	}
+	if recorder.discounts["BULK EUR"] != 400 || recorder.discounts["BULK GBP"] != 50 {
+		t.Errorf("Expected 400 discount in euros and 50 in pounds but got %v", recorder.discounts)
+	}
+}
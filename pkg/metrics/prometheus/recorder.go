@@ -0,0 +1,80 @@
+package prometheus
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "checkout"
+
+// Recorder exposes the checkout measures as Prometheus metrics
+type Recorder struct {
+	registry *prom.Registry
+
+	requests        *prom.CounterVec
+	requestDuration *prom.HistogramVec
+	openBaskets     prom.Gauge
+	promotions      *prom.CounterVec
+	discount        *prom.CounterVec
+}
+
+func NewRecorder() *Recorder {
+	r := &Recorder{
+		registry: prom.NewRegistry(),
+		requests: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of http requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the http requests by route, method and status.",
+			Buckets:   prom.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		openBaskets: prom.NewGauge(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "open_baskets",
+			Help:      "Number of baskets currently stored.",
+		}),
+		promotions: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "promotions_applied_total",
+			Help:      "Number of times a promotion has been applied pricing a basket.",
+		}, []string{"promotion_type", "currency"}),
+		discount: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "promotion_discount_total",
+			Help:      "Discount given by the promotions, in units of the currency of the basket.",
+		}, []string{"promotion_type", "currency"}),
+	}
+
+	r.registry.MustRegister(r.requests, r.requestDuration, r.openBaskets, r.promotions, r.discount,
+		prom.NewGoCollector(), prom.NewProcessCollector(prom.ProcessCollectorOpts{}))
+
+	return r
+}
+
+func (r *Recorder) ObserveRequest(route, method string, status int, duration time.Duration) {
+	labels := prom.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+
+	r.requests.With(labels).Inc()
+	r.requestDuration.With(labels).Observe(duration.Seconds())
+}
+
+func (r *Recorder) SetOpenBaskets(count int) {
+	r.openBaskets.Set(float64(count))
+}
+
+func (r *Recorder) PromotionApplied(promotionType, currency string, discount int) {
+	r.promotions.WithLabelValues(promotionType, currency).Inc()
+	r.discount.WithLabelValues(promotionType, currency).Add(float64(discount) / 100)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (r *Recorder) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,43 @@
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorderExposition(t *testing.T) {
+	recorder := NewRecorder()
+
+	recorder.ObserveRequest("/api/v1/baskets/{id}", "GET", 200, 10*time.Millisecond)
+	recorder.SetOpenBaskets(2)
+	recorder.PromotionApplied("BULK", "EUR", 300)
+	recorder.PromotionApplied("BULK", "GBP", 250)
+
+	server := httptest.NewServer(recorder.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error scraping metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	for _, line := range []string{
+		`checkout_http_requests_total{method="GET",route="/api/v1/baskets/{id}",status="200"} 1`,
+		`checkout_http_request_duration_seconds_count{method="GET",route="/api/v1/baskets/{id}",status="200"} 1`,
+		`checkout_open_baskets 2`,
+		`checkout_promotions_applied_total{currency="EUR",promotion_type="BULK"} 1`,
+		`checkout_promotion_discount_total{currency="EUR",promotion_type="BULK"} 3`,
+		`checkout_promotion_discount_total{currency="GBP",promotion_type="BULK"} 2.5`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("Expected %q in the exposition", line)
+		}
+	}
+}
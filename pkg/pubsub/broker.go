@@ -0,0 +1,236 @@
+// Package pubsub fans out the events published on a topic to its subscribers. The last events of
+// a topic are kept so a subscriber coming back can get the ones it missed.
+package pubsub
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Events kept per topic, also the events a subscriber can fall behind before it is dropped
+	defaultHistorySize = 64
+	// Time the topics are kept after the last subscriber leaves
+	defaultRetention = time.Minute
+	// Time between sweeps of the retained topics
+	sweepInterval = time.Minute
+)
+
+// Event is published on a topic. The ids grow across every topic of the broker, they start from
+// the creation time so the ids given by a previous broker, before a restart, are never taken as
+// ids of the new one.
+type Event struct {
+	Id   uint64
+	Type string
+	Data interface{}
+}
+
+// Broker keeps the topics with subscribers, and the recently left ones, with their last events.
+// Nothing is kept for the topics nobody watches.
+type Broker struct {
+	historySize int
+	retention   time.Duration
+	now         func() time.Time
+
+	mux       sync.Mutex
+	lastId    uint64
+	topics    map[string]*topic
+	closed    bool
+	lastSweep time.Time
+}
+
+type topic struct {
+	// publishing holds the publication of the events in order, it is held while the data of an
+	// event is built so the events follow the order of the changes they describe
+	publishing sync.Mutex
+
+	// Fields below are guarded by the broker lock
+	history []Event
+	// from is the id of the last event published on the topic and not in history
+	from        uint64
+	subscribers map[*Subscription]struct{}
+	idleSince   time.Time
+}
+
+// Subscription receives the events of a topic published after it was created
+type Subscription struct {
+	broker *Broker
+	topic  string
+	since  uint64
+	events chan Event
+	// closed is guarded by the broker lock
+	closed bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		historySize: defaultHistorySize,
+		retention:   defaultRetention,
+		now:         time.Now,
+		lastId:      uint64(time.Now().UnixNano()),
+		topics:      make(map[string]*topic),
+	}
+}
+
+// Publish sends an event to the subscribers of the topic. The data of the event is only built
+// when the topic is watched, it returns false otherwise. Subscribers not keeping up with the
+// events are dropped, their channel is closed.
+func (b *Broker) Publish(topicName, eventType string, data func() interface{}) (Event, bool) {
+	b.mux.Lock()
+	t, ok := b.topics[topicName]
+	b.mux.Unlock()
+	if !ok {
+		return Event{}, false
+	}
+
+	t.publishing.Lock()
+	defer t.publishing.Unlock()
+	event := Event{Type: eventType, Data: data()}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	// The topic could have been closed while the data was built
+	if b.topics[topicName] != t {
+		return Event{}, false
+	}
+
+	b.lastId++
+	event.Id = b.lastId
+
+	t.history = append(t.history, event)
+	if len(t.history) > b.historySize {
+		t.from = t.history[0].Id
+		t.history = t.history[1:]
+	}
+
+	for s := range t.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			b.unsubscribe(t, s)
+		}
+	}
+
+	return event, true
+}
+
+// Subscribe creates a subscription to the topic. The events published after lastId that are still
+// kept are returned, complete is false when some of them are lost or lastId was not given by the
+// broker. A zero lastId is a new subscriber, it gets no events and complete is false.
+func (b *Broker) Subscribe(topicName string, lastId uint64) (_ *Subscription, missed []Event, complete bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+
+	s := &Subscription{
+		broker: b,
+		topic:  topicName,
+		since:  b.lastId,
+		events: make(chan Event, b.historySize),
+	}
+	if b.closed {
+		s.closed = true
+		close(s.events)
+		return s, nil, false
+	}
+
+	t, ok := b.topics[topicName]
+	if !ok {
+		t = &topic{
+			from:        b.lastId,
+			subscribers: make(map[*Subscription]struct{}),
+		}
+		b.topics[topicName] = t
+	}
+	t.subscribers[s] = struct{}{}
+
+	if lastId == 0 || lastId < t.from || lastId > b.lastId {
+		return s, nil, false
+	}
+
+	for _, event := range t.history {
+		if event.Id > lastId {
+			missed = append(missed, event)
+		}
+	}
+	return s, missed, true
+}
+
+// CloseTopic closes the subscriptions of the topic and forgets its events
+func (b *Broker) CloseTopic(topicName string) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if t, ok := b.topics[topicName]; ok {
+		for s := range t.subscribers {
+			b.unsubscribe(t, s)
+		}
+		delete(b.topics, topicName)
+	}
+}
+
+// Close closes every subscription, the later ones are created closed
+func (b *Broker) Close() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.closed = true
+	for name, t := range b.topics {
+		for s := range t.subscribers {
+			b.unsubscribe(t, s)
+		}
+		delete(b.topics, name)
+	}
+}
+
+func (b *Broker) unsubscribe(t *topic, s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.events)
+
+	delete(t.subscribers, s)
+	if len(t.subscribers) == 0 {
+		t.idleSince = b.now()
+	}
+}
+
+// sweep forgets the topics without subscribers for longer than the retention
+func (b *Broker) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < sweepInterval {
+		return
+	}
+	b.lastSweep = now
+
+	for name, t := range b.topics {
+		if len(t.subscribers) == 0 && now.Sub(t.idleSince) >= b.retention {
+			delete(b.topics, name)
+		}
+	}
+}
+
+// Events returns the channel of the events, it is closed when the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Since returns the id of the last event published, on any topic, before the subscription
+func (s *Subscription) Since() uint64 {
+	return s.since
+}
+
+// Close ends the subscription, the topic is kept for the retention time
+func (s *Subscription) Close() {
+	s.broker.mux.Lock()
+	defer s.broker.mux.Unlock()
+
+	if t, ok := s.broker.topics[s.topic]; ok {
+		if _, subscribed := t.subscribers[s]; subscribed {
+			s.broker.unsubscribe(t, s)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func data(value string) func() interface{} {
+	return func() interface{} { return value }
+}
+
+func receive(t *testing.T, s *Subscription) Event {
+	select {
+	case event, ok := <-s.Events():
+		if !ok {
+			t.Fatalf("Subscription closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("No event received")
+	}
+	return Event{}
+}
+
+func TestPublishWithoutSubscribers(t *testing.T) {
+	broker := NewBroker()
+
+	built := false
+	if _, ok := broker.Publish("basket-1", "lines", func() interface{} { built = true; return nil }); ok {
+		t.Errorf("Event should not be published without subscribers")
+	}
+	if built {
+		t.Errorf("Data should not be built without subscribers")
+	}
+}
+
+func TestPublishToSubscribers(t *testing.T) {
+	broker := NewBroker()
+
+	s1, _, _ := broker.Subscribe("basket-1", 0)
+	s2, _, _ := broker.Subscribe("basket-1", 0)
+	other, _, _ := broker.Subscribe("basket-2", 0)
+
+	published, ok := broker.Publish("basket-1", "lines", data("one"))
+	if !ok {
+		t.Fatalf("Event should be published")
+	}
+
+	for _, s := range []*Subscription{s1, s2} {
+		if event := receive(t, s); event != published {
+			t.Errorf("Expected %v, got %v", published, event)
+		}
+	}
+
+	select {
+	case event := <-other.Events():
+		t.Errorf("Unexpected event on another topic: %v", event)
+	default:
+	}
+}
+
+func TestSubscribeAfterLastId(t *testing.T) {
+	broker := NewBroker()
+
+	s, missed, complete := broker.Subscribe("basket-1", 0)
+	if complete || len(missed) != 0 {
+		t.Errorf("A new subscriber should get no events")
+	}
+
+	first, _ := broker.Publish("basket-1", "lines", data("one"))
+	second, _ := broker.Publish("basket-1", "lines", data("two"))
+	_, _ = broker.Publish("basket-2", "lines", data("other"))
+	s.Close()
+
+	// Coming back after the first event
+	_, missed, complete = broker.Subscribe("basket-1", first.Id)
+	if !complete {
+		t.Errorf("Missed events should be complete")
+	}
+	if len(missed) != 1 || missed[0] != second {
+		t.Errorf("Expected the second event, got %v", missed)
+	}
+
+	// An id not issued by the broker
+	if _, _, complete = broker.Subscribe("basket-1", 1000); complete {
+		t.Errorf("Unknown ids should not be complete")
+	}
+}
+
+func TestSubscribeAfterLostEvents(t *testing.T) {
+	broker := NewBroker()
+	broker.historySize = 2
+
+	_, _, _ = broker.Subscribe("basket-1", 0)
+	first, _ := broker.Publish("basket-1", "lines", data("one"))
+	for i := 0; i < 2; i++ {
+		_, _ = broker.Publish("basket-1", "lines", data("more"))
+	}
+
+	if _, missed, complete := broker.Subscribe("basket-1", first.Id); !complete || len(missed) != 2 {
+		t.Errorf("Events after the first should be kept, got %v", missed)
+	}
+	if _, _, complete := broker.Subscribe("basket-1", first.Id-1); complete {
+		t.Errorf("The first event is no longer kept")
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	broker := NewBroker()
+	broker.historySize = 2
+
+	s, _, _ := broker.Subscribe("basket-1", 0)
+	for i := 0; i < 3; i++ {
+		_, _ = broker.Publish("basket-1", "lines", data("event"))
+	}
+
+	received := 0
+	for range s.Events() {
+		received++
+	}
+	if received != 2 {
+		t.Errorf("Expected the 2 buffered events before the close, got %d", received)
+	}
+}
+
+func TestCloseTopic(t *testing.T) {
+	broker := NewBroker()
+
+	s, _, _ := broker.Subscribe("basket-1", 0)
+	event, _ := broker.Publish("basket-1", "deleted", data("gone"))
+	broker.CloseTopic("basket-1")
+
+	if received := receive(t, s); received != event {
+		t.Errorf("Expected %v, got %v", event, received)
+	}
+	if _, ok := <-s.Events(); ok {
+		t.Errorf("Subscription should be closed")
+	}
+	if _, _, complete := broker.Subscribe("basket-1", event.Id-1); complete {
+		t.Errorf("Events of a closed topic should be forgotten")
+	}
+}
+
+func TestClose(t *testing.T) {
+	broker := NewBroker()
+
+	s, _, _ := broker.Subscribe("basket-1", 0)
+	broker.Close()
+
+	if _, ok := <-s.Events(); ok {
+		t.Errorf("Subscription should be closed")
+	}
+
+	later, _, _ := broker.Subscribe("basket-1", 0)
+	if _, ok := <-later.Events(); ok {
+		t.Errorf("Subscriptions after the close should be closed")
+	}
+}
+
+func TestSweepRetainedTopics(t *testing.T) {
+	now := time.Now()
+	broker := NewBroker()
+	broker.now = func() time.Time { return now }
+
+	s, _, _ := broker.Subscribe("basket-1", 0)
+	s.Close()
+
+	// Kept for the retention time
+	if _, ok := broker.Publish("basket-1", "lines", data("one")); !ok {
+		t.Errorf("Topic should be kept after the last subscriber leaves")
+	}
+
+	now = now.Add(defaultRetention)
+	_, _, _ = broker.Subscribe("basket-2", 0)
+
+	if _, ok := broker.Publish("basket-1", "lines", data("two")); ok {
+		t.Errorf("Topic should be forgotten after the retention time")
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	// The burst is served at once
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.Allow("client-1"); !allowed {
+			t.Fatalf("Request %d should be allowed", i)
+		}
+	}
+
+	allowed, retryAfter := limiter.Allow("client-1")
+	if allowed {
+		t.Fatalf("Request over the burst should be refused")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Errorf("Expected to retry after 500ms, got %v", retryAfter)
+	}
+
+	// Other clients have their own bucket
+	if allowed, _ := limiter.Allow("client-2"); !allowed {
+		t.Errorf("Another client should be allowed")
+	}
+
+	// Tokens come back at the rate
+	now = now.Add(500 * time.Millisecond)
+	if allowed, _ := limiter.Allow("client-1"); !allowed {
+		t.Errorf("Request should be allowed after the refill")
+	}
+	if allowed, _ := limiter.Allow("client-1"); allowed {
+		t.Errorf("Only one token should have been refilled")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("client-1")
+	now = now.Add(sweepInterval / 2)
+	limiter.Allow("client-2")
+
+	now = now.Add(sweepInterval / 2)
+	limiter.Allow("client-3")
+
+	// Every bucket is full again, only the one just used is kept
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected 1 bucket, got %d", len(limiter.buckets))
+	}
+	if _, ok := limiter.buckets["client-3"]; !ok {
+		t.Errorf("Expected the bucket of client-3 to be kept")
+	}
+}
@@ -0,0 +1,96 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/alfcope/checkouttest/config"
+)
+
+// Client certificate verification modes
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Enabled reports whether the configuration asks for https
+func Enabled(configuration config.TLSConfig) bool {
+	return configuration.CertFile != "" || configuration.KeyFile != ""
+}
+
+// NewServerConfig builds the server tls configuration. The certificate and the client CAs are
+// reloaded when their files change.
+func NewServerConfig(configuration config.TLSConfig) (*tls.Config, error) {
+	if configuration.CertFile == "" || configuration.KeyFile == "" {
+		return nil, fmt.Errorf("tls needs both the certificate and the key files")
+	}
+
+	interval := configuration.ReloadInterval
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	certificate, err := NewCertificateReloader(configuration.CertFile, configuration.KeyFile, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certificate.GetCertificate,
+	}
+
+	switch configuration.ClientAuth {
+	case "", ClientAuthNone:
+		return tlsConfig, nil
+	case ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth %q", configuration.ClientAuth)
+	}
+
+	if configuration.ClientCAFile == "" {
+		return nil, fmt.Errorf("client auth %q needs the client CA file", configuration.ClientAuth)
+	}
+
+	clientCAs, err := NewCertPoolReloader(configuration.ClientCAFile, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig.ClientCAs = clientCAs.CertPool()
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		handshakeConfig := tlsConfig.Clone()
+		handshakeConfig.ClientCAs = clientCAs.CertPool()
+		handshakeConfig.GetConfigForClient = nil
+		return handshakeConfig, nil
+	}
+
+	return tlsConfig, nil
+}
+
+// NewClientConfig builds a client tls configuration trusting the CAs of caFile and presenting the
+// certificate of certFile and keyFile, reloaded when they change. Empty files are skipped.
+func NewClientConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		certificate, err := NewCertificateReloader(certFile, keyFile, DefaultReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = certificate.GetClientCertificate
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,163 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Default time between checks of the certificate files
+const DefaultReloadInterval = 30 * time.Second
+
+// reloader keeps a value built from a set of files and builds it again when any of the files
+// changes. Files are checked on use, at most once per interval, so no goroutine is needed.
+type reloader struct {
+	files    []string
+	interval time.Duration
+	load     func() (interface{}, error)
+
+	mux      sync.Mutex
+	value    interface{}
+	modTimes []time.Time
+	checked  time.Time
+}
+
+func newReloader(interval time.Duration, load func() (interface{}, error), files ...string) (*reloader, error) {
+	r := &reloader{files: files, interval: interval, load: load}
+
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.value, err = load(); err != nil {
+		return nil, err
+	}
+	r.modTimes = modTimes
+	r.checked = time.Now()
+
+	return r, nil
+}
+
+// get returns the current value. A failing reload keeps the previous value.
+func (r *reloader) get() interface{} {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if time.Since(r.checked) < r.interval {
+		return r.value
+	}
+	r.checked = time.Now()
+
+	modTimes, err := r.stat()
+	if err != nil || !r.changed(modTimes) {
+		return r.value
+	}
+
+	value, err := r.load()
+	if err != nil {
+		logging.Logger.WithField("files", r.files).Errorf("Error reloading tls files: %v", err)
+		return r.value
+	}
+
+	logging.Logger.WithField("files", r.files).Info("Tls files reloaded")
+	r.value = value
+	r.modTimes = modTimes
+
+	return r.value
+}
+
+func (r *reloader) stat() ([]time.Time, error) {
+	modTimes := make([]time.Time, len(r.files))
+	for i, file := range r.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *reloader) changed(modTimes []time.Time) bool {
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// CertificateReloader serves a certificate and key pair, reloaded when the files change
+type CertificateReloader struct {
+	reloader *reloader
+}
+
+func NewCertificateReloader(certFile, keyFile string, interval time.Duration) (*CertificateReloader, error) {
+	r, err := newReloader(interval, func() (interface{}, error) {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &certificate, nil
+	}, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertificateReloader{reloader: r}, nil
+}
+
+func (c *CertificateReloader) Certificate() *tls.Certificate {
+	return c.reloader.get().(*tls.Certificate)
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate
+func (c *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.Certificate(), nil
+}
+
+// GetClientCertificate can be used as tls.Config.GetClientCertificate
+func (c *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.Certificate(), nil
+}
+
+// CertPoolReloader serves the pool of the CA certificates in a PEM file, reloaded when it changes
+type CertPoolReloader struct {
+	reloader *reloader
+}
+
+func NewCertPoolReloader(caFile string, interval time.Duration) (*CertPoolReloader, error) {
+	r, err := newReloader(interval, func() (interface{}, error) {
+		return LoadCertPool(caFile)
+	}, caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertPoolReloader{reloader: r}, nil
+}
+
+func (c *CertPoolReloader) CertPool() *x509.CertPool {
+	return c.reloader.get().(*x509.CertPool)
+}
+
+// LoadCertPool reads the CA certificates of a PEM file
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,103 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/internal/tests/certs"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCertificateReload(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	files := certs.Generate(t, dir)
+
+	reloader, err := NewCertificateReloader(files.ServerCert, files.ServerKey, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first := reloader.Certificate()
+
+	// Unchanged files are not reloaded
+	if reloader.Certificate() != first {
+		t.Errorf("Expected the same certificate")
+	}
+
+	// Replace the pair with a new one
+	newDir, newCleanup := tempDir(t)
+	defer newCleanup()
+	newFiles := certs.Generate(t, newDir)
+	copyFile(t, newFiles.ServerCert, files.ServerCert)
+	copyFile(t, newFiles.ServerKey, files.ServerKey)
+
+	second := reloader.Certificate()
+	if bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Errorf("Expected the new certificate to be loaded")
+	}
+
+	// A broken pair keeps the last valid certificate
+	if err := ioutil.WriteFile(files.ServerKey, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, files.ServerKey, 2*time.Second)
+
+	if reloader.Certificate() != second {
+		t.Errorf("Expected the last valid certificate to be kept")
+	}
+}
+
+func TestNewServerConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	files := certs.Generate(t, dir)
+
+	cases := []struct {
+		tls   config.TLSConfig
+		valid bool
+	}{
+		{config.TLSConfig{CertFile: files.ServerCert, KeyFile: files.ServerKey}, true},
+		{config.TLSConfig{CertFile: files.ServerCert, KeyFile: files.ServerKey, ClientAuth: ClientAuthRequire, ClientCAFile: files.CA}, true},
+		{config.TLSConfig{CertFile: files.ServerCert, KeyFile: files.ServerKey, ClientAuth: ClientAuthOptional, ClientCAFile: files.CA}, true},
+		{config.TLSConfig{CertFile: files.ServerCert, KeyFile: files.ServerKey, ClientAuth: ClientAuthRequire}, false},
+		{config.TLSConfig{CertFile: files.ServerCert, KeyFile: files.ServerKey, ClientAuth: "always", ClientCAFile: files.CA}, false},
+		{config.TLSConfig{CertFile: files.ServerCert}, false},
+		{config.TLSConfig{CertFile: files.ServerCert, KeyFile: files.ClientKey}, false},
+	}
+
+	for i, c := range cases {
+		_, err := NewServerConfig(c.tls)
+		if (err == nil) != c.valid {
+			t.Errorf("Case %d: expected valid %v but got error %v", i, c.valid, err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { _ = os.RemoveAll(dir) }
+}
+
+func copyFile(t *testing.T, from, to string) {
+	content, err := ioutil.ReadFile(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(to, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, to, time.Second)
+}
+
+// touch moves the modification time forward, file systems may have a coarse resolution
+func touch(t *testing.T, file string, offset time.Duration) {
+	modTime := time.Now().Add(offset)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+// Exporters supported by the configuration
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+)
+
+const instrumentationName = "github.com/alfcope/checkouttest"
+
+// Attribute keys shared by the instrumented packages
+const (
+	BasketIdKey             = attribute.Key("basket.id")
+	BasketLinesKey          = attribute.Key("basket.lines")
+	ProductCodeKey          = attribute.Key("product.code")
+	PromotionTypeKey        = attribute.Key("promotion.type")
+	OrderIdKey              = attribute.Key("order.id")
+	PaymentAuthorizationKey = attribute.Key("payment.authorization")
+	PaymentAmountKey        = attribute.Key("payment.amount")
+	PaymentCurrencyKey      = attribute.Key("payment.currency")
+)
+
+// Setup installs a tracer provider sending the spans of the service to the exporter, sampling the
+// new traces at the ratio. The returned function flushes and stops the exporter. Until Setup is
+// called spans are not recorded.
+func Setup(exporterName, serviceName string, sampleRatio float64) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+
+	switch exporterName {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		stdoutExporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+		exporter = stdoutExporter
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", exporterName)
+	}
+
+	provider := NewTracerProvider(serviceName, sampleRatio, sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider creates a provider with the service resource and a sampler of the new traces
+// at the ratio, the span processors are given by the options
+func NewTracerProvider(serviceName string, sampleRatio float64, options ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	options = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	}, options...)
+
+	return sdktrace.NewTracerProvider(options...)
+}
+
+// Start creates a span as child of the span in the context
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End records the error, if any, and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statusWriter captures the http response status
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// Unwrap gives http.ResponseController the writer to flush the event streams
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware creates a server span per request named after the matched mux route, continuing
+// the trace of the traceparent header. The log entries of the request get the span ids.
+func Middleware(nextHandler http.Handler) http.Handler {
+	propagator := propagation.TraceContext{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		parent := trace.SpanContextFromContext(ctx)
+
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, fmt.Sprintf("%s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(r.URL.RequestURI())))
+		defer span.End()
+
+		// Without a tracer provider the span is the caller's one, keep the ids of the request
+		if spanContext := span.SpanContext(); spanContext.IsValid() && spanContext.SpanID() != parent.SpanID() {
+			traceContext := logging.TraceContext{
+				TraceId: spanContext.TraceID().String(),
+				SpanId:  spanContext.SpanID().String(),
+				Flags:   spanContext.TraceFlags().String(),
+			}
+			if parent.IsValid() {
+				traceContext.ParentId = parent.SpanID().String()
+			}
+			ctx = logging.WithTraceContext(ctx, traceContext)
+		}
+
+		responseWriter := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		nextHandler.ServeHTTP(responseWriter, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(responseWriter.status))
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(responseWriter.status))
+	})
+}
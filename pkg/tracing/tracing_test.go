@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestMiddlewareServerSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(NewTracerProvider("test", 1, sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	var logTrace logging.TraceContext
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/baskets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logTrace, _ = logging.TraceContextFromContext(r.Context())
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	req := httptest.NewRequest("GET", "/baskets/b1", nil)
+	req.Header.Set(logging.TraceparentHeader, traceparent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span but got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name() != "GET /baskets/{id}" {
+		t.Errorf("Expected span named after the route but got %q", span.Name())
+	}
+	if span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected a server span but got %v", span.SpanKind())
+	}
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the caller trace to be continued")
+	}
+	if logTrace.SpanId != span.SpanContext().SpanID().String() || logTrace.ParentId != "00f067aa0ba902b7" {
+		t.Errorf("Expected the span ids in the log trace context but got %+v", logTrace)
+	}
+}
+
+func TestMiddlewareWithoutProvider(t *testing.T) {
+	var logTrace logging.TraceContext
+	handler := logging.RequestIdMiddleware(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logTrace, _ = logging.TraceContextFromContext(r.Context())
+	})))
+
+	req := httptest.NewRequest("GET", "/baskets/b1", nil)
+	req.Header.Set(logging.TraceparentHeader, traceparent)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if logTrace.ParentId != "00f067aa0ba902b7" || logTrace.SpanId == logTrace.ParentId {
+		t.Errorf("Expected the request trace context to be kept but got %+v", logTrace)
+	}
+}
+
+func TestSetupExporters(t *testing.T) {
+	for _, exporter := range []string{"", ExporterNone} {
+		shutdown, err := Setup(exporter, "test", 1)
+		if err != nil {
+			t.Errorf("Unexpected error with exporter %q: %v", exporter, err)
+			continue
+		}
+		if err = shutdown(context.Background()); err != nil {
+			t.Errorf("Unexpected shutdown error: %v", err)
+		}
+	}
+
+	if _, err := Setup("jaeger", "test", 1); err == nil {
+		t.Errorf("Expected an error with an unknown exporter")
+	}
+}
@@ -0,0 +1,411 @@
+// Package webhooks delivers the basket lifecycle and order events to the subscribed urls. The deliveries are
+// signed, retried with backoff and kept as dead letters when they can't be delivered.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Events sent to the webhooks
+const (
+	BasketCreated = "basket.created"
+	BasketChanged = "basket.changed"
+	BasketPriced  = "basket.priced"
+	BasketDeleted = "basket.deleted"
+	OrderPlaced   = "order.placed"
+)
+
+// EventTypes lists every event a subscription can filter
+var EventTypes = []string{BasketCreated, BasketChanged, BasketPriced, BasketDeleted, OrderPlaced}
+
+// Headers of the deliveries, besides the signature
+const (
+	EventHeader    = "X-Checkout-Event"
+	DeliveryHeader = "X-Checkout-Delivery"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	defaultMaxBackoff  = time.Minute
+	defaultTimeout     = 5 * time.Second
+	defaultQueueSize   = 1000
+	// Dead letters kept for the status, the oldest are dropped
+	maxDeadLetters = 100
+)
+
+// Subscription is a url receiving the events, all of them when no event is set
+type Subscription struct {
+	URL    string
+	Events []string
+	Secret string
+}
+
+// Event is the body of the deliveries
+type Event struct {
+	Id   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// SubscriptionStatus reports the deliveries to a subscription
+type SubscriptionStatus struct {
+	URL          string     `json:"url"`
+	Events       []string   `json:"events"`
+	Pending      int        `json:"pending"`
+	Delivered    int        `json:"delivered"`
+	Retried      int        `json:"retried"`
+	DeadLettered int        `json:"deadLettered"`
+	LastDelivery *time.Time `json:"lastDelivery,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+}
+
+// DeadLetter is an event that could not be delivered
+type DeadLetter struct {
+	URL      string    `json:"url"`
+	Event    Event     `json:"event"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// Status is the delivery status of every subscription with the last dead letters
+type Status struct {
+	Subscriptions []SubscriptionStatus `json:"subscriptions"`
+	DeadLetters   []DeadLetter         `json:"deadLetters"`
+}
+
+// Option configures the dispatcher
+type Option func(*Dispatcher)
+
+// WithRetries sets the attempts per event and the backoff between them, doubled after every
+// attempt up to maxBackoff
+func WithRetries(maxAttempts int, backoff, maxBackoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = maxAttempts
+		d.backoff = backoff
+		d.maxBackoff = maxBackoff
+	}
+}
+
+// WithTimeout bounds every delivery attempt
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.client.Timeout = timeout
+	}
+}
+
+// WithQueueSize sets the events waiting per subscription, the events over it are dead lettered
+func WithQueueSize(size int) Option {
+	return func(d *Dispatcher) {
+		d.queueSize = size
+	}
+}
+
+// Dispatcher delivers the events in the background, a worker per subscription so a failing url
+// does not delay the others. The events of a subscription are delivered in order.
+type Dispatcher struct {
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	queueSize   int
+	now         func() time.Time
+
+	// ctx is canceled when the dispatcher is closed without time to deliver the queued events
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mux         sync.Mutex
+	targets     []*target
+	deadLetters []DeadLetter
+	closed      bool
+}
+
+type target struct {
+	Subscription
+	events map[string]bool
+	queue  chan Event
+	// status is guarded by the dispatcher lock
+	status SubscriptionStatus
+}
+
+// NewDispatcher starts the workers of the subscriptions
+func NewDispatcher(subscriptions []Subscription, options ...Option) *Dispatcher {
+	d := &Dispatcher{
+		client:      &http.Client{Timeout: defaultTimeout},
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		queueSize:   defaultQueueSize,
+		now:         time.Now,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	if d.maxAttempts < 1 {
+		d.maxAttempts = 1
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+
+	for _, s := range subscriptions {
+		t := &target{
+			Subscription: s,
+			queue:        make(chan Event, d.queueSize),
+			status:       SubscriptionStatus{URL: s.URL, Events: s.Events},
+		}
+		if len(s.Events) > 0 {
+			t.events = make(map[string]bool, len(s.Events))
+			for _, e := range s.Events {
+				t.events[e] = true
+			}
+		}
+		d.targets = append(d.targets, t)
+
+		d.wg.Add(1)
+		go d.work(t)
+	}
+
+	return d
+}
+
+// Publish queues the event for the subscriptions interested in it, it does not wait for the
+// deliveries. The data is encoded as json when the event is delivered, it must not change after.
+func (d *Dispatcher) Publish(eventType string, data interface{}) {
+	event := Event{
+		Id:   uuid.New().String(),
+		Type: eventType,
+		Time: d.now().UTC(),
+		Data: data,
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	for _, t := range d.targets {
+		if t.events != nil && !t.events[eventType] {
+			continue
+		}
+
+		select {
+		case t.queue <- event:
+		default:
+			d.recordDeadLetter(t, event, 0, fmt.Errorf("queue full"))
+		}
+	}
+}
+
+// Status returns the delivery status of the subscriptions and the last dead letters
+func (d *Dispatcher) Status() Status {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	status := Status{
+		Subscriptions: make([]SubscriptionStatus, 0, len(d.targets)),
+		DeadLetters:   append([]DeadLetter{}, d.deadLetters...),
+	}
+	for _, t := range d.targets {
+		s := t.status
+		s.Pending = len(t.queue)
+		status.Subscriptions = append(status.Subscriptions, s)
+	}
+	return status
+}
+
+// Close stops taking events and delivers the queued ones until the context is done, the ones
+// left are dead lettered
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mux.Lock()
+	if d.closed {
+		d.mux.Unlock()
+		return nil
+	}
+	d.closed = true
+	for _, t := range d.targets {
+		close(t.queue)
+	}
+	d.mux.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) work(t *target) {
+	defer d.wg.Done()
+
+	for event := range t.queue {
+		d.deliver(t, event)
+	}
+}
+
+// deliver sends the event until it is accepted, refused for good or the attempts are exhausted
+func (d *Dispatcher) deliver(t *target, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		d.deadLetter(t, event, 0, err)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		retryAfter, retry, err := d.send(t, event, body)
+		if err == nil {
+			d.delivered(t)
+			return
+		}
+
+		if !retry || attempt >= d.maxAttempts {
+			d.deadLetter(t, event, attempt, err)
+			return
+		}
+
+		d.retrying(t, err)
+
+		wait := d.backoffFor(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			d.deadLetter(t, event, attempt, fmt.Errorf("dispatcher closed: %v", err))
+			return
+		}
+	}
+}
+
+// send posts the event once, it returns whether a failed attempt can be retried and the time
+// the receiver asked to wait
+func (d *Dispatcher) send(t *target, event Event, body []byte) (time.Duration, bool, error) {
+	if err := d.ctx.Err(); err != nil {
+		return 0, false, fmt.Errorf("dispatcher closed")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req = req.WithContext(d.ctx)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "checkout-webhooks")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, event.Id)
+	req.Header.Set(SignatureHeader, Sign(t.Secret, d.now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+
+	err = fmt.Errorf("%s answered %d", t.URL, resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		var retryAfter time.Duration
+		if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return retryAfter, true, err
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		return 0, true, err
+	}
+
+	// The receiver refused the event, sending it again won't help
+	return 0, false, err
+}
+
+func (d *Dispatcher) backoffFor(attempt int) time.Duration {
+	wait := d.backoff
+	for i := 1; i < attempt && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	if d.maxBackoff > 0 && wait > d.maxBackoff {
+		wait = d.maxBackoff
+	}
+	return wait
+}
+
+func (d *Dispatcher) delivered(t *target) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	now := d.now().UTC()
+	t.status.Delivered++
+	t.status.LastDelivery = &now
+}
+
+func (d *Dispatcher) retrying(t *target, err error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	t.status.Retried++
+	t.status.LastError = err.Error()
+}
+
+// deadLetter records the event given up by a worker
+func (d *Dispatcher) deadLetter(t *target, event Event, attempts int, err error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.recordDeadLetter(t, event, attempts, err)
+}
+
+// recordDeadLetter logs and keeps the event given up, the caller holds the lock
+func (d *Dispatcher) recordDeadLetter(t *target, event Event, attempts int, err error) {
+	logging.Logger.WithFields(logrus.Fields{
+		"url":      t.URL,
+		"event":    event.Type,
+		"delivery": event.Id,
+		"attempts": attempts,
+	}).Errorf("Webhook not delivered: %v", err)
+
+	t.status.DeadLettered++
+	t.status.LastError = err.Error()
+
+	d.deadLetters = append(d.deadLetters, DeadLetter{
+		URL:      t.URL,
+		Event:    event,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Time:     d.now().UTC(),
+	})
+	if len(d.deadLetters) > maxDeadLetters {
+		d.deadLetters = d.deadLetters[len(d.deadLetters)-maxDeadLetters:]
+	}
+}
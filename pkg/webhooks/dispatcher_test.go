@@ -0,0 +1,235 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "webhook-secret"
+
+// receiver records the deliveries and answers them with the statuses given, the last one repeated
+type receiver struct {
+	*httptest.Server
+
+	mux        sync.Mutex
+	statuses   []int
+	deliveries []delivery
+	received   chan struct{}
+}
+
+type delivery struct {
+	header http.Header
+	body   []byte
+	event  Event
+}
+
+func newReceiver(statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, received: make(chan struct{}, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+
+		var event Event
+		_ = json.Unmarshal(body, &event)
+
+		r.mux.Lock()
+		r.deliveries = append(r.deliveries, delivery{header: req.Header, body: body, event: event})
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status = r.statuses[0]
+			if len(r.statuses) > 1 {
+				r.statuses = r.statuses[1:]
+			}
+		}
+		r.mux.Unlock()
+
+		w.WriteHeader(status)
+		r.received <- struct{}{}
+	}))
+	return r
+}
+
+func (r *receiver) wait(t *testing.T, n int) []delivery {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected %d deliveries, got %d", n, i)
+		}
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]delivery{}, r.deliveries...)
+}
+
+func closeDispatcher(t *testing.T, d *Dispatcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := d.Close(ctx); err != nil {
+		t.Errorf("Unexpected error closing: %v", err)
+	}
+}
+
+func TestDeliverSignedEvents(t *testing.T) {
+	r := newReceiver()
+	defer r.Close()
+
+	d := NewDispatcher([]Subscription{{URL: r.URL, Secret: testSecret}})
+	d.Publish(BasketCreated, map[string]string{"id": "basket-1"})
+
+	deliveries := r.wait(t, 1)
+	closeDispatcher(t, d)
+
+	got := deliveries[0]
+	if got.event.Type != BasketCreated || got.event.Id == "" {
+		t.Errorf("Unexpected event %+v", got.event)
+	}
+	if got.header.Get(EventHeader) != BasketCreated || got.header.Get(DeliveryHeader) != got.event.Id {
+		t.Errorf("Unexpected headers %v", got.header)
+	}
+	if err := Verify(testSecret, got.header.Get(SignatureHeader), got.body, time.Minute, time.Now()); err != nil {
+		t.Errorf("Signature should be valid: %v", err)
+	}
+	if err := Verify("another-secret", got.header.Get(SignatureHeader), got.body, time.Minute, time.Now()); err != ErrInvalidSignature {
+		t.Errorf("Signature with another secret should be invalid, got %v", err)
+	}
+
+	status := d.Status()
+	if len(status.Subscriptions) != 1 || status.Subscriptions[0].Delivered != 1 || status.Subscriptions[0].LastDelivery == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestDeliverFilteredEvents(t *testing.T) {
+	r := newReceiver()
+	defer r.Close()
+
+	d := NewDispatcher([]Subscription{{URL: r.URL, Events: []string{BasketDeleted}, Secret: testSecret}})
+	d.Publish(BasketCreated, nil)
+	d.Publish(BasketDeleted, nil)
+
+	deliveries := r.wait(t, 1)
+	closeDispatcher(t, d)
+
+	if len(deliveries) != 1 || deliveries[0].event.Type != BasketDeleted {
+		t.Errorf("Only the deleted event should be delivered, got %v", deliveries)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	r := newReceiver(http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK)
+	defer r.Close()
+
+	d := NewDispatcher([]Subscription{{URL: r.URL, Secret: testSecret}},
+		WithRetries(3, 10*time.Millisecond, 20*time.Millisecond))
+	d.Publish(BasketPriced, nil)
+
+	deliveries := r.wait(t, 3)
+	closeDispatcher(t, d)
+
+	if deliveries[0].event.Id != deliveries[2].event.Id {
+		t.Errorf("Retries should deliver the same event")
+	}
+
+	status := d.Status().Subscriptions[0]
+	if status.Delivered != 1 || status.Retried != 2 || status.DeadLettered != 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestDeadLetterAfterAttempts(t *testing.T) {
+	r := newReceiver(http.StatusBadGateway)
+	defer r.Close()
+
+	d := NewDispatcher([]Subscription{{URL: r.URL, Secret: testSecret}},
+		WithRetries(2, time.Millisecond, time.Millisecond))
+	d.Publish(BasketChanged, nil)
+
+	r.wait(t, 2)
+	closeDispatcher(t, d)
+
+	status := d.Status()
+	if status.Subscriptions[0].DeadLettered != 1 || len(status.DeadLetters) != 1 {
+		t.Fatalf("Expected a dead letter, got %+v", status)
+	}
+	if letter := status.DeadLetters[0]; letter.Attempts != 2 || letter.Event.Type != BasketChanged || letter.URL != r.URL {
+		t.Errorf("Unexpected dead letter %+v", letter)
+	}
+}
+
+func TestRefusedEventNotRetried(t *testing.T) {
+	r := newReceiver(http.StatusBadRequest)
+	defer r.Close()
+
+	d := NewDispatcher([]Subscription{{URL: r.URL, Secret: testSecret}},
+		WithRetries(5, time.Millisecond, time.Millisecond))
+	d.Publish(BasketChanged, nil)
+
+	r.wait(t, 1)
+	closeDispatcher(t, d)
+
+	if letters := d.Status().DeadLetters; len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Errorf("Refused event should be dead lettered after one attempt, got %+v", letters)
+	}
+}
+
+func TestCloseDeadLettersPendingEvents(t *testing.T) {
+	r := newReceiver(http.StatusServiceUnavailable)
+	defer r.Close()
+
+	d := NewDispatcher([]Subscription{{URL: r.URL, Secret: testSecret}},
+		WithRetries(5, time.Hour, time.Hour))
+	d.Publish(BasketChanged, nil)
+	d.Publish(BasketDeleted, nil)
+	r.wait(t, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the close to time out, got %v", err)
+	}
+
+	if letters := d.Status().DeadLetters; len(letters) != 2 {
+		t.Errorf("Pending events should be dead lettered, got %+v", letters)
+	}
+
+	// Events published after the close are ignored
+	d.Publish(BasketCreated, nil)
+	if pending := d.Status().Subscriptions[0].Pending; pending != 0 {
+		t.Errorf("Expected no pending events, got %d", pending)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, WithRetries(10, time.Second, 5*time.Second))
+
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second,
+		4: 5 * time.Second, 9: 5 * time.Second} {
+		if wait := d.backoffFor(attempt); wait != expected {
+			t.Errorf("Attempt %d: expected %v, got %v", attempt, expected, wait)
+		}
+	}
+}
+
+func TestVerifyExpiredSignature(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	sent := time.Now().Add(-time.Hour)
+
+	header := Sign(testSecret, sent, body)
+	if err := Verify(testSecret, header, body, 5*time.Minute, time.Now()); err != ErrExpiredSignature {
+		t.Errorf("Expected an expired signature, got %v", err)
+	}
+	if err := Verify(testSecret, header, []byte(`{"id":"2"}`), 0, time.Now()); err != ErrInvalidSignature {
+		t.Errorf("Expected an invalid signature for another body, got %v", err)
+	}
+	if err := Verify(testSecret, "garbage", body, 0, time.Now()); err != ErrInvalidSignature {
+		t.Errorf("Expected an invalid signature, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the timestamp and the HMAC-SHA256 of the payload, t=1700000000,v1=<hex>.
+// The signed content is the timestamp, a dot and the body, so a captured delivery can't be
+// replayed later with another timestamp.
+const SignatureHeader = "X-Checkout-Signature"
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("webhook signature too old")
+)
+
+// Sign returns the signature header value of the body sent at the timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks the signature header of a delivery received now. Signatures older than the
+// tolerance are refused, a zero tolerance accepts any age.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "t":
+			t = kv[1]
+		case "v1":
+			if signature, err := hex.DecodeString(kv[1]); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	seconds, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expected := mac(secret, t, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			if tolerance > 0 && now.Sub(time.Unix(seconds, 0)) > tolerance {
+				return ErrExpiredSignature
+			}
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
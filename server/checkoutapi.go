@@ -2,25 +2,58 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/alfcope/checkouttest/api"
+	"github.com/alfcope/checkouttest/api/grpcapi"
 	"github.com/alfcope/checkouttest/config"
 	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/payments"
+	"github.com/alfcope/checkouttest/pkg/auth"
 	"github.com/alfcope/checkouttest/pkg/logging"
-	"github.com/gorilla/handlers"
+	"github.com/alfcope/checkouttest/pkg/metrics"
+	"github.com/alfcope/checkouttest/pkg/metrics/prometheus"
+	"github.com/alfcope/checkouttest/pkg/pubsub"
+	"github.com/alfcope/checkouttest/pkg/ratelimit"
+	"github.com/alfcope/checkouttest/pkg/tlsconfig"
+	"github.com/alfcope/checkouttest/pkg/tracing"
+	"github.com/alfcope/checkouttest/pkg/webhooks"
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+// Longest time between the sweeps of the expired baskets
+const basketExpiryInterval = time.Minute
+
 type checkoutApi struct {
 	routes *mux.Router
 
 	controller *api.CheckoutController
-	service    *api.CheckoutService
+	grpcServer *grpc.Server
+	service    api.CheckoutService
+	health     *api.HealthController
+	ds         datasource.Datasource
+	events     *pubsub.Broker
+	webhooks   *webhooks.Dispatcher
+	// Baskets not changed for this time are expired, zero keeps them
+	basketTTL time.Duration
+
+	serverConfig config.ServerConfig
+	tlsConfig    *tls.Config
+	cors         func(http.Handler) http.Handler
+
+	shutdownTracing func(context.Context) error
 }
 
 // Creates an instance of the api endpoints
@@ -32,62 +65,403 @@ func NewCheckoutApi(configuration config.Configuration) (*checkoutApi, error) {
 		return nil, err
 	}
 
-	checkoutService := api.NewCheckoutService(ds)
+	if err := logging.SetLevel(configuration.Logging.Level); err != nil {
+		return nil, err
+	}
+
+	shutdownTracing, err := tracing.Setup(configuration.Tracing.Exporter, configuration.Tracing.ServiceName,
+		configuration.Tracing.SampleRatio)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if tlsconfig.Enabled(configuration.Server.TLS) {
+		if tlsConfig, err = tlsconfig.NewServerConfig(configuration.Server.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	cors, err := newCorsHandler(configuration.Server.CORS)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator, err := auth.New(configuration.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	var basketMiddlewares, adminMiddlewares []mux.MiddlewareFunc
+	var grpcInterceptors []grpc.UnaryServerInterceptor
+	if authenticator != nil {
+		basketMiddlewares = []mux.MiddlewareFunc{api.AuthMiddleware(authenticator)}
+		adminMiddlewares = []mux.MiddlewareFunc{api.AuthMiddleware(authenticator), api.RequireScope(auth.AdminScope)}
+		grpcInterceptors = []grpc.UnaryServerInterceptor{grpcapi.AuthInterceptor(authenticator)}
+	} else {
+		logging.Logger.Warn("Authentication disabled, no api keys nor jwt keys configured")
+	}
+
+	limits := configuration.Limits
+	if rateLimit := limits.RateLimits.Baskets; rateLimit.RequestsPerSecond > 0 {
+		// Shared by both apis so a client gets the same rate whichever it uses
+		limiter := ratelimit.NewLimiter(rateLimit.RequestsPerSecond, rateLimit.Burst)
+		basketMiddlewares = append(basketMiddlewares, api.RateLimitMiddleware(limiter))
+		grpcInterceptors = append(grpcInterceptors, grpcapi.RateLimitInterceptor(limiter))
+	}
+	if rateLimit := limits.RateLimits.Admin; rateLimit.RequestsPerSecond > 0 {
+		adminMiddlewares = append(adminMiddlewares,
+			api.RateLimitMiddleware(ratelimit.NewLimiter(rateLimit.RequestsPerSecond, rateLimit.Burst)))
+	}
+	if limits.MaxBodyBytes > 0 {
+		basketMiddlewares = append(basketMiddlewares, api.BodyLimitMiddleware(limits.MaxBodyBytes))
+		adminMiddlewares = append(adminMiddlewares, api.BodyLimitMiddleware(limits.MaxBodyBytes))
+	}
+
+	events := pubsub.NewBroker()
+	serviceOptions := []api.ServiceOption{
+		api.WithBasketLimits(model.BasketLimits{
+			MaxLines:        limits.MaxBasketLines,
+			MaxLineQuantity: limits.MaxLineQuantity,
+		}),
+		api.WithEventBroker(events),
+	}
+
+	dispatcher := newWebhookDispatcher(configuration.Webhooks)
+	if dispatcher != nil {
+		serviceOptions = append(serviceOptions, api.WithWebhooks(dispatcher))
+	}
+
+	if gateway := newPaymentGateway(configuration.Payments); gateway != nil {
+		serviceOptions = append(serviceOptions,
+			api.WithPaymentGateway(payments.WithTracing(gateway), configuration.Payments.Timeout))
+	}
+	if policy, ok := newTaxPolicy(configuration.Tax); ok {
+		// A product without rate would fail its receipts, not the startup
+		if err := policy.CheckCatalogue(ds.Products()); err != nil {
+			return nil, err
+		}
+		serviceOptions = append(serviceOptions, api.WithTaxes(policy))
+	}
+	currencies := newCurrencies(configuration.Currency)
+	if err := currencies.CheckCatalogue(ds.Products(), ds.GetPromotions(context.Background())); err != nil {
+		return nil, err
+	}
+	serviceOptions = append(serviceOptions, api.WithCurrencies(currencies))
+
+	checkoutService := api.NewCheckoutService(datasource.WithTracing(ds), serviceOptions...)
+
+	recorder := prometheus.NewRecorder()
+	metrics.SetRecorder(recorder)
 
 	routes := mux.NewRouter()
+	routes.Use(metrics.Middleware)
+	routes.Handle("/metrics", recorder.Handler()).Methods("GET")
+
 	apiRoute := routes.PathPrefix("/api/v1").Subrouter().StrictSlash(true)
 
-	api.AddHealthCheckRoute(apiRoute)
+	health := api.NewHealthController(apiRoute, ds)
+	api.AddAdminRoutes(apiRoute, dispatcher, adminMiddlewares...)
 
 	return &checkoutApi{
-		routes:     apiRoute,
-		controller: api.NewCheckoutController(apiRoute, checkoutService),
-		service:    &checkoutService,
+		routes:     routes,
+		controller: api.NewCheckoutController(apiRoute, checkoutService, basketMiddlewares...),
+		grpcServer: grpcapi.NewGrpcServer(checkoutService, tlsConfig, grpcInterceptors...),
+		service:    checkoutService,
+		health:     health,
+		ds:         ds,
+		events:     events,
+		webhooks:   dispatcher,
+		basketTTL:  limits.BasketTTL,
+
+		serverConfig: configuration.Server,
+		tlsConfig:    tlsConfig,
+		cors:         cors,
+
+		shutdownTracing: shutdownTracing,
 	}, nil
 }
 
-// Start the http server
-func (c checkoutApi) RunServer(port int) {
+// Start the http server and block until it is shut down by SIGINT or SIGTERM
+func (c *checkoutApi) RunServer() {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", c.serverConfig.Port))
+	if err != nil {
+		logging.Logger.Errorf("HTTP server Listen: %v", err)
+		return
+	}
 
-	var server = &http.Server{
-		Addr:           fmt.Sprintf(":%v", port),
-		ReadTimeout:    5 * time.Second,
-		WriteTimeout:   5 * time.Second,
-		MaxHeaderBytes: 1 << 20, // Max header of 1MB,
+	var grpcListener net.Listener
+	if c.serverConfig.GRPC.Port != 0 {
+		if grpcListener, err = net.Listen("tcp", fmt.Sprintf(":%v", c.serverConfig.GRPC.Port)); err != nil {
+			logging.Logger.Errorf("gRPC server Listen: %v", err)
+			_ = listener.Close()
+			return
+		}
 	}
 
-	idleConnsClosed := make(chan struct{})
+	stop := make(chan os.Signal, 1)
+	// interrupt signal sent from terminal, sigterm signal sent from kubernetes
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
 
+	c.serve(listener, grpcListener, stop)
+}
+
+// serve handles the requests accepted by the listener, and the gRPC calls accepted by grpcListener
+// when it is not nil, until a value is received from stop. The readiness fails during the drain
+// period so the load balancers stop routing to the server, then the in-flight requests are given
+// the shutdown timeout to finish.
+func (c *checkoutApi) serve(listener, grpcListener net.Listener, stop <-chan os.Signal) {
+	started := time.Now()
+	requests := &requestCounter{}
+
+	var server = &http.Server{
+		Handler:        requests.middleware(c.cors(c.routes)),
+		ReadTimeout:    c.serverConfig.ReadTimeout,
+		WriteTimeout:   c.serverConfig.WriteTimeout,
+		IdleTimeout:    c.serverConfig.IdleTimeout,
+		MaxHeaderBytes: c.serverConfig.MaxHeaderBytes,
+		TLSConfig:      c.tlsConfig,
+	}
+	// The event streams never finish on their own, they are ended so the shutdown does not wait for them
+	server.RegisterOnShutdown(c.events.Close)
+
+	serveErr := make(chan error, 2)
 	go func() {
-		sigint := make(chan os.Signal, 1)
+		if c.tlsConfig != nil {
+			logging.Logger.Info("Starting HTTPS service at ", listener.Addr().String())
+			serveErr <- server.ServeTLS(listener, "", "")
+			return
+		}
 
-		// interrupt signal sent from terminal
-		signal.Notify(sigint, os.Interrupt)
-		// sigterm signal sent from kubernetes
-		signal.Notify(sigint, syscall.SIGTERM)
+		logging.Logger.Info("Starting HTTP service at ", listener.Addr().String())
+		serveErr <- server.Serve(listener)
+	}()
 
-		<-sigint
+	if grpcListener != nil {
+		go func() {
+			logging.Logger.Info("Starting gRPC service at ", grpcListener.Addr().String())
+			if err := c.grpcServer.Serve(grpcListener); err != nil {
+				serveErr <- err
+			}
+		}()
+	}
+
+	stopExpiry := c.expireBaskets()
+
+	var received os.Signal
+	select {
+	case received = <-stop:
+	case err := <-serveErr:
+		// Error starting or closing listener:
+		logging.Logger.Errorf("HTTP server Serve: %v", err)
+	}
+
+	summary := logrus.Fields{}
+	if received != nil {
+		summary["signal"] = received.String()
+	}
 
-		// We received an interrupt signal, shut down.
-		if err := server.Shutdown(context.Background()); err != nil {
-			logging.Logger.Errorf("HTTP server Shutdown: %v", err)
+	drainStarted := time.Now()
+	c.health.SetDraining(true)
+	logging.Logger.WithField("drainPeriod", c.serverConfig.DrainPeriod.String()).Info("Draining HTTP service")
+	time.Sleep(c.serverConfig.DrainPeriod)
+	summary["drained"] = time.Since(drainStarted).String()
+
+	shutdownStarted := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), c.serverConfig.ShutdownTimeout)
+	defer cancel()
+
+	summary["inFlight"] = requests.inFlight()
+	grpcStopped := c.stopGrpc(ctx, grpcListener != nil)
+	if err := server.Shutdown(ctx); err != nil {
+		logging.Logger.Errorf("HTTP server Shutdown: %v", err)
+		summary["shutdownError"] = err.Error()
+		_ = server.Close()
+	}
+	<-grpcStopped
+	stopExpiry()
+	summary["shutdown"] = time.Since(shutdownStarted).String()
+	summary["abandoned"] = requests.inFlight()
+
+	// The events of the last requests are still delivered
+	if c.webhooks != nil {
+		if err := c.webhooks.Close(ctx); err != nil {
+			logging.Logger.Errorf("Webhooks Close: %v", err)
+			summary["webhooksError"] = err.Error()
+		}
+	}
+
+	if closer, ok := c.ds.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logging.Logger.Errorf("Datasource Close: %v", err)
+			summary["datasourceError"] = err.Error()
+		}
+	}
+
+	if err := c.shutdownTracing(ctx); err != nil {
+		logging.Logger.Errorf("Tracing shutdown: %v", err)
+		summary["tracingError"] = err.Error()
+	}
+
+	summary["uptime"] = time.Since(started).String()
+	summary["requests"] = requests.total()
+	logging.Logger.WithFields(summary).Info("HTTP service stopped")
+}
+
+// expireBaskets deletes the expired baskets in the background until the returned function is
+// called
+func (c *checkoutApi) expireBaskets() (stop func()) {
+	if c.basketTTL <= 0 {
+		return func() {}
+	}
+
+	interval := basketExpiryInterval
+	if c.basketTTL < interval {
+		interval = c.basketTTL
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.service.ExpireBaskets(context.Background(), c.basketTTL)
+			case <-done:
+				return
+			}
 		}
-		close(idleConnsClosed)
 	}()
 
-	corsHandler := handlers.CORS(
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
-		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "X-Requested-With", "Authorization"}))
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
 
-	server.Handler = corsHandler(c.routes)
+// newWebhookDispatcher starts the delivery of the webhooks, nil when none is configured
+func newWebhookDispatcher(configuration config.WebhooksConfig) *webhooks.Dispatcher {
+	if len(configuration.Subscriptions) == 0 {
+		return nil
+	}
 
-	logging.Logger.Info("Starting HTTP service at ", port)
+	subscriptions := make([]webhooks.Subscription, 0, len(configuration.Subscriptions))
+	for _, s := range configuration.Subscriptions {
+		subscriptions = append(subscriptions, webhooks.Subscription{URL: s.URL, Events: s.Events, Secret: s.Secret})
+	}
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		// Error starting or closing listener:
-		logging.Logger.Errorf("HTTP server ListenAndServe: %v", err)
+	logging.Logger.WithField("subscriptions", len(subscriptions)).Info("Webhooks enabled")
+	return webhooks.NewDispatcher(subscriptions,
+		webhooks.WithRetries(configuration.MaxAttempts, configuration.Backoff, configuration.MaxBackoff),
+		webhooks.WithTimeout(configuration.Timeout),
+		webhooks.WithQueueSize(configuration.QueueSize))
+}
+
+// newPaymentGateway creates the gateway of the configuration, nil when the payments are not taken
+func newPaymentGateway(configuration config.PaymentsConfig) payments.PaymentGateway {
+	if configuration.Gateway != "fake" {
+		logging.Logger.Info("Payments not taken, the orders stay pending")
+		return nil
 	}
 
-	<-idleConnsClosed
+	logging.Logger.WithField("outcome", configuration.Fake.Outcome).Warn("Payments taken by the fake gateway")
+	return payments.NewFakeGateway(payments.WithOutcome(payments.Outcome(configuration.Fake.Outcome)))
+}
+
+// newTaxPolicy creates the tax policy of the configuration, false when no rate is configured
+func newTaxPolicy(configuration config.TaxConfig) (model.TaxPolicy, bool) {
+	if len(configuration.Rates) == 0 {
+		return model.TaxPolicy{}, false
+	}
+
+	policy := model.TaxPolicy{
+		Mode:          model.PricingMode(configuration.Pricing),
+		DefaultRegion: strings.ToLower(configuration.Region),
+		Rates:         make(map[string]model.TaxRates, len(configuration.Rates)),
+	}
+	for region, rates := range configuration.Rates {
+		taxRates := make(model.TaxRates, len(rates))
+		for category, rate := range rates {
+			taxRates[model.TaxCategory(strings.ToLower(category))] = rate
+		}
+		policy.Rates[strings.ToLower(region)] = taxRates
+	}
+	return policy, true
+}
+
+// newCurrencies creates the currencies of the configuration, the codes are upper case
+func newCurrencies(configuration config.CurrencyConfig) model.Currencies {
+	currencies := model.Currencies{
+		Base:     model.Currency(strings.ToUpper(configuration.Base)),
+		Accepted: make([]model.Currency, 0, len(configuration.Accepted)),
+		Rates:    make(map[model.Currency]float64, len(configuration.Rates)),
+	}
+	for _, accepted := range configuration.Accepted {
+		currencies.Accepted = append(currencies.Accepted, model.Currency(strings.ToUpper(accepted)))
+	}
+	for currency, rate := range configuration.Rates {
+		currencies.Rates[model.Currency(strings.ToUpper(currency))] = rate
+	}
+	return currencies
+}
+
+// stopGrpc lets the running gRPC calls finish until the context is done, then cancels them. The
+// returned channel is closed once the server is stopped.
+func (c *checkoutApi) stopGrpc(ctx context.Context, running bool) <-chan struct{} {
+	stopped := make(chan struct{})
+	if !running {
+		close(stopped)
+		return stopped
+	}
+
+	go func() {
+		defer close(stopped)
+
+		graceful := make(chan struct{})
+		go func() {
+			c.grpcServer.GracefulStop()
+			close(graceful)
+		}()
+
+		select {
+		case <-graceful:
+		case <-ctx.Done():
+			logging.Logger.Errorf("gRPC server Shutdown: %v", ctx.Err())
+			c.grpcServer.Stop()
+		}
+	}()
+
+	return stopped
+}
+
+// requestCounter keeps track of the requests served, for the shutdown summary
+type requestCounter struct {
+	served  int64
+	running int64
+}
+
+func (r *requestCounter) middleware(nextHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&r.running, 1)
+		defer func() {
+			atomic.AddInt64(&r.running, -1)
+			atomic.AddInt64(&r.served, 1)
+		}()
+
+		nextHandler.ServeHTTP(w, req)
+	})
+}
+
+func (r *requestCounter) total() int64 {
+	return atomic.LoadInt64(&r.served)
+}
+
+func (r *requestCounter) inFlight() int64 {
+	return atomic.LoadInt64(&r.running)
 }
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/alfcope/checkouttest/cli"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/internal/tests/certs"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/tlsconfig"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestApi(t *testing.T) *checkoutApi {
+	configuration, err := config.LoadConfiguration("../internal/tests/config", "service_config_test")
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err.Error())
+	}
+
+	checkoutApi, err := NewCheckoutApi(configuration)
+	if err != nil {
+		t.Fatalf("Error initializing api: %v", err.Error())
+	}
+
+	return checkoutApi
+}
+
+func TestServerConfigDefaults(t *testing.T) {
+	checkoutApi := newTestApi(t)
+
+	if checkoutApi.serverConfig.ReadTimeout != 5*time.Second || checkoutApi.serverConfig.ShutdownTimeout != 10*time.Second ||
+		checkoutApi.serverConfig.MaxHeaderBytes != 1<<20 {
+		t.Errorf("Unexpected server defaults %+v", checkoutApi.serverConfig)
+	}
+}
+
+func TestTaxRatesMissingInCatalogue(t *testing.T) {
+	configuration, err := config.LoadConfiguration("../internal/tests/config", "service_config_test")
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err.Error())
+	}
+	configuration.Tax.Rates = map[string]map[string]float64{"es": {"reduced": 10}}
+
+	if _, err := NewCheckoutApi(configuration); err == nil {
+		t.Errorf("Expected an error for the products without a tax rate")
+	}
+}
+
+func TestBulkPricesMissingInCatalogue(t *testing.T) {
+	configuration, err := config.LoadConfiguration("../internal/tests/config", "service_config_test")
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err.Error())
+	}
+	configuration.Currency.Accepted = []string{"GBP"}
+
+	if _, err := NewCheckoutApi(configuration); err == nil {
+		t.Errorf("Expected an error for the bulk rules without a price in pounds")
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	checkoutApi := newTestApi(t)
+	checkoutApi.serverConfig.DrainPeriod = 300 * time.Millisecond
+	checkoutApi.serverConfig.ShutdownTimeout = time.Second
+
+	basket := model.NewBasket("b1")
+	if err := checkoutApi.ds.AddBasket(context.Background(), basket); err != nil {
+		t.Fatalf("Error adding basket: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyz := fmt.Sprintf("http://%s/api/v1/readyz", listener.Addr().String())
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		checkoutApi.serve(listener, nil, stop)
+		close(done)
+	}()
+
+	if status := getStatus(t, readyz); status != http.StatusOK {
+		t.Fatalf("Expected ready server but got %d", status)
+	}
+
+	stop <- syscall.SIGTERM
+
+	// Still serving while draining, but not ready
+	deadline := time.Now().Add(200 * time.Millisecond)
+	status := getStatus(t, readyz)
+	for status != http.StatusServiceUnavailable && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		status = getStatus(t, readyz)
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness failing while draining but got %d", status)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	if _, err := http.Get(readyz); err == nil {
+		t.Errorf("Expected the server to be closed")
+	}
+
+	if _, err := checkoutApi.ds.GetBasket(context.Background(), "b1"); err == nil {
+		t.Errorf("Expected the datasource to be closed")
+	}
+}
+
+func getStatus(t *testing.T, url string) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := certs.Generate(t, dir)
+
+	configuration, err := config.LoadConfiguration("../internal/tests/config", "service_config_test")
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err.Error())
+	}
+	configuration.Server.DrainPeriod = 0
+	configuration.Server.TLS = config.TLSConfig{
+		CertFile:     files.ServerCert,
+		KeyFile:      files.ServerKey,
+		ClientCAFile: files.CA,
+		ClientAuth:   tlsconfig.ClientAuthRequire,
+	}
+
+	checkoutApi, err := NewCheckoutApi(configuration)
+	if err != nil {
+		t.Fatalf("Error initializing api: %v", err.Error())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("https://%s", listener.Addr().String())
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		checkoutApi.serve(listener, nil, stop)
+		close(done)
+	}()
+	defer func() {
+		stop <- syscall.SIGTERM
+		<-done
+	}()
+
+	// Client presenting a certificate signed by the CA
+	client := cli.NewCheckoutClient(url, 1, cli.WithTLSFiles(files.CA, files.ClientCert, files.ClientKey))
+	if _, err := client.AddBasket(context.Background()); err != nil {
+		t.Errorf("Unexpected error with a client certificate: %v", err)
+	}
+
+	// Client without certificate
+	client = cli.NewCheckoutClient(url, 1, cli.WithTLSFiles(files.CA, "", ""))
+	if _, err := client.AddBasket(context.Background()); err == nil {
+		t.Errorf("Expected an error without client certificate")
+	}
+
+	// Client not trusting the server CA
+	client = cli.NewCheckoutClient(url, 1, cli.WithTLSFiles("", files.ClientCert, files.ClientKey))
+	if _, err := client.AddBasket(context.Background()); err == nil {
+		t.Errorf("Expected an error not trusting the server certificate")
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/gorilla/handlers"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const anyOrigin = "*"
+
+// newCorsHandler creates the handler applying the cors policy of the configuration. Without
+// allowed origins the handler is a no-op, so browsers refuse cross-origin responses.
+func newCorsHandler(configuration config.CORSConfig) (func(http.Handler) http.Handler, error) {
+	if len(configuration.AllowedOrigins) == 0 {
+		return func(h http.Handler) http.Handler { return h }, nil
+	}
+
+	matcher, err := newOriginMatcher(configuration.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+
+	if configuration.AllowCredentials && matcher.any {
+		return nil, fmt.Errorf("cors: credentials can't be allowed for any origin")
+	}
+
+	options := []handlers.CORSOption{
+		// The list only tells the handler to answer "*" and to vary on the origin
+		handlers.AllowedOrigins(configuration.AllowedOrigins),
+		handlers.AllowedOriginValidator(matcher.allowed),
+		handlers.AllowedMethods(configuration.AllowedMethods),
+		handlers.AllowedHeaders(configuration.AllowedHeaders),
+		handlers.ExposedHeaders(configuration.ExposedHeaders),
+		handlers.MaxAge(int(configuration.MaxAge.Seconds())),
+	}
+	if configuration.AllowCredentials {
+		options = append(options, handlers.AllowCredentials())
+	}
+
+	cors := handlers.CORS(options...)
+
+	return func(h http.Handler) http.Handler {
+		corsHandler := cors(h)
+		if matcher.any {
+			return corsHandler
+		}
+
+		// The allowed origin is echoed, caches must keep a response per origin
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			corsHandler.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// originMatcher matches origins exactly, or by a wildcard subdomain of the same scheme and port
+type originMatcher struct {
+	any       bool
+	origins   map[string]bool
+	wildcards []wildcardOrigin
+}
+
+type wildcardOrigin struct {
+	// Scheme including "://", and the host without the wildcard, like ".example.com"
+	scheme string
+	domain string
+}
+
+func newOriginMatcher(origins []string) (*originMatcher, error) {
+	matcher := &originMatcher{origins: make(map[string]bool)}
+
+	for _, origin := range origins {
+		if origin == anyOrigin {
+			matcher.any = true
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("cors: invalid origin %q", origin)
+		}
+
+		if strings.HasPrefix(u.Host, "*.") {
+			// https://*.example.com matches https://shop.example.com but not https://example.com
+			matcher.wildcards = append(matcher.wildcards, wildcardOrigin{
+				scheme: strings.ToLower(u.Scheme + "://"),
+				domain: strings.ToLower(u.Host[1:]),
+			})
+			continue
+		}
+		if strings.Contains(u.Host, "*") {
+			return nil, fmt.Errorf("cors: wildcard only allowed as the first label of %q", origin)
+		}
+
+		matcher.origins[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+	}
+
+	return matcher, nil
+}
+
+func (m *originMatcher) allowed(origin string) bool {
+	if m.any {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if m.origins[origin] {
+		return true
+	}
+
+	for _, wildcard := range m.wildcards {
+		if !strings.HasPrefix(origin, wildcard.scheme) {
+			continue
+		}
+
+		host := strings.TrimPrefix(origin, wildcard.scheme)
+		if !strings.HasSuffix(host, wildcard.domain) {
+			continue
+		}
+
+		subdomain := strings.TrimSuffix(host, wildcard.domain)
+		if subdomain != "" && !strings.ContainsAny(subdomain, "/:@") {
+			return true
+		}
+	}
+
+	return false
+}
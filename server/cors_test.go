@@ -0,0 +1,143 @@
+package server
+
+import (
+	"github.com/alfcope/checkouttest/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testCorsConfig(origins ...string) config.CORSConfig {
+	return config.CORSConfig{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "POST", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Request-ID"},
+		ExposedHeaders: []string{"ETag", "X-Request-ID"},
+		MaxAge:         5 * time.Minute,
+	}
+}
+
+func serveCors(t *testing.T, configuration config.CORSConfig, r *http.Request) *httptest.ResponseRecorder {
+	cors, err := newCorsHandler(configuration)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rr, r)
+	return rr
+}
+
+func preflight(origin, method, headers string) *http.Request {
+	r := httptest.NewRequest("OPTIONS", "/api/v1/baskets/", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+func TestCorsPreflight(t *testing.T) {
+	configuration := testCorsConfig("https://till.example.com", "https://*.shops.example.com")
+	configuration.AllowCredentials = true
+
+	rr := serveCors(t, configuration, preflight("https://till.example.com", "DELETE", "authorization, x-request-id"))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":      "https://till.example.com",
+		"Access-Control-Allow-Methods":     "DELETE",
+		"Access-Control-Allow-Headers":     "Authorization,X-Request-Id",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "300",
+		"Vary":                             "Origin",
+	}
+	for header, value := range expected {
+		if got := rr.Header().Get(header); got != value {
+			t.Errorf("Expected %s %q, got %q", header, value, got)
+		}
+	}
+}
+
+func TestCorsPreflightWildcardSubdomain(t *testing.T) {
+	configuration := testCorsConfig("https://*.shops.example.com")
+
+	rr := serveCors(t, configuration, preflight("https://madrid.shops.example.com", "POST", "content-type"))
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://madrid.shops.example.com" {
+		t.Errorf("Expected the subdomain to be allowed, got %q", got)
+	}
+
+	refused := []string{
+		"https://shops.example.com",
+		"http://madrid.shops.example.com",
+		"https://madrid.shops.example.com.evil.com",
+		"https://evilshops.example.com",
+		"https://madrid.shops.example.com:8443",
+	}
+	for _, origin := range refused {
+		rr := serveCors(t, configuration, preflight(origin, "POST", ""))
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Expected origin %s to be refused, got %q", origin, got)
+		}
+	}
+}
+
+func TestCorsPreflightRefused(t *testing.T) {
+	configuration := testCorsConfig("https://till.example.com")
+
+	// Method not allowed
+	rr := serveCors(t, configuration, preflight("https://till.example.com", "PUT", ""))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rr.Code)
+	}
+
+	// Header not allowed
+	rr = serveCors(t, configuration, preflight("https://till.example.com", "POST", "x-custom"))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", rr.Code)
+	}
+}
+
+func TestCorsActualRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/baskets/id", nil)
+	r.Header.Set("Origin", "https://till.example.com")
+
+	rr := serveCors(t, testCorsConfig("*"), r)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected any origin, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Expose-Headers"); got != "Etag,X-Request-Id" {
+		t.Errorf("Unexpected exposed headers %q", got)
+	}
+}
+
+func TestCorsDisabled(t *testing.T) {
+	rr := serveCors(t, testCorsConfig(), preflight("https://till.example.com", "POST", ""))
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no cors headers, got %q", got)
+	}
+}
+
+func TestCorsInvalidConfig(t *testing.T) {
+	configurations := map[string]config.CORSConfig{
+		"credentials for any origin": {AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		"not an origin":              {AllowedOrigins: []string{"till.example.com"}},
+		"origin with path":           {AllowedOrigins: []string{"https://till.example.com/app"}},
+		"inner wildcard":             {AllowedOrigins: []string{"https://till.*.example.com"}},
+	}
+
+	for name, configuration := range configurations {
+		if _, err := newCorsHandler(configuration); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}